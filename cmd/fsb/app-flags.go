@@ -3,13 +3,15 @@ package main
 import "flag"
 
 type AppFlags struct {
-	InitDB bool
-	Ref    bool
+	InitDB       bool
+	Ref          bool
+	LoginUserbot string
 }
 
 func perseFlags() AppFlags {
 	var initDB = flag.Bool("init-db", false, "Create initial tables(eg. users) in the database")
 	var ref = flag.Bool("ref", false, "Enable strict credit checking")
+	var loginUserbot = flag.String("login-userbot", "", "Log in the user account with this phone number to use it as a worker, then exit")
 	flag.Parse()
-	return AppFlags{InitDB: *initDB, Ref: *ref}
+	return AppFlags{InitDB: *initDB, Ref: *ref, LoginUserbot: *loginUserbot}
 }
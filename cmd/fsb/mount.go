@@ -15,14 +15,26 @@ import (
 	"github.com/biisal/fast-stream-bot/internal/bot"
 	db "github.com/biisal/fast-stream-bot/internal/database/psql"
 	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/biisal/fast-stream-bot/internal/http-server/access"
 	"github.com/biisal/fast-stream-bot/internal/http-server/routers"
 	"github.com/biisal/fast-stream-bot/internal/http-server/shortner"
 	rd "github.com/biisal/fast-stream-bot/internal/redis"
+	adminsvc "github.com/biisal/fast-stream-bot/internal/service/admin"
+	"github.com/biisal/fast-stream-bot/internal/service/bottoken"
+	broadcastsvc "github.com/biisal/fast-stream-bot/internal/service/broadcast"
+	chansvc "github.com/biisal/fast-stream-bot/internal/service/channel"
+	collsvc "github.com/biisal/fast-stream-bot/internal/service/collection"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	mirrorsvc "github.com/biisal/fast-stream-bot/internal/service/mirror"
+	ticketsvc "github.com/biisal/fast-stream-bot/internal/service/ticket"
 	"github.com/biisal/fast-stream-bot/internal/service/user"
+	"github.com/biisal/fast-stream-bot/internal/session"
 	"github.com/biisal/fast-stream-bot/logger"
 )
 
-func runServer(cfg config.Config, worker *bot.Worker, redisClient rd.RedisService) error {
+func runServer(cfg config.Config, worker *bot.Worker, redisClient rd.RedisService,
+	fileService filesvc.Service, collectionService collsvc.Service,
+) error {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -31,7 +43,11 @@ func runServer(cfg config.Config, worker *bot.Worker, redisClient rd.RedisServic
 		time.Duration(cfg.UUID_EXPIRATION)*time.Second,
 		cfg.JWT_SECRET, redisClient, cfg.SHORTNER_URL, cfg.SHORTNER_API, cfg)
 
-	mux := routers.SetUpRouters(worker, cfg, s)
+	guard := access.NewGuard(
+		time.Duration(cfg.PASSWORD_ACCESS_HOURS)*time.Hour,
+		[]byte(cfg.LINK_SECRET), redisClient, cfg)
+
+	mux := routers.SetUpRouters(worker, cfg, s, guard, fileService, collectionService)
 	server := http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.HTTP_PORT),
 		Handler: mux,
@@ -44,6 +60,7 @@ func runServer(cfg config.Config, worker *bot.Worker, redisClient rd.RedisServic
 	}()
 
 	<-done
+	defer worker.Stop()
 	ctx, cancle := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancle()
 
@@ -92,11 +109,29 @@ func mount(cfg config.Config, flags AppFlags) error {
 	}()
 
 	userService := user.NewService(r, rdNew, time.Minute*5)
-	worker := bot.StartWorkers(&cfg, userService)
+	fileService := filesvc.NewService(r, rdNew, time.Minute*5)
+	collectionService := collsvc.NewService(r)
+	channelService := chansvc.NewService(r, rdNew, time.Minute*5)
+	mirrorService := mirrorsvc.NewService(r, rdNew, time.Minute*5)
+	adminService := adminsvc.NewService(r, rdNew, time.Minute*5)
+	broadcastService := broadcastsvc.NewService(r)
+	ticketService := ticketsvc.NewService(r)
+	tokenService := bottoken.NewService(r, cfg.BOT_TOKEN_SECRET)
+	sessions, err := session.NewFactory(cfg.SESSION_STORAGE, cfg.SESSION_DIR, r, rdNew, bottoken.NewCipher(cfg.BOT_TOKEN_SECRET))
+	if err != nil {
+		slog.Error("Error setting up session storage", "error", err)
+		return err
+	}
+	if flags.LoginUserbot != "" {
+		return bot.LoginUserbot(ctx, &cfg, sessions, flags.LoginUserbot)
+	}
+	worker := bot.StartWorkers(&cfg, userService, fileService, collectionService, channelService, mirrorService, adminService, broadcastService, ticketService, tokenService, sessions, rdNew)
 	if len(worker.Bots) <= 0 {
 		errMsg := fmt.Errorf("no bots are running! returning")
 		slog.Error("No bots are running", "error", errMsg)
 		return errMsg
 	}
-	return runServer(cfg, worker, rdNew)
+	worker.StartFileCleanup()
+	worker.StartBroadcasts()
+	return runServer(cfg, worker, rdNew, fileService, collectionService)
 }
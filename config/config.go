@@ -3,6 +3,9 @@ package config
 
 import (
 	"log"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -23,15 +26,21 @@ type ShortnerConfig struct {
 }
 
 type AppConfig struct {
-	APP_NAME             string `toml:"app_name" env:"APP_NAME"`
-	ENV_FILE             string `toml:"env_file" env:"ENV_FILE"`
-	HEADER_IMAGE         string `toml:"header_image" env:"HEADER_IMAGE"`
-	MIN_CREDITS_REQUIRED int32  `toml:"min_credits_required" env:"MIN_CREDITS_REQUIRED"`
-	INITIAL_CREDITS      int32  `toml:"initial_credits" env:"INITIAL_CREDITS"`
-	INCREMENT_CREDITS    int32  `toml:"increment_credits" env:"INCREMENT_CREDITS"`
-	DECREMENT_CREDITS    int32  `toml:"decrement_credits" env:"DECREMENT_CREDITS"`
-	MAX_CREDITS          int32  `toml:"max_credits" env:"MAX_CREDITS"`
-	ENABLE_SHORTENER     bool   `toml:"enable_shortener" env:"ENABLE_SHORTENER"`
+	APP_NAME             string  `toml:"app_name" env:"APP_NAME"`
+	ENV_FILE             string  `toml:"env_file" env:"ENV_FILE"`
+	HEADER_IMAGE         string  `toml:"header_image" env:"HEADER_IMAGE"`
+	MIN_CREDITS_REQUIRED int32   `toml:"min_credits_required" env:"MIN_CREDITS_REQUIRED"`
+	INITIAL_CREDITS      int32   `toml:"initial_credits" env:"INITIAL_CREDITS"`
+	INCREMENT_CREDITS    int32   `toml:"increment_credits" env:"INCREMENT_CREDITS"`
+	DECREMENT_CREDITS    int32   `toml:"decrement_credits" env:"DECREMENT_CREDITS"`
+	MAX_CREDITS          int32   `toml:"max_credits" env:"MAX_CREDITS"`
+	ENABLE_SHORTENER     bool    `toml:"enable_shortener" env:"ENABLE_SHORTENER"`
+	RPC_RATE_LIMIT       float64 `toml:"rpc_rate_limit" env:"RPC_RATE_LIMIT"`
+	MAX_FLOOD_WAIT       int     `toml:"max_flood_wait" env:"MAX_FLOOD_WAIT"`
+	LARGE_FILE_MB        int64   `toml:"large_file_mb" env:"LARGE_FILE_MB"`
+
+	EXPIRED_FILE_GRACE_HOURS int `toml:"expired_file_grace_hours" env:"EXPIRED_FILE_GRACE_HOURS"`
+	PASSWORD_ACCESS_HOURS    int `toml:"password_access_hours" env:"PASSWORD_ACCESS_HOURS"`
 }
 
 type Config struct {
@@ -50,19 +59,78 @@ type Config struct {
 	ENVIRONMENT           string `env:"ENVIRONMENT"`
 	LOG_CHANNEL_ID        int64  `env:"LOG_CHANNEL_ID"`
 	MAIN_CHANNEL_ID       int64  `env:"MAIN_CHANNEL_ID"`
+	SUPPORT_GROUP_ID      int64  `env:"SUPPORT_GROUP_ID"`
 	DBSTRING              string `env:"DBSTRING" env-required:"true"`
 
 	ShortnerConfig
 
-	REDIS_DBSTRING string `env:"REDIS_DBSTRING" env-required:"true"`
-	REF            bool
+	REDIS_DBSTRING   string `env:"REDIS_DBSTRING" env-required:"true"`
+	BOT_TOKEN_SECRET string `env:"BOT_TOKEN_SECRET"`
+	CALLBACK_SECRET  string `env:"CALLBACK_SECRET"`
+	LINK_SECRET      string `env:"LINK_SECRET"`
+	SESSION_STORAGE  string `env:"SESSION_STORAGE"`
+	SESSION_DIR      string `env:"SESSION_DIR"`
+	REF              bool
+
+	USERBOT_PHONES_STRING string `env:"USERBOT_PHONES"`
+	USERBOT_PHONES        []string
+
+	// the client address of requests from these proxies is taken from
+	// X-Forwarded-For or X-Real-IP
+	TRUSTED_PROXIES_STRING string `env:"TRUSTED_PROXIES"`
+	TRUSTED_PROXIES        []netip.Prefix
+
+	// users have to join every force-subscribe channel before using the
+	// bot, users of request channels ask to join and are approved by the bot
+	FORCE_SUB_CHANNELS_STRING         string `env:"FORCE_SUB_CHANNELS"`
+	FORCE_SUB_CHANNELS                []int64
+	FORCE_SUB_REQUEST_CHANNELS_STRING string `env:"FORCE_SUB_REQUEST_CHANNELS"`
+	FORCE_SUB_REQUEST_CHANNELS        []int64
 }
 
-func perseTokens(tokenString string) (s []string) {
-	for token := range strings.SplitSeq(tokenString, " ") {
-		s = append(s, strings.TrimSpace(token))
+// ForceSubChannels returns every channel users have to join, the request
+// channels last.
+func (c *Config) ForceSubChannels() []int64 {
+	return append(slices.Clone(c.FORCE_SUB_CHANNELS), c.FORCE_SUB_REQUEST_CHANNELS...)
+}
+
+// IsForceSubRequestChannel reports whether users join channelID by request.
+func (c *Config) IsForceSubRequestChannel(channelID int64) bool {
+	return slices.Contains(c.FORCE_SUB_REQUEST_CHANNELS, channelID)
+}
+
+func perseTokens(tokenString string) []string {
+	return strings.Fields(tokenString)
+}
+
+func perseChannelIDs(name, idString string) []int64 {
+	var ids []int64
+	for _, field := range strings.Fields(idString) {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Fatalf("failed to parse %s: %q is not a channel id", name, field)
+		}
+		ids = append(ids, id)
 	}
-	return
+	return ids
+}
+
+// perseProxies parses addresses and CIDR ranges, a single address is a range
+// of one.
+func perseProxies(proxyString string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Fields(proxyString) {
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(field)
+			if addrErr != nil {
+				log.Fatalf("failed to parse TRUSTED_PROXIES: %q is neither an address nor a range", field)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
 }
 
 func setDefault(appCfg *AppConfig) {
@@ -77,6 +145,22 @@ func setDefault(appCfg *AppConfig) {
 	if appCfg.HEADER_IMAGE == "" {
 		appCfg.HEADER_IMAGE = "/static/images/stream-page.png"
 	}
+
+	if appCfg.MAX_FLOOD_WAIT <= 0 {
+		appCfg.MAX_FLOOD_WAIT = 10
+	}
+
+	if appCfg.LARGE_FILE_MB <= 0 {
+		appCfg.LARGE_FILE_MB = 500
+	}
+
+	if appCfg.EXPIRED_FILE_GRACE_HOURS <= 0 {
+		appCfg.EXPIRED_FILE_GRACE_HOURS = 24
+	}
+
+	if appCfg.PASSWORD_ACCESS_HOURS <= 0 {
+		appCfg.PASSWORD_ACCESS_HOURS = 6
+	}
 }
 
 func MustLoad(configPath string) Config {
@@ -101,11 +185,28 @@ func MustLoad(configPath string) Config {
 	}
 	cfg.AppConfig = appCfg
 	cfg.BOT_TOKENS = perseTokens(cfg.BOT_TOKENS_STRING)
+	// the first bot of BOT_TOKENS answers the users, without it nothing would
+	if len(cfg.BOT_TOKENS) == 0 {
+		log.Fatal("BOT_TOKENS has no bot token")
+	}
+	cfg.USERBOT_PHONES = perseTokens(cfg.USERBOT_PHONES_STRING)
+	cfg.TRUSTED_PROXIES = perseProxies(cfg.TRUSTED_PROXIES_STRING)
+	cfg.FORCE_SUB_CHANNELS = perseChannelIDs("FORCE_SUB_CHANNELS", cfg.FORCE_SUB_CHANNELS_STRING)
+	cfg.FORCE_SUB_REQUEST_CHANNELS = perseChannelIDs("FORCE_SUB_REQUEST_CHANNELS", cfg.FORCE_SUB_REQUEST_CHANNELS_STRING)
 
 	if cfg.ENVIRONMENT == "" {
 		cfg.ENVIRONMENT = ENVIRONMENT_PROD
 	}
 
+	// buttons sent before a restart have to keep working, so the fallback
+	// secret must not be random
+	if cfg.CALLBACK_SECRET == "" {
+		cfg.CALLBACK_SECRET = cfg.APP_HASH
+	}
+	if cfg.LINK_SECRET == "" {
+		cfg.LINK_SECRET = cfg.APP_HASH
+	}
+
 	cfg.HTTP_SCHEME = "https"
 	if cfg.ENVIRONMENT != ENVIRONMENT_PROD {
 		cfg.HTTP_SCHEME = "http"
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	AlbumWaitMs int = 1500
+)
+
+// albumCollector groups the messages of a media group, which Telegram delivers
+// as separate updates, so the album gets one reply instead of one per file.
+type albumCollector struct {
+	mut    sync.Mutex
+	albums map[int64]*album
+}
+
+type album struct {
+	msgs  []*tg.Message
+	timer *time.Timer
+}
+
+// add queues m and calls flush with every message of its group once no more
+// arrived for AlbumWaitMs.
+func (a *albumCollector) add(groupID int64, m *tg.Message, flush func([]*tg.Message)) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if a.albums == nil {
+		a.albums = make(map[int64]*album)
+	}
+	wait := time.Duration(AlbumWaitMs) * time.Millisecond
+	if al, ok := a.albums[groupID]; ok {
+		al.msgs = append(al.msgs, m)
+		al.timer.Reset(wait)
+		return
+	}
+	al := &album{msgs: []*tg.Message{m}}
+	al.timer = time.AfterFunc(wait, func() {
+		a.mut.Lock()
+		// a reset after the timer fired runs it twice
+		if a.albums[groupID] != al {
+			a.mut.Unlock()
+			return
+		}
+		delete(a.albums, groupID)
+		a.mut.Unlock()
+		flush(al.msgs)
+	})
+	a.albums[groupID] = al
+}
@@ -7,31 +7,39 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"time"
 
 	"github.com/biisal/fast-stream-bot/config"
-	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
 	"github.com/biisal/fast-stream-bot/internal/types"
-	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
 	"github.com/gotd/td/tgerr"
-	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// MessagesChunkSize is the most messages Telegram fetches or forwards in one request.
+	MessagesChunkSize int = 100
 )
 
 var (
-	cachedInviteLink string
+	inviteLinksMut sync.Mutex
+	inviteLinks    = make(map[int64]string)
 )
 
-func GetChannelMessage(ctx context.Context, channelID int64, messageId int, api *tg.Client) (*tg.Message, error) {
-	_, inputPeer, err := GetChannelPeer(api, ctx, channelID)
+func GetChannelMessage(ctx context.Context, channelID int64, messageId int, peerManager *peers.Manager) (*tg.Message, error) {
+	inputPeer, err := GetChannelPeer(peerManager, ctx, channelID)
 	if err != nil {
 		return nil, err
 	}
+	api := peerManager.API()
 	slog.Info("Findding message for channel", "channelId", channelID, "messageId", messageId)
 
 	result, err := api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
@@ -73,6 +81,75 @@ func GetChannelMessage(ctx context.Context, channelID int64, messageId int, api
 	return nil, fmt.Errorf("message not found for channel %d", channelID)
 }
 
+// GetChannelMessages returns the messages with the given ids from channelID,
+// skipping deleted and service messages.
+func GetChannelMessages(ctx context.Context, channelID int64, ids []int, peerManager *peers.Manager) ([]*tg.Message, error) {
+	inputPeer, err := GetChannelPeer(peerManager, ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*tg.Message
+	for chunk := range slices.Chunk(ids, MessagesChunkSize) {
+		inputIDs := make([]tg.InputMessageClass, 0, len(chunk))
+		for _, id := range chunk {
+			inputIDs = append(inputIDs, &tg.InputMessageID{ID: id})
+		}
+		result, err := peerManager.API().ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: inputPeer.InputChannel(),
+			ID:      inputIDs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		modified, ok := result.AsModified()
+		if !ok {
+			return nil, fmt.Errorf("unknown result type %T", result)
+		}
+		for _, m := range modified.GetMessages() {
+			if msg, ok := m.(*tg.Message); ok {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// ForwardMessages forwards the messages ids from one peer to another and
+// returns the id of every forwarded message by the id it had in from.
+func ForwardMessages(ctx context.Context, api *tg.Client, from, to tg.InputPeerClass, ids []int) (map[int]int, error) {
+	forwarded := make(map[int]int, len(ids))
+	for chunk := range slices.Chunk(ids, MessagesChunkSize) {
+		randomIDs := make([]int64, len(chunk))
+		origin := make(map[int64]int, len(chunk))
+		for i, id := range chunk {
+			randomIDs[i] = rand.Int64()
+			origin[randomIDs[i]] = id
+		}
+		result, err := api.MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			FromPeer: from,
+			ToPeer:   to,
+			ID:       chunk,
+			RandomID: randomIDs,
+		})
+		if err != nil {
+			return forwarded, err
+		}
+		var updates []tg.UpdateClass
+		switch res := result.(type) {
+		case *tg.Updates:
+			updates = res.Updates
+		case *tg.UpdatesCombined:
+			updates = res.Updates
+		}
+		for _, u := range updates {
+			if u, ok := u.(*tg.UpdateMessageID); ok {
+				forwarded[origin[u.RandomID]] = u.ID
+			}
+		}
+	}
+	return forwarded, nil
+}
+
 func GetMediaFromMessage(msg *tg.Message) (*types.File, error) {
 	media, ok := msg.Media.(*tg.MessageMediaDocument)
 	if !ok {
@@ -127,48 +204,71 @@ func MakeSizeReadable(size int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
 }
 
-func CheckUserInMainChannel(ctx context.Context, client *telegram.Client, channelID int64, userID int64, userAccessHash int64, redisClient *redis.Client) bool {
-	key := fmt.Sprintf("in_channel:%d:%d", channelID, userID)
-	val, err := redisClient.Get(ctx, key).Result()
-	if err != nil && err != redis.Nil {
-		slog.Error("Failed to get value from redis", "error", err)
-		return true
-	}
-	if val == "true" {
+// CheckUserInChannel reports whether a user is a member of a channel the bot
+// administrates. Members are cached for a minute, users the bot can't check
+// are let through so a broken channel doesn't lock everyone out.
+func CheckUserInChannel(ctx context.Context, peerManager *peers.Manager, channelID int64, user *tg.InputPeerUser, redis rs.RedisService) bool {
+	key := fmt.Sprintf("in_channel:%d:%d", channelID, user.UserID)
+	if string(redis.Get(ctx, key)) == "true" {
 		return true
 	}
-	peerManager := peers.Options.Build(peers.Options{}, client.API())
 	targetChannel, err := peerManager.ResolveChannelID(ctx, channelID)
 	if err != nil {
-		slog.Error("Failed to resolve channel ID", "error", err)
+		slog.Error("Failed to resolve channel ID", "channel", channelID, "error", err)
 		return true
 	}
-	inputChannel := targetChannel.InputChannel()
-	participant, err := client.API().ChannelsGetParticipant(ctx, &tg.ChannelsGetParticipantRequest{
-		Channel: inputChannel,
-		Participant: &tg.InputPeerUser{
-			UserID:     userID,
-			AccessHash: userAccessHash,
-		},
+	participant, err := peerManager.API().ChannelsGetParticipant(ctx, &tg.ChannelsGetParticipantRequest{
+		Channel:     targetChannel.InputChannel(),
+		Participant: user,
 	})
 	if err != nil {
-		var rpcErr *tgerr.Error
-		if errors.As(err, &rpcErr) {
-			if rpcErr.Code == 400 && rpcErr.Message == tg.ErrUserNotParticipant {
-				return false
-			}
+		if tgerr.Is(err, tg.ErrUserNotParticipant) {
+			return false
 		}
-		slog.Error("Failed to get participant.", "error", err)
+		slog.Error("Failed to get participant.", "channel", channelID, "error", err)
 		return true
 	}
-
-	isInChannel := participant != nil
-	if isInChannel {
-		if err := redisClient.Set(ctx, key, "true", 1*time.Minute).Err(); err != nil {
-			slog.Warn("Failed to set channel participant status in redis", "error", err)
+	switch p := participant.Participant.(type) {
+	case *tg.ChannelParticipantLeft:
+		return false
+	case *tg.ChannelParticipantBanned:
+		if p.Left {
+			return false
 		}
 	}
-	return isInChannel
+	redis.Set(ctx, key, "true", time.Minute)
+	return true
+}
+
+// ApproveJoinRequest accepts the pending request of a user to join a
+// channel, it returns false if the user has none.
+func ApproveJoinRequest(ctx context.Context, peerManager *peers.Manager, channelID int64, user tg.InputUserClass) (bool, error) {
+	targetChannel, err := peerManager.ResolveChannelID(ctx, channelID)
+	if err != nil {
+		return false, err
+	}
+	_, err = peerManager.API().MessagesHideChatJoinRequest(ctx, &tg.MessagesHideChatJoinRequestRequest{
+		Approved: true,
+		Peer:     targetChannel.InputPeer(),
+		UserID:   user,
+	})
+	if tgerr.Is(err, tg.ErrHideRequesterMissing, tg.ErrUserAlreadyParticipant) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ApproveAllJoinRequests accepts every pending request to join a channel.
+func ApproveAllJoinRequests(ctx context.Context, peerManager *peers.Manager, channelID int64) error {
+	targetChannel, err := peerManager.ResolveChannelID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	_, err = peerManager.API().MessagesHideAllChatJoinRequests(ctx, &tg.MessagesHideAllChatJoinRequestsRequest{
+		Approved: true,
+		Peer:     targetChannel.InputPeer(),
+	})
+	return err
 }
 
 func GetPublicInviteLink(ctx context.Context, targetChannel *peers.Channel, api *tg.Client) (string, error) {
@@ -187,9 +287,12 @@ func GetPublicInviteLink(ctx context.Context, targetChannel *peers.Channel, api
 	return inviteLink, nil
 }
 
-func GetPrivateInviteLink(ctx context.Context, targetChannel *peers.Channel, api *tg.Client) (string, error) {
+// GetPrivateInviteLink creates an invite link of a channel, users opening a
+// requestNeeded link ask to join instead of joining.
+func GetPrivateInviteLink(ctx context.Context, targetChannel *peers.Channel, api *tg.Client, requestNeeded bool) (string, error) {
 	privateInvite, err := api.MessagesExportChatInvite(ctx, &tg.MessagesExportChatInviteRequest{
-		Peer: targetChannel.InputPeer(),
+		Peer:          targetChannel.InputPeer(),
+		RequestNeeded: requestNeeded,
 	})
 	if err != nil {
 		return "", err
@@ -198,34 +301,56 @@ func GetPrivateInviteLink(ctx context.Context, targetChannel *peers.Channel, api
 	if !ok {
 		return "", fmt.Errorf("chat invite not found")
 	}
-	inviteLink := fmt.Sprintf("https://t.me/%s", chatInvite.Link)
-	return inviteLink, nil
+	return chatInvite.Link, nil
 }
 
-func GetMainChannelInviteLink(ctx context.Context, api *tg.Client, cfg *config.Config) (string, error) {
-	if cachedInviteLink != "" {
-		return cachedInviteLink, nil
+// GetChannelInviteLink returns the link users join a channel with, its public
+// link if it has one. Join request channels always get a requestNeeded link,
+// so the bot sees who asked. Links are created once per channel and run.
+func GetChannelInviteLink(ctx context.Context, peerManager *peers.Manager, channelID int64, requestNeeded bool) (string, error) {
+	inviteLinksMut.Lock()
+	defer inviteLinksMut.Unlock()
+	if link, ok := inviteLinks[channelID]; ok {
+		return link, nil
 	}
-	peerManager := peers.Options.Build(peers.Options{}, api)
-	targetChannel, err := peerManager.ResolveChannelID(ctx, cfg.MAIN_CHANNEL_ID)
+	api := peerManager.API()
+	targetChannel, err := peerManager.ResolveChannelID(ctx, channelID)
 	if err != nil {
 		return "", err
 	}
-	link, err := GetPublicInviteLink(ctx, &targetChannel, api)
-	if err == nil {
-		cachedInviteLink = link
-		return link, nil
+	if !requestNeeded {
+		if link, err := GetPublicInviteLink(ctx, &targetChannel, api); err == nil {
+			inviteLinks[channelID] = link
+			return link, nil
+		}
 	}
-	link, err = GetPrivateInviteLink(ctx, &targetChannel, api)
-	if err == nil {
-		cachedInviteLink = link
-		return link, nil
+	link, err := GetPrivateInviteLink(ctx, &targetChannel, api, requestNeeded)
+	if err != nil {
+		return "", err
 	}
-	cachedInviteLink = ""
-	return "", err
+	inviteLinks[channelID] = link
+	return link, nil
 }
 
-
+// SentMessageID returns the id of the message sent by a request which
+// returned result.
+func SentMessageID(result tg.UpdatesClass) (int, bool) {
+	var updates []tg.UpdateClass
+	switch res := result.(type) {
+	case *tg.UpdateShortSentMessage:
+		return res.ID, true
+	case *tg.Updates:
+		updates = res.Updates
+	case *tg.UpdatesCombined:
+		updates = res.Updates
+	}
+	for _, u := range updates {
+		if u, ok := u.(*tg.UpdateMessageID); ok {
+			return u.ID, true
+		}
+	}
+	return 0, false
+}
 
 func ParseMessageAndChannelId(messageIdStr, channelIdStr string, fallbackChannelId int64) (int, int64, error) {
 	messageId, err := strconv.Atoi(messageIdStr)
@@ -254,94 +379,136 @@ func ParseMessageAndChannelId(messageIdStr, channelIdStr string, fallbackChannel
 	return messageId, channelId64, nil
 }
 
-func GetChannelPeer(client *tg.Client, ctx context.Context, channelId int64) (*peers.Manager, *peers.Channel, error) {
-	peerManager := peers.Options.Build(peers.Options{}, client)
+func GetChannelPeer(peerManager *peers.Manager, ctx context.Context, channelId int64) (*peers.Channel, error) {
 	channelPeers, err := peerManager.ResolveChannelID(ctx, channelId)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return peerManager, &channelPeers, nil
+	return &channelPeers, nil
 }
 
-func GetUserPeer(client *tg.Client, ctx context.Context, userId int64) (*peers.Manager, peers.Peer, error) {
-	peerManager := peers.Options.Build(peers.Options{}, client)
+func GetUserPeer(peerManager *peers.Manager, ctx context.Context, userId int64) (peers.Peer, error) {
 	userPeers, err := peerManager.ResolvePeer(ctx, &tg.PeerUser{UserID: userId})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return peerManager, userPeers, nil
+	return userPeers, nil
 }
 
-func BroadcastToUsers(ctx context.Context,
-	usersChan chan *repo.User,
-	replyedMsgId int, adminId int64,
-	client *telegram.Client, fromPeer peers.Peer,
-	peerManager *peers.Manager,
-	completedCounter, failedCounter *atomic.Int32,
-) {
-	waitTime := time.Microsecond * 100
-
-	for {
-		select {
-		case user, ok := <-usersChan:
-			if !ok {
-				return
-			}
-			const maxRetries = 3
-			success := false
-
-			randomId, _ := client.RandInt64()
-			var targetUser peers.Peer
-			var err error
-
-			for idx := range maxRetries {
-				targetUser, err = peerManager.ResolvePeer(ctx, &tg.PeerUser{UserID: user.ID})
-				if err != nil {
-					if idx != maxRetries-1 {
-						slog.Error("Failed to resolve peer! Retrying...", "error", err)
-						time.Sleep(waitTime)
-					}
-					continue
-				}
-				break
-			}
+const ExpiryLayout = "02 Jan 2006 15:04 MST"
 
-			if err != nil || targetUser == nil {
-				failedCounter.Add(1)
-				continue
-			}
+var (
+	durationRegex = regexp.MustCompile(`^(\d+)\s*([mhdw])$`)
+	captionExpiry = regexp.MustCompile(`(?i)\bexpires?\s*[:=]?\s*(\d+\s*[mhdw])\b`)
+	captionName   = regexp.MustCompile(`(?im)^\s*name\s*[:=]\s*(.+?)\s*$`)
+)
 
-			for range maxRetries {
-				_, err = client.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
-					FromPeer:   fromPeer.InputPeer(),
-					ToPeer:     targetUser.InputPeer(),
-					ID:         []int{replyedMsgId},
-					RandomID:   []int64{randomId},
-					DropAuthor: true,
-				})
-				if err != nil {
-					floodErr, ok := tgerr.AsFloodWait(err)
-					if !ok {
-						slog.Error("Failed to send message", "error", err)
-						break
-					}
-
-					slog.Warn("Flood wait", "seconds", floodErr.Seconds())
-					<-time.After(floodErr)
-					continue
-				}
-				success = true
-				break
-			}
-			if success {
-				completedCounter.Add(1)
-			} else {
-				failedCounter.Add(1)
-			}
-		case <-ctx.Done():
-			return
+// ParseDuration parses user supplied durations like 30m, 12h, 7d or 2w.
+func ParseDuration(s string) (time.Duration, error) {
+	match := durationRegex.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid duration %q, use e.g. 30m, 12h, 7d or 2w", s)
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	unit := map[string]time.Duration{
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}[match[2]]
+	return time.Duration(n) * unit, nil
+}
+
+// ExpiryFromCaption finds an expiry option like "expire 7d" in a file caption.
+func ExpiryFromCaption(caption string) (time.Duration, bool) {
+	match := captionExpiry.FindStringSubmatch(caption)
+	if match == nil {
+		return 0, false
+	}
+	d, err := ParseDuration(match[1])
+	return d, err == nil
+}
+
+// NameFromCaption finds a line like "name: Movie (2024).mkv" in a file caption.
+func NameFromCaption(caption string) (string, bool) {
+	match := captionName.FindStringSubmatch(caption)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// GetStreamLink returns the watch page link of a file stored in channelID.
+func GetStreamLink(cfg *config.Config, channelID int64, messageID int, hash string) string {
+	if channelID == cfg.DB_CHANNEL_ID {
+		return fmt.Sprintf("%s/watch/%d?hash=%s", cfg.FQDN, messageID, hash)
+	}
+	return fmt.Sprintf("%s/watch/%d/%d?hash=%s", cfg.FQDN, channelID, messageID, hash)
+}
+
+// GetDownloadLink returns the direct download link of the file.
+func GetDownloadLink(cfg *config.Config, channelID int64, messageID int, hash string) string {
+	return fmt.Sprintf("%s/stream/%d/%d/%s?d=1", cfg.FQDN, channelID, messageID, hash)
+}
+
+// GetThumbLink returns the link of the file's thumbnail.
+func GetThumbLink(cfg *config.Config, channelID int64, messageID int, hash string) string {
+	return fmt.Sprintf("%s/thumb/%d/%d/%s", cfg.FQDN, channelID, messageID, hash)
+}
+
+// GetThumbLocation returns the location of the biggest thumbnail of the
+// message's document.
+func GetThumbLocation(msg *tg.Message) (*tg.InputDocumentFileLocation, error) {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil, fmt.Errorf("media not found")
+	}
+	doc, ok := media.Document.(*tg.Document)
+	if !ok {
+		return nil, fmt.Errorf("media not found")
+	}
+	var thumbType string
+	var thumbSize int
+	for _, t := range doc.Thumbs {
+		if size, ok := t.(*tg.PhotoSize); ok && size.Size > thumbSize {
+			thumbType, thumbSize = size.Type, size.Size
 		}
 	}
+	if thumbType == "" {
+		return nil, types.ErrorNotFound
+	}
+	return &tg.InputDocumentFileLocation{
+		ID:            doc.ID,
+		AccessHash:    doc.AccessHash,
+		FileReference: doc.FileReference,
+		ThumbSize:     thumbType,
+	}, nil
+}
+
+// GetCollectionLink returns the deep link opening the collection in the bot.
+func GetCollectionLink(botUserName, slug string) string {
+	return fmt.Sprintf("https://t.me/%s?start=c_%s", botUserName, slug)
+}
+
+// GetCollectionPageLink returns the link of the collection's web page.
+func GetCollectionPageLink(cfg *config.Config, slug string) string {
+	return fmt.Sprintf("%s/c/%s", cfg.FQDN, slug)
+}
+
+// DeleteChannelMessages deletes the messages with the given ids from channelID.
+func DeleteChannelMessages(ctx context.Context, peerManager *peers.Manager, channelID int64, ids ...int) error {
+	channel, err := GetChannelPeer(peerManager, ctx, channelID)
+	if err != nil {
+		return err
+	}
+	_, err = peerManager.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+		Channel: channel.InputChannel(),
+		ID:      ids,
+	})
+	return err
 }
 
 func GetReferLink(botUserName string, userId int64) string {
@@ -353,10 +520,10 @@ func GetReferLink(botUserName string, userId int64) string {
 	return shareUrl
 }
 
-func SendLogMessage(ctx context.Context, api *tg.Client, sender *message.Sender, logChannelID int64, msg string) error {
+func SendLogMessage(ctx context.Context, peerManager *peers.Manager, sender *message.Sender, logChannelID int64, msg string) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	_, inputPeer, err := GetChannelPeer(api, ctx, logChannelID)
+	inputPeer, err := GetChannelPeer(peerManager, ctx, logChannelID)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@
 package bot
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -13,32 +14,50 @@ import (
 
 	"github.com/biisal/fast-stream-bot/config"
 	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/bot/callback"
 	"github.com/biisal/fast-stream-bot/internal/bot/commands"
 	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
 	"github.com/biisal/fast-stream-bot/internal/service/user"
 	"github.com/biisal/fast-stream-bot/internal/types"
 
+	"github.com/gotd/td/constant"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
 )
 
+const (
+	// ActivityUpdateMin limits how often the last activity of a user is
+	// written, broadcasts only target by days.
+	ActivityUpdateMin int = 60
+)
+
 type Bot struct {
 	WorkingPressure int
 	Default         bool
+	Userbot         bool
 	BotUserName     string
 	Dispatcher      *tg.UpdateDispatcher
 	Ctx             context.Context
 	Client          *telegram.Client
+	Peers           *peers.Manager
 	Sender          *message.Sender
 	Cfg             *config.Config
 	userService     user.Service
+	fileService     filesvc.Service
+	worker          *Worker
+	slot            *workerSlot
+	flood           *floodGuard
+	albums          albumCollector
+	registry        *commands.Registry
 }
 
 func NewBot(ctx context.Context, cfg *config.Config,
 	client *telegram.Client, dispatcher *tg.UpdateDispatcher,
-	userService user.Service, isDefault bool,
+	userService user.Service, fileService filesvc.Service, isDefault bool,
 ) *Bot {
 	api := tg.NewClient(client)
 	sender := message.NewSender(api)
@@ -50,7 +69,16 @@ func NewBot(ctx context.Context, cfg *config.Config,
 		Cfg:         cfg,
 		Sender:      sender,
 		userService: userService,
+		fileService: fileService,
+	}
+}
+
+// CooldownLeft returns how long the bot still backs off after a long FLOOD_WAIT.
+func (b *Bot) CooldownLeft() time.Duration {
+	if b.flood == nil {
+		return 0
 	}
+	return b.flood.cooldownLeft()
 }
 
 func (b *Bot) HandleRefer(userInfo *user.TgUser, m *tg.Message, e tg.Entities, builder *message.Builder) (tg.UpdatesClass, error) {
@@ -76,7 +104,7 @@ func (b *Bot) HandleRefer(userInfo *user.TgUser, m *tg.Message, e tg.Entities, b
 	if err != nil {
 		return nil, nil
 	}
-	_, refUserPeer, err := botutils.GetUserPeer(b.Client.API(), ctx, refId)
+	refUserPeer, err := botutils.GetUserPeer(b.Peers, ctx, refId)
 	if err != nil {
 		return nil, nil
 	}
@@ -106,23 +134,26 @@ func (b *Bot) validateAndGetUser(ctx context.Context, m *tg.Message,
 			ID:     userInfo.ID,
 			Credit: b.Cfg.INITIAL_CREDITS,
 		})
-		if err != nil && !errors.Is(err, types.ErrorDuplicate) {
+		switch {
+		case errors.Is(err, types.ErrorDuplicate):
+			// the user was marked deleted after blocking the bot and is back
+			if dbUser, err = b.userService.SetDeleted(ctx, userInfo.ID, false); err != nil {
+				slog.Error("Failed to reactivate user", "error", err)
+				return nil, nil, false, fmt.Errorf("internal server error")
+			}
+			slog.Info("User came back", "user", userInfo.ID)
+		case err != nil:
 			slog.Error("Failed to create user", "error", err)
 			return nil, nil, false, fmt.Errorf("internal server error")
+		default:
+			isNewUser = true
+			if _, err := b.HandleRefer(userInfo, m, e, builder); err != nil {
+				slog.Error("Failed to handle referral", "error", err)
+			}
 		}
-		isNewUser = true
-		if _, err := b.HandleRefer(userInfo, m, e, builder); err != nil {
-			slog.Error("Failed to handle referral", "error", err)
-		}
-	}
-	if dbUser.IsBanned {
-		errMsg := fmt.Errorf("you are banned to use this bot\ncontact admin for more info")
-		if _, err := builder.Text(ctx, errMsg.Error()); err != nil {
-			slog.Error("Failed to send ban message", "error", err)
-		}
-		return nil, nil, false, errMsg
 	}
-	if dbUser.Credit < b.Cfg.MAX_CREDITS &&
+	// banned users are refused by commands.CheckBan
+	if !dbUser.IsBanned && dbUser.Credit < b.Cfg.MAX_CREDITS &&
 		(dbUser.LastCreditUpdate.Time.IsZero() || dbUser.LastCreditUpdate.Time.Day() != time.Now().Day()) {
 		dbUser, err = b.userService.IncrementCredits(ctx, dbUser.ID, int32(b.Cfg.INCREMENT_CREDITS), true)
 		if err != nil {
@@ -130,10 +161,29 @@ func (b *Bot) validateAndGetUser(ctx context.Context, m *tg.Message,
 			return nil, nil, false, fmt.Errorf("internal server error")
 		}
 	}
+	language := cmp.Or(userInfo.LangCode, dbUser.Language)
+	if !dbUser.LastActiveAt.Valid || language != dbUser.Language ||
+		time.Since(dbUser.LastActiveAt.Time) > time.Duration(ActivityUpdateMin)*time.Minute {
+		if touched, err := b.userService.Touch(ctx, dbUser.ID, language); err != nil {
+			slog.Error("Failed to update user activity", "error", err)
+		} else {
+			dbUser = touched
+		}
+	}
 	return userInfo, dbUser, isNewUser, nil
 }
 
+func (b *Bot) newContext(ctx context.Context, m *tg.Message, e tg.Entities, builder *message.Builder,
+	userInfo *user.TgUser, dbUser *repo.User,
+) *commands.Context {
+	return commands.NewContext(ctx, b.Ctx, m, e, builder, b.Client, b.Peers, b.Sender, userInfo, dbUser,
+		b.userService, b.fileService, b.worker.collections, b.worker.channels, b.worker.mirrors, b.worker.admins, b.worker.broadcasts, b.worker.tickets, b.worker.redis, b.worker.callbacks, b.registry, b.Cfg, b.BotUserName, b.worker)
+}
+
+// SetUpOnMessage runs the commands of NewDefaultRegistry for messages sent to
+// the bot.
 func (b *Bot) SetUpOnMessage() {
+	b.registry = commands.NewDefaultRegistry()
 	b.Dispatcher.OnNewMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewMessage) error {
 		m, ok := update.Message.(*tg.Message)
 		if !ok || m.Out {
@@ -151,40 +201,193 @@ func (b *Bot) SetUpOnMessage() {
 			if userInfo.Username != "" {
 				logMsg = fmt.Sprintf("New user joined: %s (@%s, ID: %d)", userInfo.FirstName, userInfo.Username, userInfo.ID)
 			}
-			if err := botutils.SendLogMessage(ctx, b.Client.API(), b.Sender, b.Cfg.LOG_CHANNEL_ID, logMsg); err != nil {
+			if err := botutils.SendLogMessage(ctx, b.Peers, b.Sender, b.Cfg.LOG_CHANNEL_ID, logMsg); err != nil {
 				slog.Error("Failed to send new user log", "error", err)
 			}
 		}
-		bc := commands.NewContext(ctx, m, e, builder, b.Client, b.Sender, userInfo, dbUser, b.userService, b.Cfg, b.BotUserName)
+		bc := b.newContext(ctx, m, e, builder, userInfo, dbUser)
+		// a running dialog takes every message, files and commands included
+		if cmd, ok := b.registry.Conversation(bc); ok {
+			_, err = b.registry.Run(bc, cmd)
+			return err
+		}
+		// replies to answers of support go to their ticket
+		if cmd, ok := commands.SupportReply(bc); ok {
+			_, err = b.registry.Run(bc, cmd)
+			return err
+		}
 		switch m.Media.(type) {
 		case *tg.MessageMediaDocument, *tg.MessageMediaPhoto:
-			_, err = bc.MediaForwarding(commands.MediaForwardParams{Cfg: b.Cfg, Update: update, Client: b.Client})
+			if groupID, ok := m.GetGroupedID(); ok {
+				b.albums.add(groupID, m, func(msgs []*tg.Message) {
+					// the album is handled after this update, so it can't use its context
+					albumCtx := b.newContext(b.Ctx, m, e, builder, userInfo, dbUser)
+					if _, err := b.registry.Run(albumCtx, commands.AlbumCommand(msgs)); err != nil {
+						slog.Error("Failed to handle album", "error", err)
+					}
+				})
+				return nil
+			}
+			_, err = b.registry.Run(bc, commands.MediaCommand(commands.MediaForwardParams{Cfg: b.Cfg, Update: update, Client: b.Client}))
 			if err != nil {
 				slog.Error("Failed to forward message", "error", err)
 			}
 			return err
 		default:
-			switch val := strings.TrimSpace(m.Message); {
-			case val == "/broadcast":
-				_, err = bc.HandleBroadcast(b.Cfg.ADMIN_ID)
-			case val == "/help":
-				_, err = bc.HandleHelp(b.Cfg.ADMIN_ID)
-			case val == "/stat":
-				_, err = bc.HandleStat(b.Cfg.ADMIN_ID)
-			case strings.HasPrefix(val, "/unban"):
-				_, err = bc.HandleToggleBan(b.Cfg.ADMIN_ID, false)
-			case strings.HasPrefix(val, "/ban"):
-				_, err = bc.HandleToggleBan(b.Cfg.ADMIN_ID, true)
-			case strings.HasPrefix(val, "/report"):
-				_, err = bc.HandleReport(b.Cfg.ADMIN_ID)
-			default:
-				if strings.HasPrefix(val, "/") && !strings.HasPrefix(val, "/start") {
-					_, err = bc.HandleSendCommandList(b.Cfg.ADMIN_ID)
-					return err
-				}
-				_, err = bc.HandleStart()
+			_, err = b.registry.Dispatch(bc)
+			return err
+		}
+	})
+}
+
+// syncMenu sets the command menus shown by Telegram from the registry.
+func (b *Bot) syncMenu(ctx context.Context) {
+	roles := map[int64]commands.Role{b.Cfg.ADMIN_ID: commands.RoleOwner}
+	admins, err := b.worker.admins.List(ctx)
+	if err != nil {
+		slog.Error("Failed to get staff, only the owner gets a menu", "error", err)
+	}
+	for _, a := range admins {
+		if role, ok := commands.ParseRole(a.Role); ok {
+			roles[a.UserID] = role
+		}
+	}
+	var staff []commands.StaffMenu
+	for userID, role := range roles {
+		peer, err := botutils.GetUserPeer(b.Peers, ctx, userID)
+		if err != nil {
+			slog.Warn("Failed to resolve staff, their menu is set after a restart", "user", userID, "error", err)
+			continue
+		}
+		staff = append(staff, commands.StaffMenu{Peer: peer.InputPeer(), Role: role})
+	}
+	if err := b.registry.SyncMenu(ctx, b.Client.API(), staff); err != nil {
+		slog.Error("Failed to set bot commands", "error", err)
+	}
+}
+
+// SetUpOnCallback routes the buttons of the bot's messages, see
+// commands.NewCallbackRouter.
+func (b *Bot) SetUpOnCallback() {
+	router := commands.NewCallbackRouter(b.worker.callbacks)
+	b.Dispatcher.OnBotCallbackQuery(func(ctx context.Context, e tg.Entities, update *tg.UpdateBotCallbackQuery) error {
+		u, ok := e.Users[update.UserID]
+		if !ok {
+			return nil
+		}
+		peer := &tg.InputPeerUser{UserID: u.ID, AccessHash: u.AccessHash}
+		query := callback.NewQuery(ctx, update, peer, b.Client.API(), b.Sender)
+		cc := commands.NewCallbackContext(query, b.Peers, b.Cfg, b.fileService, b.worker.redis, b.worker.callbacks)
+
+		dbUser, err := b.userService.GetUserByTgID(ctx, update.UserID)
+		if err != nil || dbUser.IsBanned {
+			return cc.Answer("You can't use this bot")
+		}
+		if err := router.Dispatch(ctx, cc, update.Data); err != nil {
+			slog.Error("Failed to handle callback", "error", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// SetUpOnInline answers inline queries. Inline mode has to be enabled for the
+// bot with @BotFather's /setinline.
+func (b *Bot) SetUpOnInline() {
+	b.Dispatcher.OnBotInlineQuery(func(ctx context.Context, e tg.Entities, update *tg.UpdateBotInlineQuery) error {
+		ic := commands.NewInlineContext(ctx, update, b.Client.API(), b.Cfg, b.fileService)
+
+		dbUser, err := b.userService.GetUserByTgID(ctx, update.UserID)
+		if err != nil || dbUser.IsBanned {
+			return ic.Answer()
+		}
+		if err := ic.HandleInlineQuery(); err != nil {
+			slog.Error("Failed to answer inline query", "error", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// SetUpOnChannelPost mirrors new files of source channels and links new files
+// posted in channels registered with /addchannel. Messages of the support
+// group go to commands.SupportDesk.
+func (b *Bot) SetUpOnChannelPost() {
+	b.Dispatcher.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewChannelMessage) error {
+		m, ok := update.Message.(*tg.Message)
+		if !ok || m.Out {
+			return nil
+		}
+		peer, ok := m.PeerID.(*tg.PeerChannel)
+		if !ok {
+			return nil
+		}
+		if b.Cfg.SUPPORT_GROUP_ID != 0 && constant.TDLibPeerID(b.Cfg.SUPPORT_GROUP_ID).ToPlain() == peer.ChannelID {
+			sd := commands.NewSupportDesk(b.Client.API(), b.Peers, b.Sender, b.Cfg, b.worker.admins, b.worker.tickets)
+			if err := sd.HandleGroupMessage(ctx, m); err != nil {
+				slog.Error("Failed to handle support group message", "error", err)
+				return err
+			}
+			return nil
+		}
+		if m.Media == nil {
+			return nil
+		}
+		// the DB and log channels are written by the bot itself
+		for _, id := range []int64{b.Cfg.DB_CHANNEL_ID, b.Cfg.LOG_CHANNEL_ID, b.Cfg.MAIN_CHANNEL_ID} {
+			if id != 0 && constant.TDLibPeerID(id).ToPlain() == peer.ChannelID {
+				return nil
 			}
+		}
+		mr := commands.NewMirrorer(b.Client.API(), b.Peers, b.Sender, b.Cfg, b.fileService, b.worker.mirrors)
+		if err := mr.HandleChannelPost(ctx, peer.ChannelID, m); err != nil {
+			slog.Error("Failed to get mirrors", "error", err)
+		}
+		channel, err := b.worker.channels.Get(ctx, peer.ChannelID)
+		if err != nil || !channel.Enabled {
+			return nil
+		}
+		pc := commands.NewChannelPostContext(ctx, m, channel, b.Client.API(), b.Peers, b.Cfg, b.userService, b.fileService)
+		if err := pc.HandleChannelPost(); err != nil {
+			slog.Error("Failed to handle channel post", "error", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// SetUpOnJoinRequest approves the requests to join the channels of
+// FORCE_SUB_REQUEST_CHANNELS, the bot has to be an admin of them.
+func (b *Bot) SetUpOnJoinRequest() {
+	b.Dispatcher.OnBotChatInviteRequester(func(ctx context.Context, e tg.Entities, update *tg.UpdateBotChatInviteRequester) error {
+		peer, ok := update.Peer.(*tg.PeerChannel)
+		if !ok {
+			return nil
+		}
+		channelID := constant.TDLibPeerID(0)
+		channelID.Channel(peer.ChannelID)
+		if !b.Cfg.IsForceSubRequestChannel(int64(channelID)) {
+			return nil
+		}
+		u, ok := e.Users[update.UserID]
+		if !ok {
+			return nil
+		}
+		if _, err := botutils.ApproveJoinRequest(ctx, b.Peers, int64(channelID), u.AsInput()); err != nil {
+			slog.Error("Failed to approve join request", "channel", int64(channelID), "user", update.UserID, "error", err)
 			return err
 		}
+		slog.Info("Approved join request", "channel", int64(channelID), "user", update.UserID)
+		return nil
 	})
 }
+
+// approveJoinRequests approves the requests to join the channels of
+// FORCE_SUB_REQUEST_CHANNELS sent while the bot was down.
+func (b *Bot) approveJoinRequests(ctx context.Context) {
+	for _, channelID := range b.Cfg.FORCE_SUB_REQUEST_CHANNELS {
+		if err := botutils.ApproveAllJoinRequests(ctx, b.Peers, channelID); err != nil {
+			slog.Error("Failed to approve join requests", "channel", channelID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	broadcastsvc "github.com/biisal/fast-stream-bot/internal/service/broadcast"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/styling"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	BroadcastPollSec     int = 10
+	BroadcastBatch       int = 50
+	BroadcastWorkers     int = 3
+	BroadcastMaxAttempts int = 3
+)
+
+// StartBroadcasts runs the broadcasts whose time has come. Every delivery is
+// stored, so a broadcast stopped by a restart resumes with the users which
+// didn't get it yet.
+func (w *Worker) StartBroadcasts() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(BroadcastPollSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			w.runBroadcasts()
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (w *Worker) runBroadcasts() {
+	bot := w.DefaultBot()
+	if bot == nil || bot.Peers == nil {
+		return
+	}
+	due, err := w.broadcasts.Due(w.ctx)
+	if err != nil {
+		slog.Error("Failed to get due broadcasts", "error", err)
+		return
+	}
+	for _, b := range due {
+		if err := w.runBroadcast(bot, b); err != nil && w.ctx.Err() == nil {
+			slog.Error("Failed to run broadcast", "id", b.ID, "error", err)
+		}
+	}
+}
+
+// runBroadcast sends b in batches until every user got it or it is cancelled.
+func (w *Worker) runBroadcast(bot *Bot, b *repo.Broadcast) error {
+	ctx := w.ctx
+	if b.Status == broadcastsvc.StatusScheduled {
+		var err error
+		if b, err = w.broadcasts.Start(ctx, b.ID); err != nil {
+			return err
+		}
+		w.NotifyUser(b.CreatedBy, fmt.Sprintf("Broadcast #%d started, sending to %d users.", b.ID, b.Total))
+	}
+	from, err := botutils.GetChannelPeer(bot.Peers, ctx, b.ChannelID)
+	if err != nil {
+		return err
+	}
+	for {
+		// cancelling only changes the status, so check it between batches
+		if current, err := w.broadcasts.Get(ctx, b.ID); err != nil {
+			return err
+		} else if current.Status != broadcastsvc.StatusRunning {
+			return nil
+		}
+		pending, err := w.broadcasts.Pending(ctx, b.ID, BroadcastBatch)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			break
+		}
+		unstored := w.sendBroadcastBatch(ctx, bot, from.InputPeer(), b, pending)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := w.storeDeliveries(ctx, b.ID, unstored); err != nil {
+			return err
+		}
+	}
+	if _, err := w.broadcasts.Finish(ctx, b.ID); err != nil {
+		// cancelled after the last batch
+		if errors.Is(err, types.ErrorNotFound) {
+			return nil
+		}
+		return err
+	}
+	w.reportBroadcast(bot, b)
+	return nil
+}
+
+// delivery is the result of sending a broadcast to a user.
+type delivery struct {
+	userID  int64
+	sendErr error
+}
+
+// sendBroadcastBatch sends b to the pending users and returns the deliveries
+// which were sent but couldn't be stored. The rest of the batch isn't sent
+// once storing fails, it stays pending.
+func (w *Worker) sendBroadcastBatch(ctx context.Context, bot *Bot, from tg.InputPeerClass, b *repo.Broadcast, pending []*repo.BroadcastDelivery) []delivery {
+	deliveries := make(chan *repo.BroadcastDelivery)
+	wg := &sync.WaitGroup{}
+	var mut sync.Mutex
+	var unstored []delivery
+	for range min(BroadcastWorkers, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				mut.Lock()
+				storeFailed := len(unstored) > 0
+				mut.Unlock()
+				if storeFailed {
+					continue
+				}
+				sendErr := sendBroadcast(ctx, bot, from, b, d.UserID)
+				// deliveries cut short by a shutdown stay pending
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := w.broadcasts.SetDelivered(ctx, b.ID, d.UserID, sendErr); err != nil {
+					slog.Error("Failed to store broadcast delivery", "id", b.ID, "user", d.UserID, "error", err)
+					mut.Lock()
+					unstored = append(unstored, delivery{d.UserID, sendErr})
+					mut.Unlock()
+				}
+				if errors.Is(sendErr, broadcastsvc.ErrUserGone) {
+					if _, err := w.userService.SetDeleted(ctx, d.UserID, true); err != nil {
+						slog.Error("Failed to mark user deleted", "user", d.UserID, "error", err)
+					}
+				}
+			}
+		}()
+	}
+	for _, d := range pending {
+		deliveries <- d
+	}
+	close(deliveries)
+	wg.Wait()
+	return unstored
+}
+
+// storeDeliveries stores deliveries until it works. A sent delivery left
+// pending would be fetched and sent to its user again.
+func (w *Worker) storeDeliveries(ctx context.Context, id int64, deliveries []delivery) error {
+	for _, d := range deliveries {
+		for {
+			err := w.broadcasts.SetDelivered(ctx, id, d.userID, d.sendErr)
+			if err == nil {
+				break
+			}
+			slog.Error("Failed to store broadcast delivery, retrying", "id", id, "user", d.userID, "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(BroadcastPollSec) * time.Second):
+			}
+		}
+	}
+	return nil
+}
+
+// userGone reports whether err means the user blocked the bot or deleted
+// their account.
+func userGone(err error) bool {
+	return tgerr.Is(err, tg.ErrUserIsBlocked, tg.ErrInputUserDeactivated, tg.ErrPeerIDInvalid)
+}
+
+// sendBroadcast forwards the message of b to a user without the forward
+// header and pins it if b asks for it. Flood waits too long for the flood
+// guard are waited out here, a broadcast has no hurry. Errors of users who
+// are gone wrap broadcastsvc.ErrUserGone.
+func sendBroadcast(ctx context.Context, bot *Bot, from tg.InputPeerClass, b *repo.Broadcast, userID int64) error {
+	err := forwardBroadcast(ctx, bot, from, b, userID)
+	if userGone(err) {
+		return fmt.Errorf("%w: %w", broadcastsvc.ErrUserGone, err)
+	}
+	return err
+}
+
+func forwardBroadcast(ctx context.Context, bot *Bot, from tg.InputPeerClass, b *repo.Broadcast, userID int64) error {
+	user, err := botutils.GetUserPeer(bot.Peers, ctx, userID)
+	if err != nil {
+		return err
+	}
+	var result tg.UpdatesClass
+	for attempt := 1; ; attempt++ {
+		result, err = bot.Client.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			FromPeer:   from,
+			ToPeer:     user.InputPeer(),
+			ID:         []int{int(b.MessageID)},
+			RandomID:   []int64{rand.Int64()},
+			DropAuthor: true,
+		})
+		wait, ok := tgerr.AsFloodWait(err)
+		if !ok || attempt >= BroadcastMaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !b.Pin {
+		return nil
+	}
+	messageID, ok := botutils.SentMessageID(result)
+	if !ok {
+		return errors.New("sent message not found to pin")
+	}
+	if _, err := bot.Client.API().MessagesUpdatePinnedMessage(ctx, &tg.MessagesUpdatePinnedMessageRequest{
+		Silent: true,
+		Peer:   user.InputPeer(),
+		ID:     messageID,
+	}); err != nil {
+		// the message was sent, a failed pin doesn't make the delivery fail
+		slog.Warn("Failed to pin broadcast", "id", b.ID, "user", userID, "error", err)
+	}
+	return nil
+}
+
+// reportBroadcast tells the creator of b how it went and sends the users it
+// failed for as a file.
+func (w *Worker) reportBroadcast(bot *Bot, b *repo.Broadcast) {
+	ctx, cancel := context.WithTimeout(w.ctx, time.Minute)
+	defer cancel()
+	counts, err := w.broadcasts.Counts(ctx, b.ID)
+	if err != nil {
+		slog.Error("Failed to count broadcast deliveries", "id", b.ID, "error", err)
+		return
+	}
+	report := fmt.Sprintf("Broadcast #%d done!\nSent: %d\nFailed: %d\nBlocked or deleted: %d",
+		b.ID, counts.Sent, counts.Failed, counts.Blocked)
+	if counts.Failed == 0 {
+		w.NotifyUser(b.CreatedBy, report)
+		return
+	}
+	failed, err := w.broadcasts.Failed(ctx, b.ID)
+	if err != nil {
+		slog.Error("Failed to get failed broadcast deliveries", "id", b.ID, "error", err)
+		w.NotifyUser(b.CreatedBy, report)
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("user_id,error\n")
+	for _, d := range failed {
+		sb.WriteString(fmt.Sprintf("%d,%q\n", d.UserID, d.Error))
+	}
+	peer, err := botutils.GetUserPeer(bot.Peers, ctx, b.CreatedBy)
+	if err != nil {
+		slog.Error("Failed to get user peer", "user", b.CreatedBy, "error", err)
+		return
+	}
+	name := fmt.Sprintf("broadcast-%d-failed.csv", b.ID)
+	if _, err := bot.Sender.To(peer.InputPeer()).Upload(message.FromBytes(name, []byte(sb.String()))).
+		File(ctx, styling.Plain(report)); err != nil {
+		slog.Error("Failed to send broadcast report", "id", b.ID, "error", err)
+		w.NotifyUser(b.CreatedBy, report)
+	}
+}
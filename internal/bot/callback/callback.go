@@ -0,0 +1,296 @@
+// Package callback routes the callback queries of inline keyboard buttons
+package callback
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// MaxDataLength is the most bytes Telegram accepts as data of a button.
+	MaxDataLength int = 64
+	// SignatureLength is the length of the signature ending the data.
+	SignatureLength int = 8
+	// StateTTLHours is how long arguments too long for the button are kept in
+	// redis, buttons pressed later answer as expired.
+	StateTTLHours int = 48
+	stateKeyBytes int = 6
+)
+
+const (
+	separator   = ":"
+	statePrefix = "~"
+	// NoopRoute is answered without doing anything, e.g. by page counters.
+	NoopRoute = "noop"
+)
+
+var (
+	ErrInvalidData = errors.New("invalid callback data")
+	ErrExpired     = errors.New("callback data expired")
+)
+
+// Args are the arguments of a button in the order they were encoded.
+type Args []string
+
+func (a Args) Int64(i int) (int64, error) {
+	if i >= len(a) {
+		return 0, ErrInvalidData
+	}
+	return strconv.ParseInt(a[i], 10, 64)
+}
+
+func (a Args) Int(i int) (int, error) {
+	n, err := a.Int64(i)
+	return int(n), err
+}
+
+// Codec encodes a route and its arguments into signed button data, so users
+// can't craft callback queries. Arguments which don't fit the data are stored
+// in redis.
+type Codec struct {
+	secret []byte
+	redis  rs.RedisService
+}
+
+func NewCodec(secret string, redis rs.RedisService) *Codec {
+	return &Codec{secret: []byte(secret), redis: redis}
+}
+
+func (c *Codec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:SignatureLength]
+}
+
+func stateKey(key string) string {
+	return "callback:" + key
+}
+
+// Encode returns the data of a button for route, which must not contain the
+// separator ":". Arguments are formatted with fmt.Sprint.
+func (c *Codec) Encode(ctx context.Context, route string, args ...any) []byte {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, route)
+	fits := true
+	for _, arg := range args {
+		s := fmt.Sprint(arg)
+		if strings.Contains(s, separator) || strings.HasPrefix(s, statePrefix) {
+			fits = false
+		}
+		parts = append(parts, s)
+	}
+	payload := strings.Join(parts, separator)
+	if fits && len(payload)+len(separator)+SignatureLength <= MaxDataLength {
+		return []byte(payload + separator + c.sign(payload))
+	}
+
+	b := make([]byte, stateKeyBytes)
+	_, _ = rand.Read(b)
+	key := base64.RawURLEncoding.EncodeToString(b)
+	c.redis.Set(ctx, stateKey(key), parts[1:], time.Duration(StateTTLHours)*time.Hour)
+	payload = route + separator + statePrefix + key
+	return []byte(payload + separator + c.sign(payload))
+}
+
+// Decode verifies data and returns its route and arguments.
+func (c *Codec) Decode(ctx context.Context, data []byte) (string, Args, error) {
+	payload, signature, ok := cutLast(string(data), separator)
+	if !ok || !hmac.Equal([]byte(signature), []byte(c.sign(payload))) {
+		return "", nil, ErrInvalidData
+	}
+	parts := strings.Split(payload, separator)
+	route, args := parts[0], Args(parts[1:])
+	if len(args) != 1 || !strings.HasPrefix(args[0], statePrefix) {
+		return route, args, nil
+	}
+
+	cached := c.redis.Get(ctx, stateKey(strings.TrimPrefix(args[0], statePrefix)))
+	if len(cached) == 0 {
+		return "", nil, ErrExpired
+	}
+	var stored Args
+	if err := json.Unmarshal(cached, &stored); err != nil {
+		return "", nil, err
+	}
+	return route, stored, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return "", "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// Button returns an inline keyboard button pressing which calls route.
+func (c *Codec) Button(ctx context.Context, text, route string, args ...any) tg.KeyboardButtonClass {
+	return markup.Callback(text, c.Encode(ctx, route, args...))
+}
+
+// Query is a callback query sent by pressing a button of a message the bot
+// sent in a private chat.
+type Query struct {
+	Ctx      context.Context
+	Update   *tg.UpdateBotCallbackQuery
+	Peer     tg.InputPeerClass
+	api      *tg.Client
+	sender   *message.Sender
+	answered bool
+}
+
+func NewQuery(ctx context.Context, update *tg.UpdateBotCallbackQuery, peer tg.InputPeerClass,
+	api *tg.Client, sender *message.Sender,
+) *Query {
+	return &Query{Ctx: ctx, Update: update, Peer: peer, api: api, sender: sender}
+}
+
+func (q *Query) answer(text string, alert bool) error {
+	q.answered = true
+	_, err := q.api.MessagesSetBotCallbackAnswer(q.Ctx, &tg.MessagesSetBotCallbackAnswerRequest{
+		QueryID: q.Update.QueryID,
+		Message: text,
+		Alert:   alert,
+	})
+	return err
+}
+
+// Answer stops the loading animation of the pressed button and shows text as
+// a toast if it is not empty.
+func (q *Query) Answer(text string) error {
+	return q.answer(text, false)
+}
+
+// Alert answers with text in a dialog the user has to close.
+func (q *Query) Alert(text string) error {
+	return q.answer(text, true)
+}
+
+// Answered reports whether the query was answered.
+func (q *Query) Answered() bool {
+	return q.answered
+}
+
+// Edit replaces the message the button belongs to.
+func (q *Query) Edit(text string, keyboard tg.ReplyMarkupClass) error {
+	_, err := q.sender.To(q.Peer).Markup(keyboard).Edit(q.Update.MsgID).Text(q.Ctx, text)
+	return err
+}
+
+// Answerer is the part of a query the router needs, usually a *Query embedded
+// in the context type of the handlers.
+type Answerer interface {
+	Answer(text string) error
+	Answered() bool
+}
+
+// Handler handles the buttons of one route.
+type Handler[C Answerer] func(c C, args Args) error
+
+// Router calls the handler of the route of a pressed button. Queries the
+// handler didn't answer are answered after it returns.
+type Router[C Answerer] struct {
+	codec  *Codec
+	routes map[string]Handler[C]
+}
+
+func NewRouter[C Answerer](codec *Codec) *Router[C] {
+	r := &Router[C]{codec: codec, routes: make(map[string]Handler[C])}
+	r.Handle(NoopRoute, func(c C, args Args) error { return nil })
+	return r
+}
+
+// Handle registers h for route. It panics on invalid or duplicate routes, as
+// routes are registered once on start.
+func (r *Router[C]) Handle(route string, h Handler[C]) {
+	if route == "" || strings.Contains(route, separator) {
+		panic(fmt.Sprintf("callback: invalid route %q", route))
+	}
+	if _, ok := r.routes[route]; ok {
+		panic(fmt.Sprintf("callback: route %q registered twice", route))
+	}
+	r.routes[route] = h
+}
+
+func (r *Router[C]) Dispatch(ctx context.Context, c C, data []byte) error {
+	route, args, err := r.codec.Decode(ctx, data)
+	if err != nil {
+		return c.Answer("This button has expired, send the command again")
+	}
+	h, ok := r.routes[route]
+	if !ok {
+		return c.Answer("Unknown button")
+	}
+	err = h(c, args)
+	if !c.Answered() {
+		text := ""
+		if err != nil {
+			text = "Something went wrong, try again"
+		}
+		if err := c.Answer(text); err != nil {
+			slog.Error("Failed to answer callback", "route", route, "error", err)
+		}
+	}
+	return err
+}
+
+// Page is one page of a list shown with Prev and Next buttons.
+type Page struct {
+	// Index counts from zero.
+	Index int
+	Size  int
+	Total int64
+}
+
+// NewPage returns the page at index, moved into the range of pages.
+func NewPage(index, size int, total int64) Page {
+	p := Page{Index: index, Size: size, Total: total}
+	p.Index = max(0, min(index, p.Count()-1))
+	return p
+}
+
+// Count is the number of pages, at least one.
+func (p Page) Count() int {
+	return max(1, int((p.Total+int64(p.Size)-1)/int64(p.Size)))
+}
+
+// Offset is the number of items before the page.
+func (p Page) Offset() int {
+	return p.Index * p.Size
+}
+
+// NavRows returns the row of buttons moving between pages, or no rows if there
+// is one page. The index of the page to show is added as the last argument of
+// route.
+func (c *Codec) NavRows(ctx context.Context, p Page, route string, args ...any) []tg.KeyboardButtonRow {
+	if p.Count() <= 1 {
+		return nil
+	}
+	page := func(index int) []any {
+		return append(args[:len(args):len(args)], index)
+	}
+	var nav []tg.KeyboardButtonClass
+	if p.Index > 0 {
+		nav = append(nav, c.Button(ctx, "« Prev", route, page(p.Index-1)...))
+	}
+	nav = append(nav, c.Button(ctx, fmt.Sprintf("%d / %d", p.Index+1, p.Count()), NoopRoute))
+	if p.Index < p.Count()-1 {
+		nav = append(nav, c.Button(ctx, "Next »", route, page(p.Index+1)...))
+	}
+	return []tg.KeyboardButtonRow{markup.Row(nav...)}
+}
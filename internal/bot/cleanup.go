@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+)
+
+const (
+	FileCleanupIntervalMin int = 10
+	FileCleanupBatch       int = 100
+	// ExhaustedFileGraceMin leaves the last viewer of a self-destructing file
+	// time to finish watching it before it is deleted.
+	ExhaustedFileGraceMin int = 180
+)
+
+// StartFileCleanup periodically deletes the DB channel messages of files whose
+// link expired more than EXPIRED_FILE_GRACE_HOURS ago and marks them expired.
+// The grace period leaves the owner time to extend the expiry. Files which
+// self-destruct at their view limit are deleted ExhaustedFileGraceMin after
+// reaching it.
+func (w *Worker) StartFileCleanup() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(FileCleanupIntervalMin) * time.Minute)
+		defer ticker.Stop()
+		for {
+			w.cleanupFiles()
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (w *Worker) cleanupFiles() {
+	bot := w.DefaultBot()
+	if bot == nil || bot.Peers == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(w.ctx, time.Duration(FileCleanupIntervalMin)*time.Minute)
+	defer cancel()
+
+	grace := time.Duration(w.cfg.EXPIRED_FILE_GRACE_HOURS) * time.Hour
+	if files, err := w.fileService.GetExpired(ctx, time.Now().Add(-grace), FileCleanupBatch); err != nil {
+		slog.Error("Failed to get expired files", "error", err)
+	} else if removed := removeFiles(ctx, bot, files, w.fileService.MarkExpired); removed > 0 {
+		slog.Info("Removed expired files", "count", removed)
+	}
+
+	grace = time.Duration(ExhaustedFileGraceMin) * time.Minute
+	if files, err := w.fileService.GetExhausted(ctx, time.Now().Add(-grace), FileCleanupBatch); err != nil {
+		slog.Error("Failed to get exhausted files", "error", err)
+	} else if removed := removeFiles(ctx, bot, files, w.fileService.MarkExhausted); removed > 0 {
+		slog.Info("Removed files which reached their view limit", "count", removed)
+	}
+}
+
+// removeFiles deletes the DB channel messages of files and marks every
+// deleted one with mark. It returns the number of removed files.
+func removeFiles(ctx context.Context, bot *Bot, files []*repo.File, mark func(ctx context.Context, id int64) error) int {
+	byChannel := make(map[int64][]*repo.File)
+	for _, f := range files {
+		byChannel[f.ChannelID] = append(byChannel[f.ChannelID], f)
+	}
+	var removed int
+	for channelID, channelFiles := range byChannel {
+		ids := make([]int, 0, len(channelFiles))
+		for _, f := range channelFiles {
+			ids = append(ids, int(f.MessageID))
+		}
+		if err := botutils.DeleteChannelMessages(ctx, bot.Peers, channelID, ids...); err != nil {
+			slog.Error("Failed to delete files", "channel", channelID, "error", err)
+			continue
+		}
+		for _, f := range channelFiles {
+			if err := mark(ctx, f.ID); err != nil {
+				slog.Error("Failed to mark file removed", "id", f.ID, "error", err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed
+}
@@ -5,115 +5,13 @@ import (
 	"log/slog"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
+	"time"
 
 	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
-	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
-	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
 )
 
-func (bc *Context) HandleBroadcast(adminId int64) (tg.UpdatesClass, error) {
-	isAdmin := bc.userInfo.ID == adminId
-	if !isAdmin {
-		msg := "Only admin can use this command! :)"
-		return bc.Reply(msg)
-	}
-	replyedMessageHeader := bc.msg.ReplyTo
-	if replyedMessageHeader == nil {
-		return bc.Reply("Please reply to a message to broadcast it.")
-	}
-
-	var replyedMessageId int
-	switch replay := replyedMessageHeader.(type) {
-	case *tg.MessageReplyHeader:
-		replyedMessageId = replay.ReplyToMsgID
-	case *tg.MessageReplyStoryHeader:
-		return bc.Reply("can't broadcast story")
-	default:
-		return bc.Reply(fmt.Sprintf("can't broadcast! Unknown type: %T", replay))
-	}
-
-	users, err := bc.userService.GetAllUsers(bc.ctx)
-	if err != nil {
-		return bc.Reply(fmt.Sprintf("Failed to get users! Err : %s", err.Error()))
-	}
-
-	peerManager := peers.Options.Build(peers.Options{}, bc.client.API())
-	fromPeer, err := peerManager.ResolvePeer(bc.ctx, &tg.PeerUser{UserID: adminId})
-	if err != nil {
-		slog.Error("Failed to resolve peer", "error", err)
-		return bc.Reply(fmt.Sprintf("Failed to get users! Err : %s", err.Error()))
-	}
-	usersLen := len(users)
-
-	if usersLen == 0 {
-		return bc.Reply("No users found!")
-	}
-
-	wg := &sync.WaitGroup{}
-	var (
-		completedCounter atomic.Int32
-		failedCounter    atomic.Int32
-		userChan         = make(chan *repo.User)
-		workerCount      = min(usersLen, 3)
-	)
-	for idx := range workerCount {
-		slog.Info("Starting worker", "No. ", idx+1)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			botutils.BroadcastToUsers(bc.ctx,
-				userChan, replyedMessageId,
-				adminId, bc.client,
-				fromPeer, peerManager,
-				&completedCounter, &failedCounter)
-		}()
-	}
-
-	updateMsgText := fmt.Sprintf("Broadcasting to %d users", usersLen)
-	randomId, _ := bc.client.RandInt64()
-	updateMsg, err := bc.client.API().MessagesSendMessage(bc.ctx, &tg.MessagesSendMessageRequest{
-		Peer:     fromPeer.InputPeer(),
-		Message:  updateMsgText,
-		RandomID: randomId,
-	})
-	if err != nil {
-		return bc.Reply(fmt.Sprintf("Failed to send message! Err : %s", err.Error()))
-	}
-
-	updateMsgDetails, ok := updateMsg.(*tg.UpdateShortSentMessage)
-	if !ok {
-		return bc.Reply(fmt.Sprintf("Failed to cast to UpdateShortSentMessage! Got Type: %T", updateMsg))
-	}
-	updateMsgId := updateMsgDetails.ID
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(userChan)
-		for idx, user := range users {
-			userChan <- user
-			if idx > 0 && idx%30 == 0 {
-				msg := fmt.Sprintf("Completed %d, Failed %d", completedCounter.Load(), failedCounter.Load())
-				if _, err := bc.sender.To(fromPeer.InputPeer()).Edit(updateMsgId).Text(bc.ctx, msg); err != nil {
-					slog.Error("Failed to edit broadcast status message", "error", err)
-				}
-			}
-		}
-	}()
-
-	wg.Wait()
-	doneMsg := fmt.Sprintf("Done! Completed %d, Failed %d", completedCounter.Load(), failedCounter.Load())
-	return bc.sender.To(fromPeer.InputPeer()).Edit(updateMsgId).Text(bc.ctx, doneMsg)
-}
-
-func (bc *Context) HandleToggleBan(adminId int64, banStatus bool) (tg.UpdatesClass, error) {
-	if bc.userInfo.ID != adminId {
-		msg := "Only admin can use this command! :)"
-		return bc.Reply(msg)
-	}
+func (bc *Context) HandleToggleBan(banStatus bool) (tg.UpdatesClass, error) {
 	parts := strings.Split(bc.msg.Message, " ")
 	command := strings.Split(parts[0], "/")[1]
 	if len(parts) < 2 {
@@ -125,8 +23,8 @@ func (bc *Context) HandleToggleBan(adminId int64, banStatus bool) (tg.UpdatesCla
 		return bc.Reply(fmt.Sprintf("Failed to parse user id! Err : %s", err.Error()))
 	}
 
-	if targetId == adminId {
-		return bc.Reply(fmt.Sprintf("You can't %s admin!", command))
+	if bc.roleOf(targetId) >= bc.Role() {
+		return bc.Reply(fmt.Sprintf("You can't %s staff of your role or above!", command))
 	}
 	targetUser, err := bc.userService.GetUserByTgID(bc.ctx, targetId)
 	if err != nil {
@@ -139,7 +37,7 @@ func (bc *Context) HandleToggleBan(adminId int64, banStatus bool) (tg.UpdatesCla
 	if targetUser, err = bc.userService.UpdateUser(bc.ctx, targetUser); err != nil {
 		return bc.Reply(fmt.Sprintf("Failed to update user! Err : %s", err.Error()))
 	}
-	_, targetInputPeer, err := botutils.GetUserPeer(bc.client.API(), bc.ctx, targetUser.ID)
+	targetInputPeer, err := botutils.GetUserPeer(bc.peers, bc.ctx, targetUser.ID)
 	if err != nil {
 		if _, err := bc.Reply(fmt.Sprintf("Failed to get user peer! Err : %s", err.Error())); err != nil {
 			slog.Error("Failed to reply with error message", "error", err)
@@ -151,3 +49,78 @@ func (bc *Context) HandleToggleBan(adminId int64, banStatus bool) (tg.UpdatesCla
 	}
 	return bc.Reply(fmt.Sprintf("User %sed successfully!", command))
 }
+
+func (bc *Context) HandleAddBot() (tg.UpdatesClass, error) {
+	parts := strings.Fields(bc.msg.Message)
+	if len(parts) < 2 {
+		return bc.Reply("Please provide a bot token!\nUsage: /addbot <token>")
+	}
+
+	// the message holds a bot token, don't leave it in the chat history
+	if _, err := bc.client.API().MessagesDeleteMessages(bc.ctx, &tg.MessagesDeleteMessagesRequest{
+		Revoke: true,
+		ID:     []int{bc.msg.ID},
+	}); err != nil {
+		slog.Error("Failed to delete addbot message", "error", err)
+	}
+
+	username, err := bc.botManager.AddBot(bc.ctx, parts[1], bc.userInfo.ID)
+	if err != nil {
+		if username != "" {
+			return bc.sender.To(bc.inputPeer()).Text(bc.ctx, fmt.Sprintf("@%s started with a warning: %s", username, err.Error()))
+		}
+		return bc.sender.To(bc.inputPeer()).Text(bc.ctx, fmt.Sprintf("Failed to add bot! Err : %s", err.Error()))
+	}
+	return bc.sender.To(bc.inputPeer()).Text(bc.ctx, fmt.Sprintf("@%s added to the worker pool!", username))
+}
+
+func (bc *Context) HandleRemoveBot() (tg.UpdatesClass, error) {
+	parts := strings.Fields(bc.msg.Message)
+	if len(parts) < 2 {
+		return bc.Reply("Please provide a bot username!\nUsage: /removebot <username>")
+	}
+
+	status, err := bc.botManager.RemoveBot(bc.ctx, parts[1])
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to remove bot! Err : %s", err.Error()))
+	}
+	msg := fmt.Sprintf("%s is draining and will stop once its %d running stream(s) are done.", status.Username, status.Pressure)
+	if status.FromEnv {
+		msg += "\nIts token is in BOT_TOKENS, so it will start again on the next restart."
+	}
+	return bc.Reply(msg)
+}
+
+func (bc *Context) HandleListBots() (tg.UpdatesClass, error) {
+	statuses := bc.botManager.BotsStatus()
+	if len(statuses) == 0 {
+		return bc.Reply("No bots are running!")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Worker bots (%d):\n", len(statuses)))
+	for _, status := range statuses {
+		state := "🔴 down"
+		switch {
+		case status.Draining:
+			state = "⚪ draining"
+		case status.InRotation:
+			state = "🟢 up"
+		}
+		source := "db"
+		if status.FromEnv {
+			source = "env"
+		}
+		sb.WriteString(fmt.Sprintf("\n%s %s [%s] streams: %d", state, status.Username, source, status.Pressure))
+		if status.Default {
+			sb.WriteString(" (default)")
+		}
+		if status.Userbot {
+			sb.WriteString(" (userbot)")
+		}
+		if status.Cooldown > 0 {
+			sb.WriteString(fmt.Sprintf(" cooldown: %s", status.Cooldown.Round(time.Second)))
+		}
+	}
+	return bc.Reply(sb.String())
+}
@@ -0,0 +1,334 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	BatchMaxMessages int = 200
+	BatchStateTTLMin int = 10
+	MaxMessageLength int = 4096
+)
+
+// batchRange is the data of the batch dialog after the first message of the
+// range was forwarded.
+type batchRange struct {
+	ChannelID int64 `json:"channel_id"`
+	FirstID   int   `json:"first_id"`
+}
+
+const (
+	batchStepFirst = "first"
+	batchStepLast  = "last"
+)
+
+var batchDialog = &Dialog{
+	Name: "batch",
+	TTL:  time.Duration(BatchStateTTLMin) * time.Minute,
+	Steps: map[string]Step{
+		batchStepFirst: {Validate: validateForwardedPost, Handle: (*Context).batchFirst},
+		batchStepLast:  {Validate: validateForwardedPost, Handle: (*Context).batchLast},
+	},
+}
+
+func validateForwardedPost(bc *Context) error {
+	if _, _, ok := forwardedChannelPost(bc.msg); !ok {
+		return errors.New("Forward a message of the range from the channel.")
+	}
+	return nil
+}
+
+func (bc *Context) HandleBatch() (tg.UpdatesClass, error) {
+	if msg, ok := bc.hasCredits(1); !ok {
+		return bc.Reply(msg)
+	}
+	if err := bc.StartConversation(batchDialog, batchStepFirst, nil); err != nil {
+		return nil, err
+	}
+	return bc.Reply(fmt.Sprintf(
+		"Forward the first message of the range from the channel.\nI have to be a member of the channel and a batch can have up to %d messages.\n\nSend /cancel to stop.",
+		BatchMaxMessages,
+	))
+}
+
+func (bc *Context) batchFirst(conv *Conversation) (tg.UpdatesClass, error) {
+	channelID, postID, _ := forwardedChannelPost(bc.msg)
+	if err := conv.Next(batchStepLast, batchRange{ChannelID: channelID, FirstID: postID}); err != nil {
+		return nil, err
+	}
+	return bc.Reply("Now forward the last message of the range.")
+}
+
+func (bc *Context) batchLast(conv *Conversation) (tg.UpdatesClass, error) {
+	var state batchRange
+	if err := conv.Decode(&state); err != nil {
+		conv.End()
+		return nil, err
+	}
+	channelID, postID, _ := forwardedChannelPost(bc.msg)
+	if channelID != state.ChannelID {
+		return bc.Reply("The last message has to be from the same channel as the first one.")
+	}
+
+	first, last := min(state.FirstID, postID), max(state.FirstID, postID)
+	if last-first+1 > BatchMaxMessages {
+		return bc.Reply(fmt.Sprintf("A batch can have up to %d messages, this range has %d.", BatchMaxMessages, last-first+1))
+	}
+	conv.End()
+	return bc.batchFromChannel(channelID, first, last)
+}
+
+func forwardedChannelPost(m *tg.Message) (int64, int, bool) {
+	fwd, ok := m.GetFwdFrom()
+	if !ok || fwd.ChannelPost == 0 {
+		return 0, 0, false
+	}
+	fromID, ok := fwd.GetFromID()
+	if !ok {
+		return 0, 0, false
+	}
+	channel, ok := fromID.(*tg.PeerChannel)
+	if !ok {
+		return 0, 0, false
+	}
+	return channel.ChannelID, fwd.ChannelPost, true
+}
+
+func (bc *Context) batchFromChannel(channelID int64, first, last int) (tg.UpdatesClass, error) {
+	channel, err := botutils.GetChannelPeer(bc.peers, bc.ctx, channelID)
+	if err != nil {
+		slog.Error("Failed to get batch channel", "error", err)
+		return bc.Reply("I can't read this channel! Add me to it and try again.")
+	}
+	ids := make([]int, 0, last-first+1)
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+	msgs, err := botutils.GetChannelMessages(bc.ctx, channelID, ids, bc.peers)
+	if err != nil {
+		slog.Error("Failed to get batch messages", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to get the messages of the channel! Err : %s", err.Error()))
+	}
+	return bc.storeBatch(channel.InputPeer(), msgs, channel.VisibleName())
+}
+
+// AlbumCommand handles a media group the user sent.
+func AlbumCommand(msgs []*tg.Message) *Command {
+	return &Command{
+		Name:         "album",
+		Hidden:       true,
+		NeedsCredits: true,
+		Handler: func(bc *Context) (tg.UpdatesClass, error) {
+			return bc.HandleAlbum(msgs)
+		},
+	}
+}
+
+// HandleAlbum turns every file of a media group the user sent into one batch.
+func (bc *Context) HandleAlbum(msgs []*tg.Message) (tg.UpdatesClass, error) {
+	res, err := bc.storeBatch(bc.inputPeer(), msgs, fmt.Sprintf("Album of %d files", len(msgs)))
+	if err != nil || bc.userInfo.ID == bc.cfg.ADMIN_ID {
+		return res, err
+	}
+	ids := make([]int, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	if _, err := bc.client.API().MessagesDeleteMessages(bc.ctx, &tg.MessagesDeleteMessagesRequest{
+		Revoke: true,
+		ID:     ids,
+	}); err != nil {
+		slog.Error("Failed to delete user messages", "error", err)
+	}
+	return res, nil
+}
+
+// hasCredits reports whether the user has enough credits for the links of files,
+// with the message to send when they don't.
+func (bc *Context) hasCredits(files int) (string, bool) {
+	if !bc.cfg.REF {
+		return "", true
+	}
+	needed := max(bc.cfg.MIN_CREDITS_REQUIRED, int32(files)*bc.cfg.DECREMENT_CREDITS)
+	if bc.dbUser.Credit >= needed {
+		return "", true
+	}
+	return fmt.Sprintf("You need %d credits for %d files but you have %d credits.\nRefer users or wait for new credits.",
+		needed, files, bc.dbUser.Credit), false
+}
+
+// takeCredits takes the credits for the links of files, single files and
+// batches are charged alike.
+func (bc *Context) takeCredits(files int) error {
+	dbUser, err := bc.userService.DecrementCredits(bc.ctx, bc.userInfo.ID, int32(files)*bc.cfg.DECREMENT_CREDITS)
+	if err != nil {
+		slog.Error("Failed to decrement credit", "error", err)
+		bc.SendLogMessage(fmt.Sprintf("FAILURE: Failed to decrement credit for user %d: %v", bc.userInfo.ID, err))
+		return err
+	}
+	bc.dbUser = dbUser
+	return nil
+}
+
+// storeBatch forwards the files of msgs from fromPeer to the DB channel, saves
+// them as one collection and replies with its link and the link of each file.
+func (bc *Context) storeBatch(fromPeer tg.InputPeerClass, msgs []*tg.Message, title string) (tg.UpdatesClass, error) {
+	var media []*tg.Message
+	var files []*types.File
+	for _, m := range msgs {
+		if file, err := botutils.GetMediaFromMessage(m); err == nil {
+			media = append(media, m)
+			files = append(files, file)
+		}
+	}
+	if len(media) == 0 {
+		return bc.Reply("No files found in these messages!")
+	}
+	if msg, ok := bc.hasCredits(len(media)); !ok {
+		return bc.Reply(msg)
+	}
+	if _, err := bc.Reply(fmt.Sprintf("Generating links for %d files...", len(media))); err != nil {
+		slog.Error("Failed to send batch progress", "error", err)
+	}
+
+	dbChannel, err := botutils.GetChannelPeer(bc.peers, bc.ctx, bc.cfg.DB_CHANNEL_ID)
+	if err != nil {
+		slog.Error("Failed to get channel peer", "error", err)
+		return nil, err
+	}
+	ids := make([]int, 0, len(media))
+	for _, m := range media {
+		ids = append(ids, m.ID)
+	}
+	// a failed chunk still leaves the files forwarded before it
+	forwarded, err := botutils.ForwardMessages(bc.ctx, bc.client.API(), fromPeer, dbChannel.InputPeer(), ids)
+	if err != nil {
+		slog.Error("Failed to forward batch", "error", err)
+		bc.SendLogMessage(fmt.Sprintf("FAILURE: Failed to forward batch of user %d to DB channel: %v", bc.userInfo.ID, err))
+		if len(forwarded) == 0 {
+			return bc.Reply(fmt.Sprintf("Failed to save your files! Err : %s", err.Error()))
+		}
+	}
+
+	var saved []*repo.File
+	for i, m := range media {
+		messageID, ok := forwarded[m.ID]
+		if !ok {
+			continue
+		}
+		var expiresAt *time.Time
+		if ttl, ok := botutils.ExpiryFromCaption(m.Message); ok {
+			t := time.Now().Add(ttl)
+			expiresAt = &t
+		}
+		file := files[i]
+		f, err := bc.fileService.Create(bc.ctx, repo.CreateFileParams{
+			OwnerID:    bc.userInfo.ID,
+			ChannelID:  bc.cfg.DB_CHANNEL_ID,
+			MessageID:  int32(messageID),
+			DocumentID: file.Location.ID,
+			FileName:   file.FileName,
+			FileSize:   file.Size,
+			MimeType:   file.MimeType,
+			Hash:       botutils.MakeHashByFileInfo(file),
+			ExpiresAt:  filesvc.Timestamp(expiresAt),
+		})
+		if err != nil {
+			slog.Error("Failed to save file", "error", err)
+			continue
+		}
+		saved = append(saved, f)
+	}
+	if len(saved) == 0 {
+		return bc.Reply("Failed to save your files!")
+	}
+
+	fileIDs := make([]int64, 0, len(saved))
+	for _, f := range saved {
+		fileIDs = append(fileIDs, f.ID)
+	}
+	collection, err := bc.collectionService.Create(bc.ctx, bc.userInfo.ID, title, fileIDs)
+	if err != nil {
+		slog.Error("Failed to create collection", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to create the collection! Err : %s", err.Error()))
+	}
+
+	// the batch is saved already, a failure to take its credits is only logged
+	_ = bc.takeCredits(len(saved))
+	for range saved {
+		if _, err := bc.userService.IncrementTotalLinkCount(bc.ctx, bc.userInfo.ID); err != nil {
+			slog.Error("Failed to update user", "error", err)
+			break
+		}
+	}
+
+	collectionLink := botutils.GetCollectionPageLink(bc.cfg, collection.Slug)
+	msg := fmt.Sprintf("Your batch is ready! 🎉\n\nTitle: %s\nFiles: %d\nCollection ID: %d\n\nCollection: %s\nShare in Telegram: %s",
+		title, len(saved), collection.ID, collectionLink, botutils.GetCollectionLink(bc.botUsername, collection.Slug))
+	if len(saved) < len(media) {
+		msg += fmt.Sprintf("\n\n%d files could not be saved.", len(media)-len(saved))
+	}
+	if bc.cfg.REF && bc.dbUser != nil {
+		msg += fmt.Sprintf("\n\nYou have %d credits to use 😊", bc.dbUser.Credit)
+	}
+	btn := markup.InlineKeyboard(markup.Row(markup.URL("Open Collection", collectionLink)))
+	res, err := bc.sender.To(bc.inputPeer()).Markup(btn).Text(bc.ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	bc.sendFileLinks(saved)
+
+	logMsg := fmt.Sprintf("User: %s\nUserId: %d\n\nBatch: %s\nFiles: %d\nCollection: %s",
+		bc.userInfo.Username, bc.userInfo.ID, title, len(saved), collectionLink)
+	if _, err := bc.sender.To(dbChannel.InputPeer()).Text(bc.ctx, logMsg); err != nil {
+		slog.Error("Failed to send batch log", "error", err)
+	}
+	return res, nil
+}
+
+// sendFileLinks sends a numbered list of the files' links, split into as many
+// messages as needed.
+func (bc *Context) sendFileLinks(files []*repo.File) {
+	var entries []string
+	for i, f := range files {
+		link := botutils.GetStreamLink(bc.cfg, f.ChannelID, int(f.MessageID), f.Hash)
+		entries = append(entries, fmt.Sprintf("%d. %s (%s)\n%s", i+1, filesvc.Name(f), botutils.MakeSizeReadable(f.FileSize), link))
+	}
+	for _, text := range splitMessage(entries, MaxMessageLength) {
+		if _, err := bc.sender.To(bc.inputPeer()).NoWebpage().Text(bc.ctx, text); err != nil {
+			slog.Error("Failed to send file links", "error", err)
+			return
+		}
+	}
+}
+
+// splitMessage joins entries into texts of at most limit bytes.
+func splitMessage(entries []string, limit int) []string {
+	var texts []string
+	var b strings.Builder
+	for _, e := range entries {
+		if b.Len() > 0 && b.Len()+len(e)+2 > limit {
+			texts = append(texts, b.String())
+			b.Reset()
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(e)
+	}
+	if b.Len() > 0 {
+		texts = append(texts, b.String())
+	}
+	return texts
+}
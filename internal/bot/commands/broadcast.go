@@ -0,0 +1,312 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	broadcastsvc "github.com/biisal/fast-stream-bot/internal/service/broadcast"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	BroadcastListLimit  int = 5
+	BroadcastConfirmMin int = 10
+	// BroadcastTimeLayout is the layout of /broadcast at, in UTC.
+	BroadcastTimeLayout = "2006-01-02 15:04"
+)
+
+const broadcastUsage = `Reply to a message with /broadcast to send it to users.
+Usage: /broadcast [pin] [in <duration> | at <yyyy-mm-dd hh:mm>] [filters]
+
+Filters, every user matches without them:
+active:7d - used the bot in the last 7 days
+premium, verified
+credits:10-100, credits:10- or credits:-100
+joined:2025-01-31 - joined after the date
+lang:en - language of the user's app
+
+e.g. /broadcast pin in 2h active:30d lang:en
+Times are UTC, banned and deleted users never get broadcasts.`
+
+// broadcastDraft is the data of the broadcast dialog while the user confirms
+// how many users it reaches.
+type broadcastDraft struct {
+	MessageID int                  `json:"message_id"`
+	Pin       bool                 `json:"pin"`
+	SendAt    time.Time            `json:"send_at"`
+	Segment   broadcastsvc.Segment `json:"segment"`
+}
+
+const broadcastStepConfirm = "confirm"
+
+var broadcastDialog = &Dialog{
+	Name: "broadcast",
+	TTL:  time.Duration(BroadcastConfirmMin) * time.Minute,
+	Steps: map[string]Step{
+		broadcastStepConfirm: {Validate: validateConfirm, Handle: (*Context).broadcastConfirm},
+	},
+}
+
+func validateConfirm(bc *Context) error {
+	if strings.TrimSpace(bc.msg.Message) != "/confirm" {
+		return errors.New("Send /confirm to start the broadcast.")
+	}
+	return nil
+}
+
+func parseCredits(value string) (*int32, *int32, error) {
+	minArg, maxArg, ok := strings.Cut(value, "-")
+	if !ok || (minArg == "" && maxArg == "") {
+		return nil, nil, fmt.Errorf("invalid credit range %q, use e.g. credits:10-100", value)
+	}
+	parse := func(arg string) (*int32, error) {
+		if arg == "" {
+			return nil, nil
+		}
+		n, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credit range %q, use e.g. credits:10-100", value)
+		}
+		credits := int32(n)
+		return &credits, nil
+	}
+	minCredit, err := parse(minArg)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxCredit, err := parse(maxArg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if minCredit != nil && maxCredit != nil && *minCredit > *maxCredit {
+		return nil, nil, fmt.Errorf("invalid credit range %q, the minimum is above the maximum", value)
+	}
+	return minCredit, maxCredit, nil
+}
+
+// parseFilter adds a filter like active:7d to segment.
+func parseFilter(segment *broadcastsvc.Segment, arg string) error {
+	name, value, _ := strings.Cut(arg, ":")
+	switch strings.ToLower(name) {
+	case "premium":
+		segment.Premium = true
+	case "verified":
+		segment.Verified = true
+	case "active":
+		d, err := botutils.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		days := d.Hours() / 24
+		segment.ActiveDays = int32(days)
+		if float64(segment.ActiveDays) < days {
+			segment.ActiveDays++
+		}
+	case "credits":
+		var err error
+		if segment.MinCredit, segment.MaxCredit, err = parseCredits(value); err != nil {
+			return err
+		}
+	case "joined":
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, use yyyy-mm-dd", value)
+		}
+		segment.JoinedAfter = &t
+	case "lang":
+		if value == "" {
+			return errors.New("lang needs a language code, e.g. lang:en")
+		}
+		segment.Language = strings.ToLower(value)
+	default:
+		return fmt.Errorf("unknown option %q", arg)
+	}
+	return nil
+}
+
+func parseBroadcastOptions(draft *broadcastDraft, args []string) error {
+	draft.SendAt = time.Now()
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "pin":
+			draft.Pin = true
+		case "in":
+			if i+1 >= len(args) {
+				return errors.New("in needs a duration, e.g. in 2h")
+			}
+			d, err := botutils.ParseDuration(args[i+1])
+			if err != nil {
+				return err
+			}
+			draft.SendAt = time.Now().Add(d)
+			i++
+		case "at":
+			if i+2 >= len(args) {
+				return errors.New("at needs a date and a time, e.g. at 2025-01-31 18:30")
+			}
+			t, err := time.Parse(BroadcastTimeLayout, args[i+1]+" "+args[i+2])
+			if err != nil {
+				return fmt.Errorf("invalid time %q, use yyyy-mm-dd hh:mm", args[i+1]+" "+args[i+2])
+			}
+			if t.Before(time.Now()) {
+				return errors.New("that time has passed")
+			}
+			draft.SendAt = t
+			i += 2
+		default:
+			if err := parseFilter(&draft.Segment, args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleBroadcast counts the users the message the user replied to would
+// reach and asks to confirm the broadcast.
+func (bc *Context) HandleBroadcast() (tg.UpdatesClass, error) {
+	var draft broadcastDraft
+	switch replay := bc.msg.ReplyTo.(type) {
+	case *tg.MessageReplyHeader:
+		draft.MessageID = replay.ReplyToMsgID
+	case *tg.MessageReplyStoryHeader:
+		return bc.Reply("can't broadcast story")
+	default:
+		return bc.Reply(broadcastUsage)
+	}
+	if err := parseBroadcastOptions(&draft, strings.Fields(bc.msg.Message)[1:]); err != nil {
+		return bc.Reply(fmt.Sprintf("%s!\n\n%s", err.Error(), broadcastUsage))
+	}
+	count, err := bc.broadcastService.Count(bc.ctx, draft.Segment)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to count users! Err : %s", err.Error()))
+	}
+	if count == 0 {
+		return bc.Reply(fmt.Sprintf("No user matches %s!", draft.Segment))
+	}
+	if err := bc.StartConversation(broadcastDialog, broadcastStepConfirm, draft); err != nil {
+		return nil, err
+	}
+	return bc.Reply(fmt.Sprintf("This broadcast reaches %d users (%s) right now.\n\nSend /confirm to start it or /cancel to stop.", count, draft.Segment))
+}
+
+// broadcastConfirm stores the broadcast of the draft. The message is copied
+// to the DB channel, so it can still be sent after a restart and by any bot.
+func (bc *Context) broadcastConfirm(conv *Conversation) (tg.UpdatesClass, error) {
+	conv.End()
+	if !bc.Can(PermBroadcast) {
+		return bc.Reply("Your role doesn't allow this command! :)")
+	}
+	var draft broadcastDraft
+	if err := conv.Decode(&draft); err != nil {
+		return nil, err
+	}
+
+	dbChannel, err := botutils.GetChannelPeer(bc.peers, bc.ctx, bc.cfg.DB_CHANNEL_ID)
+	if err != nil {
+		slog.Error("Failed to get channel peer", "error", err)
+		return nil, err
+	}
+	forwarded, err := botutils.ForwardMessages(bc.ctx, bc.client.API(), bc.inputPeer(), dbChannel.InputPeer(), []int{draft.MessageID})
+	messageID, ok := forwarded[draft.MessageID]
+	if err != nil || !ok {
+		slog.Error("Failed to copy broadcast message", "error", err)
+		return bc.Reply("Failed to save the message! Try again.")
+	}
+	b, err := bc.broadcastService.Create(bc.ctx, bc.userInfo.ID, bc.cfg.DB_CHANNEL_ID, messageID, draft.Pin, draft.SendAt, draft.Segment)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to create broadcast! Err : %s", err.Error()))
+	}
+	msg := fmt.Sprintf("Broadcast #%d starts in a moment.", b.ID)
+	if time.Until(draft.SendAt) > time.Minute {
+		msg = fmt.Sprintf("Broadcast #%d scheduled for %s, it goes to the users matching then.", b.ID, draft.SendAt.UTC().Format(botutils.ExpiryLayout))
+	}
+	msg += fmt.Sprintf("\nSee its progress with /broadcast_status %d and stop it with /broadcast_cancel %d.", b.ID, b.ID)
+	return bc.Reply(msg)
+}
+
+func describeBroadcast(b *repo.Broadcast, counts *repo.CountDeliveriesRow) string {
+	text := fmt.Sprintf("Broadcast #%d: %s", b.ID, b.Status)
+	if b.Pin {
+		text += " (pinned)"
+	}
+	text += fmt.Sprintf("\nUsers: %s\nSend at: %s", broadcastsvc.DecodeSegment(b), b.SendAt.Time.Format(botutils.ExpiryLayout))
+	if b.Status == broadcastsvc.StatusScheduled {
+		return text
+	}
+	text += fmt.Sprintf("\nTotal: %d\nSent: %d\nFailed: %d\nBlocked or deleted: %d\nPending: %d",
+		b.Total, counts.Sent, counts.Failed, counts.Blocked, counts.Pending)
+	if b.FinishedAt.Valid {
+		text += fmt.Sprintf("\nFinished: %s", b.FinishedAt.Time.Format(botutils.ExpiryLayout))
+	}
+	return text
+}
+
+// HandleBroadcastStatus shows the progress of a broadcast, or lists the newest
+// ones without an id.
+func (bc *Context) HandleBroadcastStatus() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) < 2 {
+		broadcasts, err := bc.broadcastService.List(bc.ctx, BroadcastListLimit)
+		if err != nil {
+			return bc.Reply(fmt.Sprintf("Failed to get broadcasts! Err : %s", err.Error()))
+		}
+		if len(broadcasts) == 0 {
+			return bc.Reply("No broadcasts yet!")
+		}
+		lines := []string{"Latest broadcasts:"}
+		for _, b := range broadcasts {
+			lines = append(lines, fmt.Sprintf("#%d %s, send at %s", b.ID, b.Status, b.SendAt.Time.Format(botutils.ExpiryLayout)))
+		}
+		lines = append(lines, "\nSend /broadcast_status <id> for details.")
+		return bc.Reply(strings.Join(lines, "\n"))
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid broadcast id!")
+	}
+	b, err := bc.broadcastService.Get(bc.ctx, id)
+	if err != nil {
+		if errors.Is(err, types.ErrorNotFound) {
+			return bc.Reply("Broadcast not found!")
+		}
+		return bc.Reply(fmt.Sprintf("Failed to get broadcast! Err : %s", err.Error()))
+	}
+	counts, err := bc.broadcastService.Counts(bc.ctx, id)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to count deliveries! Err : %s", err.Error()))
+	}
+	return bc.Reply(describeBroadcast(b, counts))
+}
+
+// HandleBroadcastCancel stops a scheduled or running broadcast, users which
+// got it keep the message.
+func (bc *Context) HandleBroadcastCancel() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) < 2 {
+		return bc.Reply("Usage: /broadcast_cancel <broadcast id>")
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid broadcast id!")
+	}
+	b, err := bc.broadcastService.Cancel(bc.ctx, id)
+	if err != nil {
+		if errors.Is(err, types.ErrorNotFound) {
+			return bc.Reply("No scheduled or running broadcast with this id!")
+		}
+		return bc.Reply(fmt.Sprintf("Failed to cancel broadcast! Err : %s", err.Error()))
+	}
+	counts, err := bc.broadcastService.Counts(bc.ctx, id)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Broadcast #%d cancelled.", b.ID))
+	}
+	return bc.Reply(fmt.Sprintf("Broadcast #%d cancelled, %d users got it before.", b.ID, counts.Sent))
+}
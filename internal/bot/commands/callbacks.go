@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"github.com/biisal/fast-stream-bot/config"
+	"github.com/biisal/fast-stream-bot/internal/bot/callback"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/gotd/td/telegram/peers"
+)
+
+// CallbackContext is the state of a callback query sent by pressing an inline
+// keyboard button.
+type CallbackContext struct {
+	*callback.Query
+	peers       *peers.Manager
+	cfg         *config.Config
+	fileService filesvc.Service
+	redis       rs.RedisService
+	callbacks   *callback.Codec
+}
+
+func NewCallbackContext(query *callback.Query, peerManager *peers.Manager,
+	cfg *config.Config, fileService filesvc.Service, redis rs.RedisService, callbacks *callback.Codec,
+) *CallbackContext {
+	return &CallbackContext{query, peerManager, cfg, fileService, redis, callbacks}
+}
+
+// NewCallbackRouter returns the router of every button the bot sends.
+func NewCallbackRouter(callbacks *callback.Codec) *callback.Router[*CallbackContext] {
+	r := callback.NewRouter[*CallbackContext](callbacks)
+	r.Handle(routeFiles, (*CallbackContext).showPage)
+	r.Handle(routeFile, fileRoute((*CallbackContext).showFile))
+	r.Handle(routeFileDelete, fileRoute((*CallbackContext).confirmDelete))
+	r.Handle(routeFileDeleteOK, fileRoute((*CallbackContext).deleteFile))
+	r.Handle(routeFileRevoke, fileRoute((*CallbackContext).revokeFile))
+	r.Handle(routeFileRename, fileRoute((*CallbackContext).renameFile))
+	r.Handle(routeFilePassword, fileRoute((*CallbackContext).passwordFile))
+	r.Handle(routeForceSub, (*CallbackContext).recheckSubscription)
+	return r
+}
@@ -0,0 +1,347 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/biisal/fast-stream-bot/config"
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	chansvc "github.com/biisal/fast-stream-bot/internal/service/channel"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/biisal/fast-stream-bot/internal/service/user"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/constant"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	MaxCaptionLength int = 1024
+)
+
+// DefaultCaptionTemplate keeps the caption of a post as it is, the links are
+// added as buttons.
+const DefaultCaptionTemplate = "{caption}"
+
+const channelUsage = `Usage:
+/channel template <channel id> <template> - Set the caption of linked posts
+/channel template <channel id> default - Keep the original caption
+/channel on <channel id> - Resume linking new posts
+/channel off <channel id> - Pause linking new posts
+/channel remove <channel id> - Stop linking and forget the channel
+
+Templates can use {caption}, {file_name}, {file_size}, {watch_link} and {download_link}.`
+
+// HandleAddChannel registers a channel of the user for auto-linking. The
+// channel is given by username or id, or by replying to a post forwarded from
+// it. The bot has to be an admin which can edit posts.
+func (bc *Context) HandleAddChannel() (tg.UpdatesClass, error) {
+	channel, err := bc.channelFromMessage()
+	if err != nil {
+		slog.Error("Failed to resolve channel", "error", err)
+		return bc.Reply("Usage: /addchannel <@username or channel id>\nor reply /addchannel to a post forwarded from the channel.\n\nAdd me as an admin which can edit posts first.")
+	}
+	if !channel.IsBroadcast() {
+		return bc.Reply("This is not a channel!")
+	}
+	rights, ok := channel.AdminRights()
+	if !ok || !rights.EditMessages {
+		return bc.Reply(fmt.Sprintf("Make me an admin of %s which can edit posts first.", channel.VisibleName()))
+	}
+	if channel.NoForwards() {
+		return bc.Reply(fmt.Sprintf("%s restricts saving content, so I can't save its files.", channel.VisibleName()))
+	}
+	isAdmin, err := bc.isChannelAdmin(channel)
+	if err != nil {
+		slog.Error("Failed to get channel participant", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to check your rights in %s! Err : %s", channel.VisibleName(), err.Error()))
+	}
+	if !isAdmin {
+		return bc.Reply(fmt.Sprintf("Only admins of %s can add it!", channel.VisibleName()))
+	}
+
+	c, err := bc.channelService.Register(bc.ctx, channel.ID(), bc.userInfo.ID, channel.VisibleName())
+	if err != nil {
+		slog.Error("Failed to register channel", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to add the channel! Err : %s", err.Error()))
+	}
+	return bc.Reply(fmt.Sprintf("Added %s (ID %d).\nI will add Watch and Download buttons to every new file posted there.\n\n%s",
+		c.Title, c.ID, channelUsage))
+}
+
+func (bc *Context) channelFromMessage() (*peers.Channel, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) >= 2 {
+		return bc.resolveChannel(args[1])
+	}
+
+	reply, ok := bc.msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok {
+		return nil, errors.New("no channel given")
+	}
+	res, err := bc.client.API().MessagesGetMessages(bc.ctx, []tg.InputMessageClass{
+		&tg.InputMessageID{ID: reply.ReplyToMsgID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	modified, ok := res.AsModified()
+	if !ok || len(modified.GetMessages()) == 0 {
+		return nil, errors.New("replied message not found")
+	}
+	m, ok := modified.GetMessages()[0].(*tg.Message)
+	if !ok {
+		return nil, errors.New("replied message not found")
+	}
+	channelID, _, ok := forwardedChannelPost(m)
+	if !ok {
+		return nil, errors.New("replied message is not forwarded from a channel")
+	}
+	return botutils.GetChannelPeer(bc.peers, bc.ctx, channelID)
+}
+
+// resolveChannel finds a channel by @username or id, with or without the -100
+// prefix.
+func (bc *Context) resolveChannel(arg string) (*peers.Channel, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		if id < 0 {
+			id = constant.TDLibPeerID(id).ToPlain()
+		}
+		return botutils.GetChannelPeer(bc.peers, bc.ctx, id)
+	}
+	peer, err := bc.peers.Resolve(bc.ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	channel, ok := peer.(peers.Channel)
+	if !ok {
+		return nil, errors.New("not a channel")
+	}
+	return &channel, nil
+}
+
+func (bc *Context) isChannelAdmin(channel *peers.Channel) (bool, error) {
+	res, err := bc.client.API().ChannelsGetParticipant(bc.ctx, &tg.ChannelsGetParticipantRequest{
+		Channel:     channel.InputChannel(),
+		Participant: bc.inputPeer(),
+	})
+	if err != nil {
+		return false, err
+	}
+	switch res.Participant.(type) {
+	case *tg.ChannelParticipantCreator, *tg.ChannelParticipantAdmin:
+		return true, nil
+	}
+	return false, nil
+}
+
+// HandleChannels lists the channels the user registered.
+func (bc *Context) HandleChannels() (tg.UpdatesClass, error) {
+	channels, err := bc.channelService.ListByOwner(bc.ctx, bc.userInfo.ID)
+	if err != nil {
+		slog.Error("Failed to list channels", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to get your channels! Err : %s", err.Error()))
+	}
+	if len(channels) == 0 {
+		return bc.Reply("You haven't added any channels yet.\nAdd one with /addchannel.")
+	}
+	entries := []string{"Your channels:"}
+	for _, c := range channels {
+		status := "on"
+		if !c.Enabled {
+			status = "off"
+		}
+		template := c.CaptionTemplate
+		if template == "" {
+			template = DefaultCaptionTemplate
+		}
+		entries = append(entries, fmt.Sprintf("ID %d: %s (%s)\nTemplate: %s", c.ID, c.Title, status, template))
+	}
+	for _, text := range splitMessage(entries, MaxMessageLength) {
+		if _, err := bc.Reply(text); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// HandleChannel changes the settings of a channel, see channelUsage.
+func (bc *Context) HandleChannel() (tg.UpdatesClass, error) {
+	// the template may span several lines, so only the first line is split
+	firstLine, rest, _ := strings.Cut(bc.msg.Message, "\n")
+	args := strings.Fields(firstLine)
+	if len(args) < 3 {
+		return bc.Reply(channelUsage)
+	}
+	channelID, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid channel id!")
+	}
+	c, err := bc.channelService.Owned(bc.ctx, channelID, bc.userInfo.ID, bc.Can(PermFiles))
+	if err != nil {
+		return bc.channelCommandError(err)
+	}
+
+	switch args[1] {
+	case "template":
+		template := strings.TrimSpace(strings.Join(args[3:], " ") + "\n" + rest)
+		if template == "" {
+			return bc.Reply(channelUsage)
+		}
+		if template == "default" {
+			template = ""
+		}
+		if _, err := bc.channelService.SetTemplate(bc.ctx, c.ID, template); err != nil {
+			return bc.channelCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Updated the caption template of %s.", c.Title))
+	case "on", "off":
+		if _, err := bc.channelService.SetEnabled(bc.ctx, c.ID, args[1] == "on"); err != nil {
+			return bc.channelCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Linking new posts of %s is %s now.", c.Title, args[1]))
+	case "remove":
+		if err := bc.channelService.Delete(bc.ctx, c.ID); err != nil {
+			return bc.channelCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Removed %s. Links of its earlier posts still work.", c.Title))
+	}
+	return bc.Reply(channelUsage)
+}
+
+func (bc *Context) channelCommandError(err error) (tg.UpdatesClass, error) {
+	switch {
+	case errors.Is(err, types.ErrorNotFound):
+		return bc.Reply("Channel not found! Add it with /addchannel first.")
+	case errors.Is(err, chansvc.ErrNotOwner):
+		return bc.Reply("You can only change your own channels!")
+	}
+	slog.Error("Failed to update channel", "error", err)
+	return bc.Reply(fmt.Sprintf("Failed to update the channel! Err : %s", err.Error()))
+}
+
+// ChannelPostContext is the state of a new post in a channel registered for
+// auto-linking.
+type ChannelPostContext struct {
+	ctx         context.Context
+	msg         *tg.Message
+	channel     *repo.Channel
+	api         *tg.Client
+	peers       *peers.Manager
+	cfg         *config.Config
+	userService user.Service
+	fileService filesvc.Service
+}
+
+func NewChannelPostContext(ctx context.Context, msg *tg.Message, channel *repo.Channel,
+	api *tg.Client, peerManager *peers.Manager, cfg *config.Config,
+	userService user.Service, fileService filesvc.Service,
+) *ChannelPostContext {
+	return &ChannelPostContext{ctx, msg, channel, api, peerManager, cfg, userService, fileService}
+}
+
+// HandleChannelPost saves the file of the post to the DB channel and edits the
+// post to show its links. Files are charged to the owner of the channel.
+func (pc *ChannelPostContext) HandleChannelPost() error {
+	file, err := botutils.GetMediaFromMessage(pc.msg)
+	if err != nil {
+		return nil
+	}
+	owner, err := pc.userService.GetUserByTgID(pc.ctx, pc.channel.OwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to get owner of channel %d: %w", pc.channel.ID, err)
+	}
+	if owner.IsBanned {
+		return nil
+	}
+	if pc.cfg.REF && owner.Credit < max(pc.cfg.MIN_CREDITS_REQUIRED, pc.cfg.DECREMENT_CREDITS) {
+		slog.Info("Channel owner is out of credits", "channel", pc.channel.ID, "owner", owner.ID)
+		return nil
+	}
+
+	channel, err := botutils.GetChannelPeer(pc.peers, pc.ctx, pc.channel.ID)
+	if err != nil {
+		return err
+	}
+	dbChannel, err := botutils.GetChannelPeer(pc.peers, pc.ctx, pc.cfg.DB_CHANNEL_ID)
+	if err != nil {
+		return err
+	}
+	forwarded, err := botutils.ForwardMessages(pc.ctx, pc.api, channel.InputPeer(), dbChannel.InputPeer(), []int{pc.msg.ID})
+	if err != nil {
+		return fmt.Errorf("failed to forward post of channel %d: %w", pc.channel.ID, err)
+	}
+	messageID, ok := forwarded[pc.msg.ID]
+	if !ok {
+		return fmt.Errorf("forwarded post of channel %d not found", pc.channel.ID)
+	}
+
+	hash := botutils.MakeHashByFileInfo(file)
+	if _, err := pc.fileService.Create(pc.ctx, repo.CreateFileParams{
+		OwnerID:    pc.channel.OwnerID,
+		ChannelID:  pc.cfg.DB_CHANNEL_ID,
+		MessageID:  int32(messageID),
+		DocumentID: file.Location.ID,
+		FileName:   file.FileName,
+		FileSize:   file.Size,
+		MimeType:   file.MimeType,
+		Hash:       hash,
+	}); err != nil {
+		slog.Error("Failed to save file", "error", err)
+	}
+	if pc.cfg.REF {
+		if _, err := pc.userService.DecrementCredits(pc.ctx, owner.ID, pc.cfg.DECREMENT_CREDITS); err != nil {
+			slog.Error("Failed to decrement credit", "error", err)
+		}
+	}
+	if _, err := pc.userService.IncrementTotalLinkCount(pc.ctx, owner.ID); err != nil {
+		slog.Error("Failed to update user", "error", err)
+	}
+
+	watchLink := botutils.GetStreamLink(pc.cfg, pc.cfg.DB_CHANNEL_ID, messageID, hash)
+	downloadLink := botutils.GetDownloadLink(pc.cfg, pc.cfg.DB_CHANNEL_ID, messageID, hash)
+	req := &tg.MessagesEditMessageRequest{
+		Peer: channel.InputPeer(),
+		ID:   pc.msg.ID,
+	}
+	req.SetReplyMarkup(markup.InlineKeyboard(markup.Row(
+		markup.URL("Watch", watchLink),
+		markup.URL("Download", downloadLink),
+	)))
+	// setting the caption drops its formatting, so it's only set when the
+	// template changes it
+	if caption := RenderCaption(pc.channel.CaptionTemplate, pc.msg.Message, file, watchLink, downloadLink); caption != pc.msg.Message {
+		req.SetMessage(caption)
+	}
+	if _, err := pc.api.MessagesEditMessage(pc.ctx, req); err != nil {
+		return fmt.Errorf("failed to edit post of channel %d: %w", pc.channel.ID, err)
+	}
+	return nil
+}
+
+// RenderCaption fills the placeholders of template, an empty template being
+// DefaultCaptionTemplate. The result is cut to the caption limit of Telegram.
+func RenderCaption(template, caption string, file *types.File, watchLink, downloadLink string) string {
+	if template == "" {
+		template = DefaultCaptionTemplate
+	}
+	rendered := strings.NewReplacer(
+		"{caption}", caption,
+		"{file_name}", file.FileName,
+		"{file_size}", botutils.MakeSizeReadable(file.Size),
+		"{watch_link}", watchLink,
+		"{download_link}", downloadLink,
+	).Replace(template)
+	rendered = strings.TrimSpace(rendered)
+	if utf8.RuneCountInString(rendered) > MaxCaptionLength {
+		rendered = string([]rune(rendered)[:MaxCaptionLength])
+	}
+	return rendered
+}
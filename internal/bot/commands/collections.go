@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	collsvc "github.com/biisal/fast-stream-bot/internal/service/collection"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	CollectionsListLimit int = 20
+)
+
+const collectionUsage = `Usage:
+/collection new <title> - Create a collection
+/collection add <collection id> <file id>... - Add files
+/collection remove <collection id> <file id>... - Remove files
+/collection move <collection id> <file id> <position> - Move a file
+/collection public <collection id> - Let anyone with the link open it
+/collection private <collection id> - Only you can open it in the bot
+/collection delete <collection id> - Delete the collection, not its files
+
+Use /myfiles to find the id of a file.`
+
+// HandleCollections lists the newest collections of the user.
+func (bc *Context) HandleCollections() (tg.UpdatesClass, error) {
+	collections, err := bc.collectionService.ListByOwner(bc.ctx, bc.userInfo.ID, CollectionsListLimit)
+	if err != nil {
+		slog.Error("Failed to list collections", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to get your collections! Err : %s", err.Error()))
+	}
+	if len(collections) == 0 {
+		return bc.Reply("You don't have any collections yet.\nCreate one with /collection new <title> or send an album.")
+	}
+	entries := []string{"Your collections:"}
+	for _, c := range collections {
+		visibility := "public"
+		if !c.IsPublic {
+			visibility = "private"
+		}
+		entries = append(entries, fmt.Sprintf("ID %d: %s (%d files, %s)\n%s",
+			c.ID, c.Title, c.FileCount, visibility, botutils.GetCollectionPageLink(bc.cfg, c.Slug)))
+	}
+	for _, text := range splitMessage(entries, MaxMessageLength) {
+		if _, err := bc.sender.To(bc.inputPeer()).NoWebpage().Text(bc.ctx, text); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// HandleCollection creates and changes collections, see collectionUsage.
+func (bc *Context) HandleCollection() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) < 2 {
+		return bc.Reply(collectionUsage)
+	}
+	if args[1] == "new" {
+		title := strings.TrimSpace(strings.Join(args[2:], " "))
+		if title == "" {
+			return bc.Reply("Usage: /collection new <title>")
+		}
+		c, err := bc.collectionService.Create(bc.ctx, bc.userInfo.ID, title, nil)
+		if err != nil {
+			slog.Error("Failed to create collection", "error", err)
+			return bc.Reply(fmt.Sprintf("Failed to create the collection! Err : %s", err.Error()))
+		}
+		return bc.Reply(fmt.Sprintf("Created %s with ID %d.\nAdd files with /collection add %d <file id>...\n\nLink: %s",
+			c.Title, c.ID, c.ID, botutils.GetCollectionPageLink(bc.cfg, c.Slug)))
+	}
+
+	if len(args) < 3 {
+		return bc.Reply(collectionUsage)
+	}
+	ids, err := parseIDs(args[2:])
+	if err != nil {
+		return bc.Reply("Invalid id!")
+	}
+	c, err := bc.collectionService.Owned(bc.ctx, ids[0], bc.userInfo.ID, bc.Can(PermFiles))
+	if err != nil {
+		return bc.collectionCommandError(err)
+	}
+
+	switch {
+	case args[1] == "add" && len(ids) > 1:
+		for _, id := range ids[1:] {
+			f, err := bc.fileService.GetByID(bc.ctx, id)
+			if err != nil {
+				return bc.fileCommandError(err)
+			}
+			if f.OwnerID != bc.userInfo.ID && !bc.Can(PermFiles) {
+				return bc.fileCommandError(filesvc.ErrNotOwner)
+			}
+		}
+		if err := bc.collectionService.AddFiles(bc.ctx, c.ID, ids[1:]); err != nil {
+			return bc.collectionCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Added %d files to %s.", len(ids)-1, c.Title))
+	case args[1] == "remove" && len(ids) > 1:
+		if err := bc.collectionService.RemoveFiles(bc.ctx, c.ID, ids[1:]); err != nil {
+			return bc.collectionCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Removed %d files from %s.", len(ids)-1, c.Title))
+	case args[1] == "move" && len(ids) == 3:
+		if err := bc.collectionService.Move(bc.ctx, c.ID, ids[1], int(ids[2])-1); err != nil {
+			if errors.Is(err, types.ErrorNotFound) {
+				return bc.Reply("This file isn't in the collection!")
+			}
+			return bc.collectionCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Moved the file to position %d of %s.", ids[2], c.Title))
+	case (args[1] == "public" || args[1] == "private") && len(ids) == 1:
+		if _, err := bc.collectionService.SetPublic(bc.ctx, c.ID, args[1] == "public"); err != nil {
+			return bc.collectionCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("%s is %s now.", c.Title, args[1]))
+	case args[1] == "delete" && len(ids) == 1:
+		if err := bc.collectionService.Delete(bc.ctx, c.ID); err != nil {
+			return bc.collectionCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Deleted %s. Its files still work.", c.Title))
+	}
+	return bc.Reply(collectionUsage)
+}
+
+func parseIDs(args []string) ([]int64, error) {
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// collectionCommandError turns errors of owner-only collection changes into
+// replies.
+func (bc *Context) collectionCommandError(err error) (tg.UpdatesClass, error) {
+	switch {
+	case errors.Is(err, types.ErrorNotFound):
+		return bc.Reply("Collection not found!")
+	case errors.Is(err, collsvc.ErrNotOwner):
+		return bc.Reply("You can only change your own collections!")
+	}
+	slog.Error("Failed to update collection", "error", err)
+	return bc.Reply(fmt.Sprintf("Failed to update the collection! Err : %s", err.Error()))
+}
+
+// HandleOpenCollection sends the links of a collection opened with its deep
+// link, /start c_<slug>. Private collections only open for their owner.
+func (bc *Context) HandleOpenCollection(slug string) (tg.UpdatesClass, error) {
+	collection, err := bc.collectionService.GetBySlug(bc.ctx, slug)
+	if err != nil || (!collection.IsPublic && collection.OwnerID != bc.userInfo.ID) {
+		return bc.Reply("Collection not found!")
+	}
+	files, err := bc.collectionService.Files(bc.ctx, collection.ID)
+	if err != nil {
+		slog.Error("Failed to get collection files", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to get the collection! Err : %s", err.Error()))
+	}
+	var servable []*repo.File
+	for _, f := range files {
+		if filesvc.Servable(f) {
+			servable = append(servable, f)
+		}
+	}
+	if len(servable) == 0 {
+		return bc.Reply(fmt.Sprintf("%s has no files left.", collection.Title))
+	}
+	msg := fmt.Sprintf("%s\nFiles: %d", collection.Title, len(servable))
+	if collection.IsPublic {
+		msg += fmt.Sprintf("\n\nOpen in browser: %s", botutils.GetCollectionPageLink(bc.cfg, collection.Slug))
+	}
+	res, err := bc.Reply(msg)
+	if err != nil {
+		return nil, err
+	}
+	bc.sendFileLinks(servable)
+	return res, nil
+}
@@ -6,44 +6,79 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
-	"time"
 
 	"github.com/biisal/fast-stream-bot/config"
 	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/bot/callback"
 	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	adminsvc "github.com/biisal/fast-stream-bot/internal/service/admin"
+	broadcastsvc "github.com/biisal/fast-stream-bot/internal/service/broadcast"
+	chansvc "github.com/biisal/fast-stream-bot/internal/service/channel"
+	collsvc "github.com/biisal/fast-stream-bot/internal/service/collection"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	mirrorsvc "github.com/biisal/fast-stream-bot/internal/service/mirror"
+	ticketsvc "github.com/biisal/fast-stream-bot/internal/service/ticket"
 	"github.com/biisal/fast-stream-bot/internal/service/user"
+	"github.com/biisal/fast-stream-bot/internal/types"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
 )
 
 type Context struct {
-	ctx         context.Context
-	msg         *tg.Message
-	entities    tg.Entities
-	builder     *message.Builder
-	userInfo    *user.TgUser
-	dbUser      *repo.User
-	userService user.Service
-	sender      *message.Sender
-	client      *telegram.Client
-	cfg         *config.Config
-	botUsername string
+	ctx               context.Context
+	botCtx            context.Context // lives as long as the bot, for work outliving the update
+	msg               *tg.Message
+	entities          tg.Entities
+	builder           *message.Builder
+	userInfo          *user.TgUser
+	dbUser            *repo.User
+	userService       user.Service
+	fileService       filesvc.Service
+	collectionService collsvc.Service
+	channelService    chansvc.Service
+	mirrorService     mirrorsvc.Service
+	adminService      adminsvc.Service
+	broadcastService  broadcastsvc.Service
+	ticketService     ticketsvc.Service
+	redis             rs.RedisService
+	callbacks         *callback.Codec
+	registry          *Registry
+	sender            *message.Sender
+	client            *telegram.Client
+	peers             *peers.Manager
+	cfg               *config.Config
+	botUsername       string
+	botManager        BotManager
+}
+
+// BotManager starts and stops worker bots at runtime.
+type BotManager interface {
+	AddBot(ctx context.Context, token string, addedBy int64) (string, error)
+	RemoveBot(ctx context.Context, username string) (types.BotStatus, error)
+	BotsStatus() []types.BotStatus
 }
 
 func (bc *Context) Reply(msg string) (tg.UpdatesClass, error) {
 	return bc.builder.Text(bc.ctx, msg)
 }
 
-func NewContext(ctx context.Context, msg *tg.Message,
+func NewContext(ctx, botCtx context.Context, msg *tg.Message,
 	entities tg.Entities, builder *message.Builder,
-	client *telegram.Client, sender *message.Sender,
-	userInfo *user.TgUser, dbUser *repo.User, userService user.Service, cfg *config.Config, botUsername string,
+	client *telegram.Client, peerManager *peers.Manager, sender *message.Sender,
+	userInfo *user.TgUser, dbUser *repo.User, userService user.Service, fileService filesvc.Service,
+	collectionService collsvc.Service, channelService chansvc.Service, mirrorService mirrorsvc.Service,
+	adminService adminsvc.Service, broadcastService broadcastsvc.Service, ticketService ticketsvc.Service,
+	redis rs.RedisService, callbacks *callback.Codec, registry *Registry,
+	cfg *config.Config, botUsername string, botManager BotManager,
 ) *Context {
 	return &Context{
-		ctx, msg, entities, builder, userInfo,
-		dbUser, userService, sender, client, cfg, botUsername,
+		ctx, botCtx, msg, entities, builder, userInfo,
+		dbUser, userService, fileService, collectionService, channelService, mirrorService, adminService, broadcastService, ticketService, redis, callbacks, registry,
+		sender, client, peerManager, cfg, botUsername, botManager,
 	}
 }
 
@@ -53,21 +88,9 @@ const helpMsg = `Using this bot is easy!
 2. I’ll create a link for it.
 3. Open the link in your browser to stream or download the file instantly.`
 
-func (bc *Context) HandleSendCommandList(adminID int64) (tg.UpdatesClass, error) {
-	msg := `Available commands:
-/start - Start the bot
-/help - Get help
-/stat - Get your statistics
-/report - Replay a message to report to admin`
-
-	if bc.userInfo.ID == adminID {
-		msg += `/broadcast - Broadcast a message to all users
-
-"/ban - Ban a user
-"/unban - Unban a user`
-	}
-
-	return bc.Reply(msg)
+// HandleSendCommandList answers unknown commands.
+func (bc *Context) HandleSendCommandList() (tg.UpdatesClass, error) {
+	return bc.Reply(bc.registry.Help(bc.Role()))
 }
 
 func (bc *Context) HandleStart() (tg.UpdatesClass, error) {
@@ -95,49 +118,22 @@ Please don't send any sensitive adult content or any illegal content. Otherwise,
 	return bc.builder.Markup(keyboard).Text(bc.ctx, msg)
 }
 
-func (bc *Context) HandleHelp(adminID int64) (tg.UpdatesClass, error) {
-	commands := `Available commands:
-/start - Start the bot
-/help - Get help 
-/stat - Get your statistics
-`
-	if bc.userInfo.ID == adminID {
-		commands += `/broadcast - Broadcast a message to all users
-/ban - Ban a user 
-/unban - Unban a user`
-	}
-
-	fullMsg := fmt.Sprintf("%s\n\n%s", helpMsg, commands)
+func (bc *Context) HandleHelp() (tg.UpdatesClass, error) {
+	fullMsg := fmt.Sprintf("%s\n\n%s", helpMsg, bc.registry.Help(bc.Role()))
 	return bc.Reply(fullMsg)
 }
 
 func (b *Context) SendLogMessage(msg string) error {
-	return botutils.SendLogMessage(b.ctx, b.client.API(), b.sender, b.cfg.LOG_CHANNEL_ID, msg)
-}
-
-func (b *Context) SendMainChannrlInviteLink(ctx context.Context, builder *message.Builder) (tg.UpdatesClass, error) {
-	inviteLink, err := botutils.GetMainChannelInviteLink(ctx, b.client.API(), b.cfg)
-	if err != nil {
-		return nil, err
-	}
-	msg := `Due to server overload only our channel users can use this bot!
-Please join our channel and continue using this bot :)`
-	keyboard := markup.InlineKeyboard(
-		markup.Row(
-			markup.URL("Join Channel", inviteLink),
-		),
-	)
-
-	return builder.Markup(keyboard).Text(ctx, msg)
+	return botutils.SendLogMessage(b.ctx, b.peers, b.sender, b.cfg.LOG_CHANNEL_ID, msg)
 }
 
-func (bc *Context) HandleStat(adminID int64) (tg.UpdatesClass, error) {
+func (bc *Context) HandleStat() (tg.UpdatesClass, error) {
 	statMsg := fmt.Sprintf("Your statistics:\n\nTotal links: %d", bc.dbUser.TotalLinks)
 	if bc.cfg.REF {
 		statMsg += fmt.Sprintf("\nTotal credits: %d", bc.dbUser.Credit)
 	}
 
-	if bc.userInfo.ID == adminID {
+	if bc.Can(PermStats) {
 		totalUserCount, err := bc.userService.GetUsersCount(bc.ctx)
 		if err != nil {
 			slog.Error("Failed to get total users count", "error", err)
@@ -148,57 +144,6 @@ func (bc *Context) HandleStat(adminID int64) (tg.UpdatesClass, error) {
 	return bc.Reply(statMsg)
 }
 
-func (bc *Context) ForwardMsgToLogChannel(replyedMessageID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	_, inputPeer, err := botutils.GetChannelPeer(bc.client.API(), ctx, bc.cfg.LOG_CHANNEL_ID)
-	if err != nil {
-		return err
-	}
-
-	fromPeer := &tg.InputPeerUser{UserID: bc.userInfo.ID, AccessHash: bc.userInfo.AccessHash}
-	_, err = bc.sender.To(inputPeer.InputPeer()).ForwardIDs(fromPeer, replyedMessageID).Send(bc.ctx)
-	return err
-}
-
-func (bc *Context) HandleReport(adminId int64) (tg.UpdatesClass, error) {
-	if bc.userInfo.ID == adminId {
-		return bc.Reply("not for admin")
-	}
-	var replyedMessageId int
-	switch replay := bc.msg.ReplyTo.(type) {
-	case *tg.MessageReplyHeader:
-		replyedMessageId = replay.ReplyToMsgID
-	case *tg.MessageReplyStoryHeader:
-		return bc.Reply("can't report story")
-	default:
-		return bc.Reply("Reply a valid message to report")
-	}
-
-	fromPeer := &tg.InputPeerUser{UserID: bc.userInfo.ID, AccessHash: bc.userInfo.AccessHash}
-	_, adminPeer, err := botutils.GetUserPeer(bc.client.API(), bc.ctx, adminId)
-	if err != nil {
-		if err = bc.ForwardMsgToLogChannel(replyedMessageId); err != nil {
-			slog.Error("Failed to forward report message to log channel", "error", err)
-			return bc.Reply("Failed to report your messsage! please try again later")
-		}
-		return bc.Reply("Reported your message to admin")
-	}
-
-	randomID := time.Now().UnixNano()
-	_, err = bc.client.API().MessagesForwardMessages(bc.ctx, &tg.MessagesForwardMessagesRequest{
-		FromPeer:   fromPeer,
-		ToPeer:     adminPeer.InputPeer(),
-		ID:         []int{replyedMessageId},
-		RandomID:   []int64{randomID},
-		DropAuthor: false,
-	})
-	if err != nil {
-		if err = bc.ForwardMsgToLogChannel(replyedMessageId); err != nil {
-			slog.Error("Failed to forward report message to log channel", "error", err)
-			return bc.Reply("Failed to report your messsage! please try again later")
-		}
-		return bc.Reply("Reported your message to admin")
-	}
-	return bc.Reply("Reported your message to admin")
+func (bc *Context) inputPeer() *tg.InputPeerUser {
+	return &tg.InputPeerUser{UserID: bc.userInfo.ID, AccessHash: bc.userInfo.AccessHash}
 }
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/gotd/td/tg"
+)
+
+// Dialog is a conversation of several messages, e.g. /batch asking for the
+// first and the last message of a range. While a dialog runs every message of
+// the user goes to its current step, until the step ends it, the user sends
+// /cancel or the user doesn't answer within TTL.
+type Dialog struct {
+	Name  string
+	TTL   time.Duration
+	Steps map[string]Step
+}
+
+type Step struct {
+	// Validate checks the message before Handle. Its error is sent to the
+	// user, who stays in the step to try again.
+	Validate func(bc *Context) error
+	// Handle moves the conversation on with Next or End, without either the
+	// user stays in the step.
+	Handle func(bc *Context, conv *Conversation) (tg.UpdatesClass, error)
+}
+
+// Conversation is the running dialog of a user, kept in redis between the
+// messages.
+type Conversation struct {
+	Dialog string          `json:"dialog"`
+	Step   string          `json:"step"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	ended  bool
+}
+
+// Next moves the conversation to step and replaces its data.
+func (c *Conversation) Next(step string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c.Step, c.Data = step, raw
+	return nil
+}
+
+// End finishes the conversation after the step.
+func (c *Conversation) End() {
+	c.ended = true
+}
+
+// Decode reads the data of the conversation into v.
+func (c *Conversation) Decode(v any) error {
+	if len(c.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.Data, v)
+}
+
+func conversationKey(userID int64) string {
+	return fmt.Sprintf("conversation:%d", userID)
+}
+
+func (bc *Context) conversation() (*Conversation, bool) {
+	cached := bc.redis.Get(bc.ctx, conversationKey(bc.userInfo.ID))
+	if len(cached) == 0 {
+		return nil, false
+	}
+	var conv Conversation
+	if err := json.Unmarshal(cached, &conv); err != nil {
+		slog.Warn("Failed to unmarshal conversation", "error", err)
+		return nil, false
+	}
+	return &conv, true
+}
+
+func saveConversation(ctx context.Context, redis rs.RedisService, userID int64, d *Dialog, conv *Conversation) {
+	redis.Set(ctx, conversationKey(userID), conv, d.TTL)
+}
+
+func (bc *Context) saveConversation(d *Dialog, conv *Conversation) {
+	saveConversation(bc.ctx, bc.redis, bc.userInfo.ID, d, conv)
+}
+
+func (bc *Context) endConversation() {
+	bc.redis.Del(bc.ctx, conversationKey(bc.userInfo.ID))
+}
+
+// startConversation starts d at step for the user, replacing the dialog the
+// user was in.
+func startConversation(ctx context.Context, redis rs.RedisService, userID int64, d *Dialog, step string, data any) error {
+	if _, ok := d.Steps[step]; !ok {
+		return fmt.Errorf("dialog %s has no step %s", d.Name, step)
+	}
+	conv := &Conversation{Dialog: d.Name}
+	if err := conv.Next(step, data); err != nil {
+		return err
+	}
+	saveConversation(ctx, redis, userID, d, conv)
+	return nil
+}
+
+// StartConversation starts d at step, replacing the dialog the user was in.
+func (bc *Context) StartConversation(d *Dialog, step string, data any) error {
+	return startConversation(bc.ctx, bc.redis, bc.userInfo.ID, d, step, data)
+}
+
+// RegisterDialog adds a dialog users can be in. It panics on names used
+// twice, as dialogs are registered once on start.
+func (r *Registry) RegisterDialog(dialogs ...*Dialog) {
+	for _, d := range dialogs {
+		if _, ok := r.dialogs[d.Name]; ok {
+			panic(fmt.Sprintf("commands: dialog %q registered twice", d.Name))
+		}
+		r.dialogs[d.Name] = d
+	}
+}
+
+// Conversation returns the command running the current step of the user's
+// dialog, if the user is in one.
+func (r *Registry) Conversation(bc *Context) (*Command, bool) {
+	conv, ok := bc.conversation()
+	if !ok {
+		return nil, false
+	}
+	d, ok := r.dialogs[conv.Dialog]
+	if !ok {
+		bc.endConversation()
+		return nil, false
+	}
+	step, ok := d.Steps[conv.Step]
+	if !ok {
+		bc.endConversation()
+		return nil, false
+	}
+	return &Command{
+		Name:   d.Name + "." + conv.Step,
+		Hidden: true,
+		Handler: func(bc *Context) (tg.UpdatesClass, error) {
+			return runStep(bc, d, conv, step)
+		},
+	}, true
+}
+
+// isCancel reports whether word is /cancel, with the bot's name too as sent
+// in groups and from the menu.
+func isCancel(word string) bool {
+	name, _, _ := strings.Cut(word, "@")
+	return strings.ToLower(name) == "/cancel"
+}
+
+func runStep(bc *Context, d *Dialog, conv *Conversation, step Step) (tg.UpdatesClass, error) {
+	if fields := strings.Fields(bc.msg.Message); len(fields) > 0 && isCancel(fields[0]) {
+		bc.endConversation()
+		return bc.Reply("Cancelled.")
+	}
+	if step.Validate != nil {
+		if err := step.Validate(bc); err != nil {
+			bc.saveConversation(d, conv)
+			return bc.Reply(err.Error() + "\n\nSend /cancel to stop.")
+		}
+	}
+	res, err := step.Handle(bc, conv)
+	if conv.ended {
+		bc.endConversation()
+	} else {
+		bc.saveConversation(d, conv)
+	}
+	return res, err
+}
+
+// HandleCancel answers /cancel sent outside of a dialog, dialogs handle it
+// themselves.
+func (bc *Context) HandleCancel() (tg.UpdatesClass, error) {
+	return bc.Reply("There is nothing to cancel.")
+}
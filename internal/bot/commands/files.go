@@ -0,0 +1,511 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/bot/callback"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	FilesPageSize    int = 8
+	FileDialogTTLMin int = 10
+)
+
+const (
+	routeFiles        = "files"
+	routeFile         = "file"
+	routeFileDelete   = "filedel"
+	routeFileDeleteOK = "filedelok"
+	routeFileRevoke   = "filerevoke"
+	routeFileRename   = "filerename"
+	routeFilePassword = "filepassword"
+)
+
+// fileRoute parses the arguments of file buttons, the file id and the page
+// to go back to.
+func fileRoute(h func(cc *CallbackContext, id int64, page int) error) callback.Handler[*CallbackContext] {
+	return func(cc *CallbackContext, args callback.Args) error {
+		id, err := args.Int64(0)
+		if err != nil {
+			return cc.Answer("Invalid button")
+		}
+		page, err := args.Int(1)
+		if err != nil {
+			return cc.Answer("Invalid button")
+		}
+		return h(cc, id, page)
+	}
+}
+
+func (bc *Context) HandleMyFiles() (tg.UpdatesClass, error) {
+	text, keyboard, err := filesPage(bc.ctx, bc.fileService, bc.callbacks, bc.userInfo.ID, 0)
+	if err != nil {
+		slog.Error("Failed to list files", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to get your files! Err : %s", err.Error()))
+	}
+	if keyboard == nil {
+		return bc.Reply(text)
+	}
+	return bc.builder.Markup(keyboard).Text(bc.ctx, text)
+}
+
+// fileCommandError turns errors of owner-only file changes into replies.
+func (bc *Context) fileCommandError(err error) (tg.UpdatesClass, error) {
+	switch {
+	case errors.Is(err, types.ErrorNotFound):
+		return bc.Reply("File not found!")
+	case errors.Is(err, filesvc.ErrNotOwner):
+		return bc.Reply("You can only change your own files!")
+	case errors.Is(err, filesvc.ErrInvalidName):
+		return bc.Reply(fmt.Sprintf("Can't rename the file: %s.", err.Error()))
+	case errors.Is(err, filesvc.ErrInvalidPassword):
+		return bc.Reply(fmt.Sprintf("Can't set the password: %s.", err.Error()))
+	}
+	slog.Error("Failed to update file", "error", err)
+	return bc.Reply(fmt.Sprintf("Failed to update the file! Err : %s", err.Error()))
+}
+
+// HandleRevoke disables the link of a file: /revoke <file id>
+func (bc *Context) HandleRevoke() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) != 2 {
+		return bc.Reply("Usage: /revoke <file id>")
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid file id!")
+	}
+	f, err := bc.fileService.Revoke(bc.ctx, id, bc.userInfo.ID, bc.Can(PermFiles))
+	if err != nil {
+		return bc.fileCommandError(err)
+	}
+	return bc.Reply(fmt.Sprintf("The link of %s was revoked and no longer works.", filesvc.Name(f)))
+}
+
+// HandleExpire sets or removes the expiry of a file:
+// /expire <file id> <duration|never>
+func (bc *Context) HandleExpire() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) != 3 {
+		return bc.Reply("Usage: /expire <file id> <duration|never>\ne.g. /expire 12 7d")
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid file id!")
+	}
+	var expiresAt *time.Time
+	if !strings.EqualFold(args[2], "never") {
+		ttl, err := botutils.ParseDuration(args[2])
+		if err != nil {
+			return bc.Reply(err.Error())
+		}
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+	f, err := bc.fileService.SetExpiry(bc.ctx, id, bc.userInfo.ID, bc.Can(PermFiles), expiresAt)
+	if err != nil {
+		return bc.fileCommandError(err)
+	}
+	if expiresAt == nil {
+		return bc.Reply(fmt.Sprintf("The link of %s no longer expires.", filesvc.Name(f)))
+	}
+	return bc.Reply(fmt.Sprintf("The link of %s expires on %s.", filesvc.Name(f), expiresAt.Format(botutils.ExpiryLayout)))
+}
+
+// originalName restores the name Telegram has for the file when renaming.
+const originalName = "-"
+
+// HandleRename sets the name a file is shown and downloaded with:
+// /rename <file id> <name|->
+func (bc *Context) HandleRename() (tg.UpdatesClass, error) {
+	text := strings.TrimSpace(bc.msg.Message)
+	args := strings.Fields(text)
+	if len(args) < 3 {
+		return bc.Reply("Usage: /rename <file id> <name>\ne.g. /rename 12 Holiday 2024.mp4\nUse - as the name to restore the original one.")
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid file id!")
+	}
+	_, rest, _ := strings.Cut(text, args[0])
+	_, name, _ := strings.Cut(rest, args[1])
+	return bc.renameFile(id, name)
+}
+
+func (bc *Context) renameFile(id int64, name string) (tg.UpdatesClass, error) {
+	if strings.TrimSpace(name) == originalName {
+		name = ""
+	}
+	f, err := bc.fileService.Rename(bc.ctx, id, bc.userInfo.ID, bc.Can(PermFiles), name)
+	if err != nil {
+		return bc.fileCommandError(err)
+	}
+	return bc.Reply(fmt.Sprintf("The file is now named %s, its links didn't change.", filesvc.Name(f)))
+}
+
+// HandleLimit limits how often a file may be viewed:
+// /limit <file id> <views|off> [unique] [destroy]
+func (bc *Context) HandleLimit() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) < 3 {
+		return bc.Reply("Usage: /limit <file id> <views|off> [unique] [destroy]\ne.g. /limit 12 10 unique\n\nunique counts every viewer once, destroy deletes the file once the limit is reached.")
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid file id!")
+	}
+	var limit filesvc.Limit
+	if !strings.EqualFold(args[2], optionOff) {
+		if limit.Views, err = strconv.Atoi(args[2]); err != nil || limit.Views <= 0 {
+			return bc.Reply("The limit has to be a positive number of views!")
+		}
+	}
+	for _, opt := range args[3:] {
+		switch strings.ToLower(opt) {
+		case "unique":
+			limit.Unique = true
+		case "destroy":
+			limit.Destroy = true
+		default:
+			return bc.Reply(fmt.Sprintf("Unknown option %s, use unique or destroy.", opt))
+		}
+	}
+	f, err := bc.fileService.SetLimit(bc.ctx, id, bc.userInfo.ID, bc.Can(PermFiles), limit)
+	if err != nil {
+		return bc.fileCommandError(err)
+	}
+	if f.ViewLimit == 0 {
+		return bc.Reply(fmt.Sprintf("The links of %s no longer have a view limit.", filesvc.Name(f)))
+	}
+	msg := fmt.Sprintf("The links of %s now work for %s.", filesvc.Name(f), describeLimit(f))
+	if f.DestroyOnLimit {
+		msg += " The file is deleted once the limit is reached."
+	}
+	return bc.Reply(msg)
+}
+
+func describeLimit(f *repo.File) string {
+	if f.UniqueViews {
+		return fmt.Sprintf("%d viewers", f.ViewLimit)
+	}
+	return fmt.Sprintf("%d views", f.ViewLimit)
+}
+
+// optionOff removes the password or the view limit of a file.
+const optionOff = "off"
+
+// HandlePassword protects the links of a file with a password:
+// /password <file id> <password|off>
+func (bc *Context) HandlePassword() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) != 3 {
+		return bc.Reply("Usage: /password <file id> <password|off>\nPeople opening the link have to enter the password first.")
+	}
+	// the message has the password in it
+	bc.forgetMessage()
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid file id!")
+	}
+	return bc.setPassword(id, args[2], bc.Can(PermFiles))
+}
+
+func (bc *Context) setPassword(id int64, password string, isAdmin bool) (tg.UpdatesClass, error) {
+	if strings.EqualFold(password, optionOff) {
+		password = ""
+	}
+	f, err := bc.fileService.SetPassword(bc.ctx, id, bc.userInfo.ID, isAdmin, password)
+	return bc.passwordReply(f, err)
+}
+
+func (bc *Context) passwordReply(f *repo.File, err error) (tg.UpdatesClass, error) {
+	if err != nil {
+		return bc.fileCommandError(err)
+	}
+	if !filesvc.Protected(f) {
+		return bc.Reply(fmt.Sprintf("The links of %s no longer ask for a password.", filesvc.Name(f)))
+	}
+	return bc.Reply(fmt.Sprintf("The links of %s now ask for a password, share it with the people who may open them. I deleted your message with it.", filesvc.Name(f)))
+}
+
+// forgetMessage deletes the message the user sent, e.g. as it has a password
+// in it.
+func (bc *Context) forgetMessage() {
+	if _, err := bc.sender.To(bc.inputPeer()).Revoke().Messages(bc.ctx, bc.msg.ID); err != nil {
+		slog.Warn("Failed to delete message", "error", err)
+	}
+}
+
+// fileDialogState is the data of the dialogs started from /myfiles.
+type fileDialogState struct {
+	FileID int64 `json:"file_id"`
+}
+
+const renameStepName = "name"
+
+var renameDialog = &Dialog{
+	Name: "rename",
+	TTL:  time.Duration(FileDialogTTLMin) * time.Minute,
+	Steps: map[string]Step{
+		renameStepName: {Validate: validateName, Handle: (*Context).renameStep},
+	},
+}
+
+const passwordStepPassword = "password"
+
+var passwordDialog = &Dialog{
+	Name: "password",
+	TTL:  time.Duration(FileDialogTTLMin) * time.Minute,
+	Steps: map[string]Step{
+		passwordStepPassword: {Validate: validatePassword, Handle: (*Context).passwordStep},
+	},
+}
+
+func isText(bc *Context) bool {
+	return bc.msg.Media == nil && strings.TrimSpace(bc.msg.Message) != ""
+}
+
+func validateName(bc *Context) error {
+	if !isText(bc) {
+		return errors.New("Send the new name as a text message.")
+	}
+	return nil
+}
+
+func validatePassword(bc *Context) error {
+	if !isText(bc) {
+		return errors.New("Send the password as a text message.")
+	}
+	return nil
+}
+
+func (bc *Context) renameStep(conv *Conversation) (tg.UpdatesClass, error) {
+	var state fileDialogState
+	if err := conv.Decode(&state); err != nil {
+		conv.End()
+		return nil, err
+	}
+	name := bc.msg.Message
+	if strings.TrimSpace(name) == originalName {
+		name = ""
+	}
+	f, err := bc.fileService.Rename(bc.ctx, state.FileID, bc.userInfo.ID, false, name)
+	if errors.Is(err, filesvc.ErrInvalidName) {
+		return bc.Reply(fmt.Sprintf("Can't rename the file: %s.\n\nSend another name or /cancel to stop.", err.Error()))
+	}
+	conv.End()
+	if err != nil {
+		return bc.fileCommandError(err)
+	}
+	return bc.Reply(fmt.Sprintf("The file is now named %s, its links didn't change.\nSee /myfiles for your files.", filesvc.Name(f)))
+}
+
+func (bc *Context) passwordStep(conv *Conversation) (tg.UpdatesClass, error) {
+	var state fileDialogState
+	if err := conv.Decode(&state); err != nil {
+		conv.End()
+		return nil, err
+	}
+	bc.forgetMessage()
+	password := strings.TrimSpace(bc.msg.Message)
+	if strings.EqualFold(password, optionOff) {
+		password = ""
+	}
+	f, err := bc.fileService.SetPassword(bc.ctx, state.FileID, bc.userInfo.ID, false, password)
+	if errors.Is(err, filesvc.ErrInvalidPassword) {
+		return bc.Reply(fmt.Sprintf("Can't set the password: %s.\n\nSend another one or /cancel to stop.", err.Error()))
+	}
+	conv.End()
+	return bc.passwordReply(f, err)
+}
+
+func (cc *CallbackContext) showPage(args callback.Args) error {
+	page, err := args.Int(0)
+	if err != nil {
+		return cc.Answer("Invalid button")
+	}
+	return cc.showFilesPage(page)
+}
+
+func (cc *CallbackContext) showFilesPage(page int) error {
+	text, keyboard, err := filesPage(cc.Ctx, cc.fileService, cc.callbacks, cc.Update.UserID, page)
+	if err != nil {
+		slog.Error("Failed to list files", "error", err)
+		return cc.Answer("Failed to get your files!")
+	}
+	return cc.Edit(text, keyboard)
+}
+
+// ownFile returns the file if it exists and belongs to the user pressing the
+// button, otherwise it answers the callback and returns nil.
+func (cc *CallbackContext) ownFile(id int64) *repo.File {
+	f, err := cc.fileService.GetByID(cc.Ctx, id)
+	if err == nil && f.OwnerID == cc.Update.UserID && f.Status == filesvc.StatusActive {
+		return f
+	}
+	if err != nil && !errors.Is(err, types.ErrorNotFound) {
+		slog.Error("Failed to get file", "error", err)
+	}
+	if err := cc.Answer("File not found"); err != nil {
+		slog.Error("Failed to answer callback", "error", err)
+	}
+	return nil
+}
+
+func (cc *CallbackContext) showFile(id int64, page int) error {
+	f := cc.ownFile(id)
+	if f == nil {
+		return nil
+	}
+	link := botutils.GetStreamLink(cc.cfg, f.ChannelID, int(f.MessageID), f.Hash)
+	text := fmt.Sprintf("File ID: %d\nFile Name: %s\nFile Size: %s\nViews: %d\nUploaded: %s",
+		f.ID, filesvc.Name(f), botutils.MakeSizeReadable(f.FileSize), f.Views,
+		f.CreatedAt.Time.Format("02 Jan 2006"))
+	if f.ExpiresAt.Valid {
+		text += fmt.Sprintf("\nExpires: %s", f.ExpiresAt.Time.Format(botutils.ExpiryLayout))
+	}
+	if filesvc.Protected(f) {
+		text += "\nPassword: set"
+	}
+	if f.ViewLimit > 0 {
+		text += fmt.Sprintf("\nLimit: %d of %s used", f.Plays, describeLimit(f))
+		if f.DestroyOnLimit {
+			text += ", then deleted"
+		}
+	}
+	text += fmt.Sprintf("\n\nLink: %s", link)
+	keyboard := markup.InlineKeyboard(
+		markup.Row(markup.URL("Watch or Download", link)),
+		markup.Row(
+			cc.callbacks.Button(cc.Ctx, "⛔ Revoke", routeFileRevoke, f.ID, page),
+			cc.callbacks.Button(cc.Ctx, "🗑 Delete", routeFileDelete, f.ID, page),
+		),
+		markup.Row(
+			cc.callbacks.Button(cc.Ctx, "✏️ Rename", routeFileRename, f.ID, page),
+			cc.callbacks.Button(cc.Ctx, "🔒 Password", routeFilePassword, f.ID, page),
+		),
+		markup.Row(cc.callbacks.Button(cc.Ctx, "« Back", routeFiles, page)),
+	)
+	return cc.Edit(text, keyboard)
+}
+
+func (cc *CallbackContext) confirmDelete(id int64, page int) error {
+	f := cc.ownFile(id)
+	if f == nil {
+		return nil
+	}
+	text := fmt.Sprintf("Delete %s?\nIts link will stop working.", filesvc.Name(f))
+	keyboard := markup.InlineKeyboard(
+		markup.Row(
+			cc.callbacks.Button(cc.Ctx, "Yes, delete", routeFileDeleteOK, f.ID, page),
+			cc.callbacks.Button(cc.Ctx, "Cancel", routeFile, f.ID, page),
+		),
+	)
+	return cc.Edit(text, keyboard)
+}
+
+func (cc *CallbackContext) deleteFile(id int64, page int) error {
+	f, err := cc.fileService.Delete(cc.Ctx, id, cc.Update.UserID, false)
+	if err != nil {
+		if !errors.Is(err, types.ErrorNotFound) && !errors.Is(err, filesvc.ErrNotOwner) {
+			slog.Error("Failed to delete file", "error", err)
+			return cc.Answer("Failed to delete the file!")
+		}
+		return cc.Answer("File not found")
+	}
+	if err := botutils.DeleteChannelMessages(cc.Ctx, cc.peers, f.ChannelID, int(f.MessageID)); err != nil {
+		slog.Error("Failed to delete file message", "file_id", f.ID, "error", err)
+	}
+	if err := cc.Answer("File deleted"); err != nil {
+		slog.Error("Failed to answer callback", "error", err)
+	}
+	text, keyboard, err := filesPage(cc.Ctx, cc.fileService, cc.callbacks, cc.Update.UserID, page)
+	if err != nil {
+		return err
+	}
+	return cc.Edit(text, keyboard)
+}
+
+func (cc *CallbackContext) revokeFile(id int64, page int) error {
+	if _, err := cc.fileService.Revoke(cc.Ctx, id, cc.Update.UserID, false); err != nil {
+		if !errors.Is(err, types.ErrorNotFound) && !errors.Is(err, filesvc.ErrNotOwner) {
+			slog.Error("Failed to revoke file", "error", err)
+			return cc.Answer("Failed to revoke the link!")
+		}
+		return cc.Answer("File not found")
+	}
+	if err := cc.Answer("Link revoked"); err != nil {
+		slog.Error("Failed to answer callback", "error", err)
+	}
+	return cc.showFilesPage(page)
+}
+
+func (cc *CallbackContext) renameFile(id int64, page int) error {
+	f := cc.ownFile(id)
+	if f == nil {
+		return nil
+	}
+	err := startConversation(cc.Ctx, cc.redis, cc.Update.UserID, renameDialog, renameStepName, fileDialogState{FileID: f.ID})
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Send me the new name of %s.\nWithout an extension it keeps %q. Send - to restore the original name or /cancel to stop.",
+		filesvc.Name(f), path.Ext(f.FileName))
+	return cc.Edit(text, nil)
+}
+
+func (cc *CallbackContext) passwordFile(id int64, page int) error {
+	f := cc.ownFile(id)
+	if f == nil {
+		return nil
+	}
+	err := startConversation(cc.Ctx, cc.redis, cc.Update.UserID, passwordDialog, passwordStepPassword, fileDialogState{FileID: f.ID})
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Send me the password for the links of %s, I'll delete your message right after.\nSend off to remove the password or /cancel to stop.",
+		filesvc.Name(f))
+	return cc.Edit(text, nil)
+}
+
+// filesPage renders one page of the user's files. The keyboard is nil when the
+// user has no files.
+func filesPage(ctx context.Context, fileService filesvc.Service, callbacks *callback.Codec,
+	userID int64, index int,
+) (string, tg.ReplyMarkupClass, error) {
+	index = max(index, 0)
+	files, total, err := fileService.ListByOwner(ctx, userID, index, FilesPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return "You have no files yet. Send me a file to get a link!", nil, nil
+	}
+	page := callback.NewPage(index, FilesPageSize, total)
+	if page.Index != index {
+		return filesPage(ctx, fileService, callbacks, userID, page.Index)
+	}
+
+	var rows []tg.KeyboardButtonRow
+	for _, f := range files {
+		label := fmt.Sprintf("📄 %s · %s", filesvc.Name(f), botutils.MakeSizeReadable(f.FileSize))
+		rows = append(rows, markup.Row(callbacks.Button(ctx, label, routeFile, f.ID, page.Index)))
+	}
+	rows = append(rows, callbacks.NavRows(ctx, page, routeFiles)...)
+
+	text := fmt.Sprintf("Your files (%d)\nPage %d of %d", total, page.Index+1, page.Count())
+	return text, markup.InlineKeyboard(rows...), nil
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/biisal/fast-stream-bot/config"
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/bot/callback"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+)
+
+const routeForceSub = "fsub"
+
+const forceSubMsg = `Due to server overload only our channel users can use this bot!
+Please join our channels and press "I've joined" to continue using this bot :)`
+
+// CheckSubscription refuses commands of users who didn't join every channel of
+// FORCE_SUB_CHANNELS and FORCE_SUB_REQUEST_CHANNELS. Staff and premium users
+// don't have to join.
+func CheckSubscription(cmd *Command, next Handler) Handler {
+	return func(bc *Context) (tg.UpdatesClass, error) {
+		if len(bc.cfg.ForceSubChannels()) == 0 || bc.dbUser.IsPremium || bc.Role() > RoleUser {
+			return next(bc)
+		}
+		missing := missingChannels(bc.ctx, bc.peers, bc.cfg, bc.redis, bc.inputPeer())
+		if len(missing) == 0 {
+			return next(bc)
+		}
+		return bc.builder.Markup(forceSubKeyboard(bc.ctx, bc.peers, bc.cfg, bc.callbacks, missing)).Text(bc.ctx, forceSubMsg)
+	}
+}
+
+// missingChannels returns the force-subscribe channels a user didn't join
+// yet. Pending requests to join request channels are approved on the way, so
+// requests sent while the bot was down don't lock the user out.
+func missingChannels(ctx context.Context, peerManager *peers.Manager, cfg *config.Config,
+	redis rs.RedisService, user *tg.InputPeerUser,
+) []int64 {
+	var missing []int64
+	for _, channelID := range cfg.ForceSubChannels() {
+		if botutils.CheckUserInChannel(ctx, peerManager, channelID, user, redis) {
+			continue
+		}
+		if cfg.IsForceSubRequestChannel(channelID) {
+			inputUser := &tg.InputUser{UserID: user.UserID, AccessHash: user.AccessHash}
+			approved, err := botutils.ApproveJoinRequest(ctx, peerManager, channelID, inputUser)
+			if err != nil {
+				slog.Error("Failed to approve join request", "channel", channelID, "user", user.UserID, "error", err)
+			}
+			if approved {
+				continue
+			}
+		}
+		missing = append(missing, channelID)
+	}
+	return missing
+}
+
+// forceSubKeyboard links the channels a user has to join and asks to check
+// again once they did.
+func forceSubKeyboard(ctx context.Context, peerManager *peers.Manager, cfg *config.Config,
+	callbacks *callback.Codec, missing []int64,
+) tg.ReplyMarkupClass {
+	var rows []tg.KeyboardButtonRow
+	for i, channelID := range missing {
+		isRequest := cfg.IsForceSubRequestChannel(channelID)
+		link, err := botutils.GetChannelInviteLink(ctx, peerManager, channelID, isRequest)
+		if err != nil {
+			slog.Error("Failed to get channel invite link", "channel", channelID, "error", err)
+			continue
+		}
+		text := "Join Channel"
+		if isRequest {
+			text = "Request to Join"
+		}
+		if len(missing) > 1 {
+			text = fmt.Sprintf("%s %d", text, i+1)
+		}
+		rows = append(rows, markup.Row(markup.URL(text, link)))
+	}
+	rows = append(rows, markup.Row(callbacks.Button(ctx, "I've joined ✅", routeForceSub)))
+	return markup.InlineKeyboard(rows...)
+}
+
+// recheckSubscription answers the "I've joined" button of the force-subscribe
+// message.
+func (cc *CallbackContext) recheckSubscription(args callback.Args) error {
+	user, ok := cc.Peer.(*tg.InputPeerUser)
+	if !ok {
+		return cc.Answer("Invalid button")
+	}
+	missing := missingChannels(cc.Ctx, cc.peers, cc.cfg, cc.redis, user)
+	if len(missing) > 0 {
+		return cc.Alert(fmt.Sprintf("You haven't joined %d of our channels yet!", len(missing)))
+	}
+	return cc.Edit("Thanks for joining! Send your file or command again :)", nil)
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/biisal/fast-stream-bot/config"
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	InlineResultsLimit int = 20
+	// InlineCacheTimeSec is how long Telegram caches the results of a query.
+	// Results are private, so the cache is per user.
+	InlineCacheTimeSec int = 30
+)
+
+// InlineContext is the state of an inline query, sent by typing the bot's
+// username in any chat.
+type InlineContext struct {
+	ctx         context.Context
+	query       *tg.UpdateBotInlineQuery
+	api         *tg.Client
+	cfg         *config.Config
+	fileService filesvc.Service
+}
+
+func NewInlineContext(ctx context.Context, query *tg.UpdateBotInlineQuery,
+	api *tg.Client, cfg *config.Config, fileService filesvc.Service,
+) *InlineContext {
+	return &InlineContext{ctx, query, api, cfg, fileService}
+}
+
+// HandleInlineQuery searches the user's files by name. The offset of the query
+// is the number of results already shown.
+func (ic *InlineContext) HandleInlineQuery() error {
+	offset, err := strconv.Atoi(ic.query.Offset)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	files, err := ic.fileService.Search(ic.ctx, ic.query.UserID, strings.TrimSpace(ic.query.Query), offset, InlineResultsLimit)
+	if err != nil {
+		slog.Error("Failed to search files", "error", err)
+		return ic.answer(nil, "")
+	}
+
+	results := make([]tg.InputBotInlineResultClass, 0, len(files))
+	for _, f := range files {
+		results = append(results, ic.fileResult(f))
+	}
+	var nextOffset string
+	if len(files) == InlineResultsLimit {
+		nextOffset = strconv.Itoa(offset + len(files))
+	}
+	return ic.answer(results, nextOffset)
+}
+
+// Answer sends no results, e.g. to users who are banned.
+func (ic *InlineContext) Answer() error {
+	return ic.answer(nil, "")
+}
+
+func (ic *InlineContext) answer(results []tg.InputBotInlineResultClass, nextOffset string) error {
+	req := &tg.MessagesSetInlineBotResultsRequest{
+		QueryID:    ic.query.QueryID,
+		Results:    results,
+		CacheTime:  InlineCacheTimeSec,
+		Private:    true,
+		NextOffset: nextOffset,
+	}
+	if len(results) == 0 && ic.query.Offset == "" {
+		req.SetSwitchPm(tg.InlineBotSwitchPM{Text: "No files found, send me a file", StartParam: "inline"})
+	}
+	_, err := ic.api.MessagesSetInlineBotResults(ic.ctx, req)
+	return err
+}
+
+func (ic *InlineContext) fileResult(f *repo.File) tg.InputBotInlineResultClass {
+	watchLink := botutils.GetStreamLink(ic.cfg, f.ChannelID, int(f.MessageID), f.Hash)
+	downloadLink := botutils.GetDownloadLink(ic.cfg, f.ChannelID, int(f.MessageID), f.Hash)
+	size := botutils.MakeSizeReadable(f.FileSize)
+	text := fmt.Sprintf("File Name: %s\nFile Size: %s\n\nLink: %s", filesvc.Name(f), size, watchLink)
+	keyboard := markup.InlineKeyboard(markup.Row(
+		markup.URL("Watch", watchLink),
+		markup.URL("Download", downloadLink),
+	))
+
+	result := &tg.InputBotInlineResult{
+		ID:    strconv.FormatInt(f.ID, 10),
+		Type:  "article",
+		Title: filesvc.Name(f),
+		SendMessage: &tg.InputBotInlineMessageText{
+			Message:     text,
+			ReplyMarkup: keyboard,
+		},
+	}
+	result.SetDescription(fmt.Sprintf("%s • %d views", size, f.Views))
+	result.SetURL(watchLink)
+	result.SetThumb(tg.InputWebDocument{
+		URL:        botutils.GetThumbLink(ic.cfg, f.ChannelID, int(f.MessageID), f.Hash),
+		MimeType:   "image/jpeg",
+		Attributes: []tg.DocumentAttributeClass{},
+	})
+	return result
+}
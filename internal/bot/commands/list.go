@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	CommandRateLimit     int = 20
+	CommandRateWindowSec int = 60
+)
+
+// startCommand greets the user and opens deep links like /start c_<slug>.
+// Referral links are handled when the user is created.
+var startCommand = &Command{
+	Name:        "start",
+	Description: "Start the bot",
+	Handler: func(bc *Context) (tg.UpdatesClass, error) {
+		_, arg, _ := strings.Cut(strings.TrimSpace(bc.msg.Message), " ")
+		if slug, ok := strings.CutPrefix(arg, "c_"); ok {
+			return bc.HandleOpenCollection(slug)
+		}
+		return bc.HandleStart()
+	},
+}
+
+// NewDefaultRegistry returns the registry of every command of the bot, messages
+// which aren't commands are answered like /start.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry(startCommand)
+	r.Use(LogCommands, CheckBan, RateLimit(CommandRateLimit, time.Duration(CommandRateWindowSec)*time.Second),
+		CheckSubscription, CheckCredits)
+	r.Register(
+		startCommand,
+		&Command{Name: "help", Description: "Get help", Handler: (*Context).HandleHelp},
+		&Command{Name: "stat", Description: "Get your statistics", Handler: (*Context).HandleStat},
+		&Command{Name: "myfiles", Description: "List and manage your files", Handler: (*Context).HandleMyFiles},
+		&Command{Name: "batch", Description: "Get links for a range of channel messages", Handler: (*Context).HandleBatch},
+		&Command{Name: "collections", Description: "List your collections", Handler: (*Context).HandleCollections},
+		&Command{Name: "collection", Description: "Create and change collections", Handler: (*Context).HandleCollection},
+		&Command{Name: "addchannel", Description: "Auto-link files posted in your channel", Handler: (*Context).HandleAddChannel},
+		&Command{Name: "channels", Description: "List your channels", Handler: (*Context).HandleChannels},
+		&Command{Name: "channel", Description: "Change the settings of a channel", Handler: (*Context).HandleChannel},
+		&Command{Name: "revoke", Args: "<file id>", Description: "Disable the link of a file", Handler: (*Context).HandleRevoke},
+		&Command{Name: "expire", Args: "<file id> <7d|never>", Description: "Let the link of a file expire", Handler: (*Context).HandleExpire},
+		&Command{Name: "rename", Args: "<file id> <name>", Description: "Change the name a file is downloaded with", Handler: (*Context).HandleRename},
+		&Command{Name: "password", Args: "<file id> <password|off>", Description: "Ask for a password before a file opens", Handler: (*Context).HandlePassword},
+		&Command{Name: "limit", Args: "<file id> <views|off>", Description: "Limit how often a file may be viewed", Handler: (*Context).HandleLimit},
+		&Command{Name: "cancel", Description: "Cancel the running dialog", Handler: (*Context).HandleCancel},
+		&Command{Name: "support", Aliases: []string{"report"}, Args: "[message]", Description: "Ask support, reply to a message to send it", Handler: (*Context).HandleSupport},
+		&Command{Name: "tickets", Description: "List your support tickets", Handler: (*Context).HandleTickets},
+		&Command{Name: "close", Args: "[ticket id]", Description: "Close your support ticket", Handler: (*Context).HandleClose},
+
+		&Command{Name: "broadcast", Args: "[pin] [in 2h] [filters]", Description: "Broadcast the replied message to users", Permission: PermBroadcast, Handler: (*Context).HandleBroadcast},
+		&Command{Name: "broadcast_status", Args: "[id]", Description: "Show the progress of broadcasts", Permission: PermBroadcast, Handler: (*Context).HandleBroadcastStatus},
+		&Command{Name: "broadcast_cancel", Args: "<id>", Description: "Stop a broadcast", Permission: PermBroadcast, Handler: (*Context).HandleBroadcastCancel},
+		&Command{Name: "ban", Args: "<user id>", Description: "Ban a user", Permission: PermBan, Handler: func(bc *Context) (tg.UpdatesClass, error) {
+			return bc.HandleToggleBan(true)
+		}},
+		&Command{Name: "unban", Args: "<user id>", Description: "Unban a user", Permission: PermBan, Handler: func(bc *Context) (tg.UpdatesClass, error) {
+			return bc.HandleToggleBan(false)
+		}},
+		&Command{Name: "addbot", Args: "<token>", Description: "Add a worker bot by token", Permission: PermBots, Handler: (*Context).HandleAddBot},
+		&Command{Name: "removebot", Args: "<username>", Description: "Remove a worker bot by username", Permission: PermBots, Handler: (*Context).HandleRemoveBot},
+		&Command{Name: "bots", Description: "List worker bots", Permission: PermBots, Handler: (*Context).HandleListBots},
+		&Command{Name: "mirrors", Description: "List channel mirrors", Permission: PermMirrors, Handler: (*Context).HandleMirrors},
+		&Command{Name: "mirror", Description: "Mirror files of a channel to another channel", Permission: PermMirrors, Handler: (*Context).HandleMirror},
+		&Command{Name: "backfill", Description: "Mirror older posts of a channel", Permission: PermMirrors, Handler: (*Context).HandleBackfill},
+		&Command{Name: "grant", Args: "<user id> <role>", Description: "Give a user a staff role", Permission: PermRoles, Handler: (*Context).HandleGrant},
+		&Command{Name: "revokerole", Args: "<user id>", Description: "Take the staff role of a user", Permission: PermRoles, Handler: (*Context).HandleRevokeRole},
+		&Command{Name: "admins", Description: "List the staff of the bot", Permission: PermRoles, Handler: (*Context).HandleAdmins},
+	)
+	r.RegisterDialog(batchDialog, renameDialog, passwordDialog, broadcastDialog)
+	return r
+}
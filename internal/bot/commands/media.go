@@ -7,6 +7,8 @@ import (
 
 	"github.com/biisal/fast-stream-bot/config"
 	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/message/markup"
 	"github.com/gotd/td/tg"
@@ -18,27 +20,40 @@ type MediaForwardParams struct {
 	Client *telegram.Client
 }
 
-func (bc *Context) MediaForwarding(params MediaForwardParams) (tg.UpdatesClass, error) {
-	if params.Cfg.REF {
-		if bc.dbUser.Credit < params.Cfg.MIN_CREDITS_REQUIRED {
-			referUrl := botutils.GetReferLink(bc.userInfo.Username, bc.userInfo.ID)
-			now := time.Now()
-			nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-			btn := markup.InlineKeyboard(
-				markup.Row(
-					markup.URL("Get Credits By Refer", referUrl),
-				),
-			)
-			msg := fmt.Sprintf(
-				"You're out of credits! 😢\nYou need %d more credits to use this bot.\n\nWait for %s to get new credits or Refer one user to earn %d credits.",
-				params.Cfg.MIN_CREDITS_REQUIRED-bc.dbUser.Credit,
-				nextMidnight.Sub(now).Round(time.Second).String(),
-				params.Cfg.INCREMENT_CREDITS,
-			)
-			return bc.builder.Markup(btn).Text(bc.ctx, msg)
-		}
+// replyOutOfCredits tells the user how to get credits back.
+func (bc *Context) replyOutOfCredits() (tg.UpdatesClass, error) {
+	referUrl := botutils.GetReferLink(bc.userInfo.Username, bc.userInfo.ID)
+	now := time.Now()
+	nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	btn := markup.InlineKeyboard(
+		markup.Row(
+			markup.URL("Get Credits By Refer", referUrl),
+		),
+	)
+	msg := fmt.Sprintf(
+		"You're out of credits! 😢\nYou need %d more credits to use this bot.\n\nWait for %s to get new credits or Refer one user to earn %d credits.",
+		bc.cfg.MIN_CREDITS_REQUIRED-bc.dbUser.Credit,
+		nextMidnight.Sub(now).Round(time.Second).String(),
+		bc.cfg.INCREMENT_CREDITS,
+	)
+	return bc.builder.Markup(btn).Text(bc.ctx, msg)
+}
+
+// MediaCommand handles a file sent to the bot.
+func MediaCommand(params MediaForwardParams) *Command {
+	return &Command{
+		Name:         "media",
+		Hidden:       true,
+		NeedsCredits: true,
+		Handler: func(bc *Context) (tg.UpdatesClass, error) {
+			return bc.MediaForwarding(params)
+		},
 	}
+}
 
+// MediaForwarding saves the file to the DB channel and replies with its link.
+// Credits are checked by CheckCredits before.
+func (bc *Context) MediaForwarding(params MediaForwardParams) (tg.UpdatesClass, error) {
 	m := params.Update.Message.(*tg.Message)
 	fromPeer := &tg.InputPeerUser{UserID: bc.userInfo.ID, AccessHash: bc.userInfo.AccessHash}
 	file, err := botutils.GetMediaFromMessage(m)
@@ -48,7 +63,7 @@ func (bc *Context) MediaForwarding(params MediaForwardParams) (tg.UpdatesClass,
 	}
 	msgHash := botutils.MakeHashByFileInfo(file)
 
-	_, channelInputPeer, err := botutils.GetChannelPeer(params.Client.API(), bc.ctx, params.Cfg.DB_CHANNEL_ID)
+	channelInputPeer, err := botutils.GetChannelPeer(bc.peers, bc.ctx, params.Cfg.DB_CHANNEL_ID)
 	if err != nil {
 		slog.Error("Failed to get channel peer", "error", err)
 		return nil, err
@@ -60,15 +75,49 @@ func (bc *Context) MediaForwarding(params MediaForwardParams) (tg.UpdatesClass,
 		return nil, err
 	}
 	messageId := fUpdate.(*tg.Updates).Updates[0].(*tg.UpdateMessageID).ID
-	streamLink := fmt.Sprintf("%s/watch/%d?hash=%s", params.Cfg.FQDN, messageId, msgHash)
+	streamLink := botutils.GetStreamLink(params.Cfg, params.Cfg.DB_CHANNEL_ID, messageId, msgHash)
+
+	// the caption may set an expiry, e.g. "expire 7d"
+	var expiresAt *time.Time
+	if ttl, ok := botutils.ExpiryFromCaption(m.Message); ok {
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+	// and a name to show and download the file with, e.g. "name: Movie.mkv"
+	var displayName, nameNote string
+	if name, ok := botutils.NameFromCaption(m.Message); ok {
+		if displayName, err = filesvc.CleanName(name, file.FileName); err != nil {
+			nameNote = fmt.Sprintf("\n\nThe name of the caption was ignored: %s.", err.Error())
+		}
+	}
+	fileRecord, err := bc.fileService.Create(bc.ctx, repo.CreateFileParams{
+		OwnerID:     bc.userInfo.ID,
+		ChannelID:   params.Cfg.DB_CHANNEL_ID,
+		MessageID:   int32(messageId),
+		DocumentID:  file.Location.ID,
+		FileName:    file.FileName,
+		FileSize:    file.Size,
+		MimeType:    file.MimeType,
+		Hash:        msgHash,
+		ExpiresAt:   filesvc.Timestamp(expiresAt),
+		DisplayName: displayName,
+	})
+	if err != nil {
+		slog.Error("Failed to save file", "error", err)
+	}
+
+	fileName := file.FileName
+	if displayName != "" {
+		fileName = displayName
+	}
 	fileMsg := fmt.Sprintf(
 		"File Name: %s\nFile Size: %s\n\nLink: %s",
-		file.FileName, botutils.MakeSizeReadable(file.Size), streamLink,
+		fileName, botutils.MakeSizeReadable(file.Size), streamLink,
 	)
-	bc.dbUser, err = bc.userService.DecrementCredits(bc.ctx, bc.userInfo.ID, params.Cfg.DECREMENT_CREDITS)
-	if err != nil {
-		slog.Error("Failed to decrement credit", "error", err)
-		bc.SendLogMessage(fmt.Sprintf("FAILURE: Failed to decrement credit for user %d: %v", bc.userInfo.ID, err))
+	if expiresAt != nil {
+		fileMsg += fmt.Sprintf("\nExpires: %s", expiresAt.Format(botutils.ExpiryLayout))
+	}
+	if err := bc.takeCredits(1); err != nil {
 		return nil, err
 	}
 
@@ -76,6 +125,11 @@ func (bc *Context) MediaForwarding(params MediaForwardParams) (tg.UpdatesClass,
 		"Your file is ready to watch or download!\n\n%s",
 		fileMsg,
 	)
+	if fileRecord != nil {
+		msg += fmt.Sprintf("\n\nFile ID: %d\nUse /revoke %d to disable the link, /expire %d 7d to let it expire or /rename %d <name> to rename it.",
+			fileRecord.ID, fileRecord.ID, fileRecord.ID, fileRecord.ID)
+	}
+	msg += nameNote
 
 	if params.Cfg.REF {
 		msg += fmt.Sprintf("\n\nYou have %d credits to use 😊", bc.dbUser.Credit)
@@ -99,7 +153,7 @@ func (bc *Context) MediaForwarding(params MediaForwardParams) (tg.UpdatesClass,
 	}
 	fileMsg = fmt.Sprintf("User: %s\nUserId: %d\n\n%s",
 		bc.userInfo.Username, bc.userInfo.ID, fileMsg)
-	_, channelInputPeer, err = botutils.GetChannelPeer(params.Client.API(), bc.ctx, params.Cfg.DB_CHANNEL_ID)
+	channelInputPeer, err = botutils.GetChannelPeer(bc.peers, bc.ctx, params.Cfg.DB_CHANNEL_ID)
 	if err != nil {
 		slog.Error("Failed to get channel peer", "error", err)
 		return nil, err
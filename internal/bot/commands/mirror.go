@@ -0,0 +1,367 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biisal/fast-stream-bot/config"
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	mirrorsvc "github.com/biisal/fast-stream-bot/internal/service/mirror"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/markup"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	BackfillMaxMessages int = 1000
+	// MirrorPostDelayMs spaces the posts of a backfill to stay clear of flood
+	// waits in the target channel.
+	MirrorPostDelayMs int = 1500
+)
+
+// backfills are the mirrors with a running backfill, a mirror is backfilled
+// by one at a time.
+var backfills = struct {
+	mut     sync.Mutex
+	running map[int64]bool
+}{running: make(map[int64]bool)}
+
+const mirrorUsage = `Usage:
+/mirror add <source> <target> - Repost new files of source to target
+/mirror mime <mirror id> <video/,audio/mpeg|any> - Only mirror these mime types
+/mirror minsize <mirror id> <MB> - Only mirror files of at least this size
+/mirror keyword <mirror id> <word|any> - Only mirror files with this word in the name or caption
+/mirror on <mirror id> - Resume mirroring
+/mirror off <mirror id> - Pause mirroring
+/mirror remove <mirror id> - Delete the mirror
+/backfill <mirror id> <first post id> [last post id] - Mirror older posts
+
+Channels are given by @username or id. I have to be an admin of both channels.`
+
+// Mirrorer copies files of source channels to the DB channel and posts their
+// links to the target channels.
+type Mirrorer struct {
+	api           *tg.Client
+	peers         *peers.Manager
+	sender        *message.Sender
+	cfg           *config.Config
+	fileService   filesvc.Service
+	mirrorService mirrorsvc.Service
+}
+
+func NewMirrorer(api *tg.Client, peerManager *peers.Manager, sender *message.Sender,
+	cfg *config.Config, fileService filesvc.Service, mirrorService mirrorsvc.Service,
+) *Mirrorer {
+	return &Mirrorer{api, peerManager, sender, cfg, fileService, mirrorService}
+}
+
+// HandleChannelPost mirrors a new post of a channel to every target it has.
+func (mr *Mirrorer) HandleChannelPost(ctx context.Context, channelID int64, msg *tg.Message) error {
+	mirrors, err := mr.mirrorService.BySource(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	for _, m := range mirrors {
+		if _, err := mr.Mirror(ctx, m, msg); err != nil {
+			slog.Error("Failed to mirror post", "mirror", m.ID, "message", msg.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// Mirror posts the file of msg to the target of m. It returns false when msg
+// has no file, doesn't pass the filters or was mirrored before.
+func (mr *Mirrorer) Mirror(ctx context.Context, m *repo.Mirror, msg *tg.Message) (bool, error) {
+	file, err := botutils.GetMediaFromMessage(msg)
+	if err != nil || !mirrorsvc.Matches(m, file, msg.Message) {
+		return false, nil
+	}
+	claimed, err := mr.mirrorService.Claim(ctx, m.ID, file.Location.ID, msg.ID)
+	if err != nil || !claimed {
+		return false, err
+	}
+	if err := mr.post(ctx, m, msg, file); err != nil {
+		if err := mr.mirrorService.Release(ctx, m.ID, file.Location.ID); err != nil {
+			slog.Error("Failed to release mirror post", "error", err)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (mr *Mirrorer) post(ctx context.Context, m *repo.Mirror, msg *tg.Message, file *types.File) error {
+	source, err := botutils.GetChannelPeer(mr.peers, ctx, m.SourceID)
+	if err != nil {
+		return err
+	}
+	target, err := botutils.GetChannelPeer(mr.peers, ctx, m.TargetID)
+	if err != nil {
+		return err
+	}
+	dbChannel, err := botutils.GetChannelPeer(mr.peers, ctx, mr.cfg.DB_CHANNEL_ID)
+	if err != nil {
+		return err
+	}
+	forwarded, err := botutils.ForwardMessages(ctx, mr.api, source.InputPeer(), dbChannel.InputPeer(), []int{msg.ID})
+	if err != nil {
+		return fmt.Errorf("failed to forward post: %w", err)
+	}
+	messageID, ok := forwarded[msg.ID]
+	if !ok {
+		return errors.New("forwarded post not found")
+	}
+
+	hash := botutils.MakeHashByFileInfo(file)
+	if _, err := mr.fileService.Create(ctx, repo.CreateFileParams{
+		OwnerID:    m.CreatedBy,
+		ChannelID:  mr.cfg.DB_CHANNEL_ID,
+		MessageID:  int32(messageID),
+		DocumentID: file.Location.ID,
+		FileName:   file.FileName,
+		FileSize:   file.Size,
+		MimeType:   file.MimeType,
+		Hash:       hash,
+	}); err != nil {
+		slog.Error("Failed to save file", "error", err)
+	}
+
+	watchLink := botutils.GetStreamLink(mr.cfg, mr.cfg.DB_CHANNEL_ID, messageID, hash)
+	downloadLink := botutils.GetDownloadLink(mr.cfg, mr.cfg.DB_CHANNEL_ID, messageID, hash)
+	text := fmt.Sprintf("File Name: %s\nFile Size: %s", file.FileName, botutils.MakeSizeReadable(file.Size))
+	keyboard := markup.InlineKeyboard(markup.Row(
+		markup.URL("Watch", watchLink),
+		markup.URL("Download", downloadLink),
+	))
+	if _, err := mr.sender.To(target.InputPeer()).Markup(keyboard).NoWebpage().Text(ctx, text); err != nil {
+		return fmt.Errorf("failed to post to target: %w", err)
+	}
+	return nil
+}
+
+func (bc *Context) mirrorer() *Mirrorer {
+	return NewMirrorer(bc.client.API(), bc.peers, bc.sender, bc.cfg, bc.fileService, bc.mirrorService)
+}
+
+// HandleMirrors lists every mirror.
+func (bc *Context) HandleMirrors() (tg.UpdatesClass, error) {
+	mirrors, err := bc.mirrorService.List(bc.ctx)
+	if err != nil {
+		slog.Error("Failed to list mirrors", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to get the mirrors! Err : %s", err.Error()))
+	}
+	if len(mirrors) == 0 {
+		return bc.Reply("There are no mirrors yet.\n\n" + mirrorUsage)
+	}
+	entries := []string{"Mirrors:"}
+	for _, m := range mirrors {
+		entries = append(entries, describeMirror(m))
+	}
+	for _, text := range splitMessage(entries, MaxMessageLength) {
+		if _, err := bc.Reply(text); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func describeMirror(m *repo.Mirror) string {
+	status := "on"
+	if !m.Enabled {
+		status = "off"
+	}
+	mime, keyword := m.MimeFilter, m.Keyword
+	if mime == "" {
+		mime = "any"
+	}
+	if keyword == "" {
+		keyword = "any"
+	}
+	return fmt.Sprintf("ID %d: %d -> %d (%s)\nMime: %s, Min size: %s, Keyword: %s",
+		m.ID, m.SourceID, m.TargetID, status, mime, botutils.MakeSizeReadable(m.MinSize), keyword)
+}
+
+// HandleMirror creates and changes mirrors, see mirrorUsage.
+func (bc *Context) HandleMirror() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) < 3 {
+		return bc.Reply(mirrorUsage)
+	}
+	if args[1] == "add" {
+		if len(args) != 4 {
+			return bc.Reply(mirrorUsage)
+		}
+		return bc.addMirror(args[2], args[3])
+	}
+
+	id, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return bc.Reply("Invalid mirror id!")
+	}
+	m, err := bc.mirrorService.Get(bc.ctx, id)
+	if err != nil {
+		return bc.mirrorCommandError(err)
+	}
+	filters := mirrorsvc.Filters{MimeTypes: m.MimeFilter, MinSize: m.MinSize, Keyword: m.Keyword}
+	value := strings.Join(args[3:], " ")
+	if value == "any" {
+		value = ""
+	}
+
+	switch {
+	case args[1] == "mime" && len(args) > 3:
+		filters.MimeTypes = strings.ReplaceAll(value, " ", "")
+	case args[1] == "minsize" && len(args) == 4:
+		mb, err := strconv.ParseFloat(args[3], 64)
+		if err != nil || mb < 0 {
+			return bc.Reply("Invalid size! Give it in MB, e.g. 50 or 0.5")
+		}
+		filters.MinSize = int64(mb * 1024 * 1024)
+	case args[1] == "keyword" && len(args) > 3:
+		filters.Keyword = value
+	case (args[1] == "on" || args[1] == "off") && len(args) == 3:
+		if m, err = bc.mirrorService.SetEnabled(bc.ctx, m.ID, args[1] == "on"); err != nil {
+			return bc.mirrorCommandError(err)
+		}
+		return bc.Reply(describeMirror(m))
+	case args[1] == "remove" && len(args) == 3:
+		if err := bc.mirrorService.Delete(bc.ctx, m.ID); err != nil {
+			return bc.mirrorCommandError(err)
+		}
+		return bc.Reply(fmt.Sprintf("Removed mirror %d. Files it posted keep working.", m.ID))
+	default:
+		return bc.Reply(mirrorUsage)
+	}
+	if m, err = bc.mirrorService.SetFilters(bc.ctx, m.ID, filters); err != nil {
+		return bc.mirrorCommandError(err)
+	}
+	return bc.Reply(describeMirror(m))
+}
+
+func (bc *Context) addMirror(sourceArg, targetArg string) (tg.UpdatesClass, error) {
+	source, err := bc.resolveChannel(sourceArg)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to find the source channel! Err : %s", err.Error()))
+	}
+	target, err := bc.resolveChannel(targetArg)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to find the target channel! Err : %s", err.Error()))
+	}
+	if source.ID() == target.ID() {
+		return bc.Reply("Source and target have to be different channels!")
+	}
+	// bots only get the posts of channels they are an admin of
+	if _, ok := source.AdminRights(); !ok {
+		return bc.Reply(fmt.Sprintf("Make me an admin of %s first.", source.VisibleName()))
+	}
+	if source.NoForwards() {
+		return bc.Reply(fmt.Sprintf("%s restricts saving content, so I can't save its files.", source.VisibleName()))
+	}
+	if rights, ok := target.AdminRights(); !ok || !rights.PostMessages {
+		return bc.Reply(fmt.Sprintf("Make me an admin of %s which can post messages first.", target.VisibleName()))
+	}
+
+	m, err := bc.mirrorService.Create(bc.ctx, source.ID(), target.ID(), bc.userInfo.ID)
+	if err != nil {
+		slog.Error("Failed to create mirror", "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to create the mirror! Err : %s", err.Error()))
+	}
+	return bc.Reply(fmt.Sprintf("Mirroring new files of %s to %s.\n\n%s\n\nPosts from before can be mirrored with /backfill %d <first post id> [last post id].",
+		source.VisibleName(), target.VisibleName(), describeMirror(m), m.ID))
+}
+
+func (bc *Context) mirrorCommandError(err error) (tg.UpdatesClass, error) {
+	if errors.Is(err, types.ErrorNotFound) {
+		return bc.Reply("Mirror not found! List them with /mirrors.")
+	}
+	slog.Error("Failed to update mirror", "error", err)
+	return bc.Reply(fmt.Sprintf("Failed to update the mirror! Err : %s", err.Error()))
+}
+
+// HandleBackfill mirrors the posts of the source with ids in the given range.
+// Bots can't read the history of a channel, so the range is fetched by id;
+// posts mirrored before are skipped.
+func (bc *Context) HandleBackfill() (tg.UpdatesClass, error) {
+	args := strings.Fields(bc.msg.Message)
+	if len(args) < 3 || len(args) > 4 {
+		return bc.Reply("Usage: /backfill <mirror id> <first post id> [last post id]")
+	}
+	ids, err := parseIDs(args[1:])
+	if err != nil {
+		return bc.Reply("Invalid id!")
+	}
+	first, last := int(ids[1]), int(ids[1])+BackfillMaxMessages-1
+	if len(ids) == 3 {
+		last = int(ids[2])
+	}
+	if first <= 0 || last < first {
+		return bc.Reply("Invalid range!")
+	}
+	if last-first+1 > BackfillMaxMessages {
+		return bc.Reply(fmt.Sprintf("You can backfill at most %d posts at once!", BackfillMaxMessages))
+	}
+	m, err := bc.mirrorService.Get(bc.ctx, ids[0])
+	if err != nil {
+		return bc.mirrorCommandError(err)
+	}
+
+	postIDs := make([]int, 0, last-first+1)
+	for id := first; id <= last; id++ {
+		postIDs = append(postIDs, id)
+	}
+	backfills.mut.Lock()
+	if backfills.running[m.ID] {
+		backfills.mut.Unlock()
+		return bc.Reply(fmt.Sprintf("Mirror %d is being backfilled already, wait until it's done.", m.ID))
+	}
+	backfills.running[m.ID] = true
+	backfills.mut.Unlock()
+
+	// the backfill outlives the update, it stops with the bot instead
+	ctx := bc.botCtx
+	peer := bc.inputPeer()
+	go func() {
+		defer func() {
+			backfills.mut.Lock()
+			delete(backfills.running, m.ID)
+			backfills.mut.Unlock()
+		}()
+		mirrored, failed := 0, 0
+		msgs, err := botutils.GetChannelMessages(ctx, m.SourceID, postIDs, bc.peers)
+		if err != nil {
+			slog.Error("Failed to get posts to backfill", "error", err)
+			_, _ = bc.sender.To(peer).Text(ctx, fmt.Sprintf("Failed to get the posts of mirror %d! Err : %s", m.ID, err.Error()))
+			return
+		}
+		mr := bc.mirrorer()
+		for _, msg := range msgs {
+			ok, err := mr.Mirror(ctx, m, msg)
+			if err != nil {
+				slog.Error("Failed to backfill post", "mirror", m.ID, "message", msg.ID, "error", err)
+				failed++
+			}
+			if !ok {
+				continue
+			}
+			mirrored++
+			select {
+			case <-ctx.Done():
+				slog.Info("Backfill stopped", "mirror", m.ID, "mirrored", mirrored)
+				return
+			case <-time.After(time.Duration(MirrorPostDelayMs) * time.Millisecond):
+			}
+		}
+		_, _ = bc.sender.To(peer).Text(ctx, fmt.Sprintf("Backfill of mirror %d done.\nMirrored: %d\nFailed: %d\nSkipped: %d",
+			m.ID, mirrored, failed, len(msgs)-mirrored-failed))
+	}()
+	return bc.Reply(fmt.Sprintf("Backfilling posts %d to %d of mirror %d. I'll tell you when it's done.", first, last, m.ID))
+}
@@ -0,0 +1,270 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// Handler runs a command.
+type Handler func(bc *Context) (tg.UpdatesClass, error)
+
+// Middleware wraps the handler of every command, e.g. to refuse it.
+type Middleware func(cmd *Command, next Handler) Handler
+
+type Command struct {
+	// Name is the command without the slash, e.g. "myfiles".
+	Name    string
+	Aliases []string
+	// Args are shown after the name in the help, e.g. "<file id>".
+	Args        string
+	Description string
+	// Permission is what the user's role must allow, see rolePermissions.
+	Permission Permission
+	// NeedsCredits commands are refused while the user has less than
+	// MIN_CREDITS_REQUIRED credits.
+	NeedsCredits bool
+	// Hidden commands are neither listed in the help nor in the menu.
+	Hidden  bool
+	Handler Handler
+}
+
+// unknownCommand answers commands which aren't registered with the list of
+// commands.
+var unknownCommand = &Command{
+	Name:    "unknown",
+	Hidden:  true,
+	Handler: (*Context).HandleSendCommandList,
+}
+
+// Registry dispatches the messages sent to the bot to their command.
+type Registry struct {
+	commands    []*Command
+	names       map[string]*Command
+	middlewares []Middleware
+	dialogs     map[string]*Dialog
+	// fallback handles messages which aren't commands.
+	fallback *Command
+}
+
+func NewRegistry(fallback *Command) *Registry {
+	return &Registry{
+		names:    make(map[string]*Command),
+		dialogs:  make(map[string]*Dialog),
+		fallback: fallback,
+	}
+}
+
+// Register adds commands, listed in the order they are registered. It panics
+// on names used twice, as commands are registered once on start.
+func (r *Registry) Register(cmds ...*Command) {
+	for _, cmd := range cmds {
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			if _, ok := r.names[name]; ok {
+				panic(fmt.Sprintf("commands: %q registered twice", name))
+			}
+			r.names[name] = cmd
+		}
+		r.commands = append(r.commands, cmd)
+	}
+}
+
+// Use appends middlewares, the first one runs first.
+func (r *Registry) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Lookup returns the command of a message like "/name@bot args".
+func (r *Registry) Lookup(text string) (*Command, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return nil, false
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	cmd, ok := r.names[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Dispatch runs the command of a text message. Unknown commands get the list
+// of commands, other messages run the fallback.
+func (r *Registry) Dispatch(bc *Context) (tg.UpdatesClass, error) {
+	text := strings.TrimSpace(bc.msg.Message)
+	if cmd, ok := r.Lookup(text); ok {
+		return r.Run(bc, cmd)
+	}
+	if strings.HasPrefix(text, "/") {
+		return r.Run(bc, unknownCommand)
+	}
+	return r.Run(bc, r.fallback)
+}
+
+// Run runs cmd through the middlewares if the user's role allows it.
+func (r *Registry) Run(bc *Context, cmd *Command) (tg.UpdatesClass, error) {
+	if !bc.Can(cmd.Permission) {
+		return bc.Reply("Your role doesn't allow this command! :)")
+	}
+	h := cmd.Handler
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](cmd, h)
+	}
+	return h(bc)
+}
+
+func (r *Registry) visible(role Role) []*Command {
+	var cmds []*Command
+	for _, cmd := range r.commands {
+		if !cmd.Hidden && role.Can(cmd.Permission) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// Help lists the commands available to role.
+func (r *Registry) Help(role Role) string {
+	lines := []string{"Available commands:"}
+	for _, cmd := range r.visible(role) {
+		usage := "/" + cmd.Name
+		if cmd.Args != "" {
+			usage += " " + cmd.Args
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", usage, cmd.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BotCommands returns the menu of role.
+func (r *Registry) BotCommands(role Role) []tg.BotCommand {
+	var menu []tg.BotCommand
+	for _, cmd := range r.visible(role) {
+		menu = append(menu, tg.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	return menu
+}
+
+// SyncMenu sets the command menu shown by Telegram, every member of staff
+// sees the commands of their role in the chat with the bot. Staff the bot
+// can't resolve yet is left out.
+func (r *Registry) SyncMenu(ctx context.Context, api *tg.Client, staff []StaffMenu) error {
+	if _, err := api.BotsSetBotCommands(ctx, &tg.BotsSetBotCommandsRequest{
+		Scope:    &tg.BotCommandScopeDefault{},
+		Commands: r.BotCommands(RoleUser),
+	}); err != nil {
+		return fmt.Errorf("failed to set default commands: %w", err)
+	}
+	for _, s := range staff {
+		if err := r.SetUserMenu(ctx, api, s.Peer, s.Role); err != nil {
+			return fmt.Errorf("failed to set %s commands: %w", s.Role, err)
+		}
+	}
+	return nil
+}
+
+// StaffMenu is a staff member whose menu SyncMenu sets.
+type StaffMenu struct {
+	Peer tg.InputPeerClass
+	Role Role
+}
+
+// SetUserMenu sets the menu of role for one user, RoleUser resets it to the
+// default menu.
+func (r *Registry) SetUserMenu(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, role Role) error {
+	scope := &tg.BotCommandScopePeer{Peer: peer}
+	if role == RoleUser {
+		_, err := api.BotsResetBotCommands(ctx, &tg.BotsResetBotCommandsRequest{Scope: scope})
+		return err
+	}
+	_, err := api.BotsSetBotCommands(ctx, &tg.BotsSetBotCommandsRequest{
+		Scope:    scope,
+		Commands: r.BotCommands(role),
+	})
+	return err
+}
+
+// LogCommands logs the duration and error of every command.
+func LogCommands(cmd *Command, next Handler) Handler {
+	return func(bc *Context) (tg.UpdatesClass, error) {
+		start := time.Now()
+		res, err := next(bc)
+		if err != nil {
+			slog.Error("Command failed", "command", cmd.Name, "user", bc.userInfo.ID, "duration", time.Since(start), "error", err)
+		} else {
+			slog.Debug("Command done", "command", cmd.Name, "user", bc.userInfo.ID, "duration", time.Since(start))
+		}
+		return res, err
+	}
+}
+
+// CheckBan refuses every command of banned users.
+func CheckBan(cmd *Command, next Handler) Handler {
+	return func(bc *Context) (tg.UpdatesClass, error) {
+		if bc.dbUser.IsBanned {
+			return bc.Reply("you are banned to use this bot\ncontact admin for more info")
+		}
+		return next(bc)
+	}
+}
+
+// CheckCredits refuses commands which need credits while the user is out of
+// them.
+func CheckCredits(cmd *Command, next Handler) Handler {
+	return func(bc *Context) (tg.UpdatesClass, error) {
+		if cmd.NeedsCredits && bc.cfg.REF && bc.dbUser.Credit < bc.cfg.MIN_CREDITS_REQUIRED {
+			return bc.replyOutOfCredits()
+		}
+		return next(bc)
+	}
+}
+
+// RateLimit allows every user limit commands per window, staff isn't
+// limited. Users over the limit are told once per window.
+func RateLimit(limit int, window time.Duration) Middleware {
+	type usage struct {
+		start time.Time
+		count int
+	}
+	var (
+		mut   sync.Mutex
+		users = make(map[int64]*usage)
+		swept time.Time
+	)
+	return func(cmd *Command, next Handler) Handler {
+		return func(bc *Context) (tg.UpdatesClass, error) {
+			if bc.Role() > RoleUser {
+				return next(bc)
+			}
+			now := time.Now()
+			mut.Lock()
+			// forget users whose window ran out, at most once per window
+			if now.Sub(swept) >= window {
+				for id, u := range users {
+					if now.Sub(u.start) >= window {
+						delete(users, id)
+					}
+				}
+				swept = now
+			}
+			u, ok := users[bc.userInfo.ID]
+			if !ok || now.Sub(u.start) >= window {
+				u = &usage{start: now}
+				users[bc.userInfo.ID] = u
+			}
+			u.count++
+			count, left := u.count, window-now.Sub(u.start)
+			mut.Unlock()
+
+			switch {
+			case count == limit+1:
+				return bc.Reply(fmt.Sprintf("Slow down! Try again in %s.", left.Round(time.Second)))
+			case count > limit:
+				return nil, nil
+			}
+			return next(bc)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/biisal/fast-stream-bot/config"
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	adminsvc "github.com/biisal/fast-stream-bot/internal/service/admin"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/tg"
+)
+
+// Role is the rank of a user on the bot's staff. Staff roles are kept in the
+// admins table, ADMIN_ID is always the owner so the bot can't lose its
+// owner.
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleSupport
+	RoleModerator
+	RoleAdmin
+	RoleOwner
+)
+
+var roleNames = [...]string{
+	RoleUser:      "user",
+	RoleSupport:   "support",
+	RoleModerator: "moderator",
+	RoleAdmin:     "admin",
+	RoleOwner:     "owner",
+}
+
+func (r Role) String() string {
+	if r < RoleUser || int(r) >= len(roleNames) {
+		return roleNames[RoleUser]
+	}
+	return roleNames[r]
+}
+
+// ParseRole returns the staff role named name, RoleUser isn't a staff role.
+func ParseRole(name string) (Role, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for r := RoleSupport; int(r) < len(roleNames); r++ {
+		if roleNames[r] == name {
+			return r, true
+		}
+	}
+	return RoleUser, false
+}
+
+// Permission is a set of things a role may do, commands need every
+// permission of their Permission field.
+type Permission uint
+
+// PermNone commands may be used by everyone.
+const PermNone Permission = 0
+
+const (
+	// PermStats shows the totals of the bot in /stat.
+	PermStats Permission = 1 << iota
+	// PermTickets answers, lists and closes the support tickets of users.
+	PermTickets
+	// PermBan bans and unbans users.
+	PermBan
+	// PermFiles manages files, collections and channels of other users.
+	PermFiles
+	// PermBroadcast sends messages to every user of the bot.
+	PermBroadcast
+	// PermBots adds, removes and lists the worker bots.
+	PermBots
+	// PermMirrors sets up channel mirrors and backfills them.
+	PermMirrors
+	// PermRoles grants and revokes staff roles.
+	PermRoles
+)
+
+// rolePermissions is the permission matrix of the staff roles.
+var rolePermissions = map[Role]Permission{
+	RoleSupport:   PermStats | PermTickets,
+	RoleModerator: PermStats | PermTickets | PermBan | PermFiles,
+	RoleAdmin:     PermStats | PermTickets | PermBan | PermFiles | PermBroadcast | PermBots | PermMirrors,
+	RoleOwner:     PermStats | PermTickets | PermBan | PermFiles | PermBroadcast | PermBots | PermMirrors | PermRoles,
+}
+
+// Can reports whether the role has every permission of p.
+func (r Role) Can(p Permission) bool {
+	return rolePermissions[r]&p == p
+}
+
+// userRole returns the role of a user, users whose role can't be read are
+// treated as users.
+func userRole(ctx context.Context, cfg *config.Config, adminService adminsvc.Service, userID int64) Role {
+	if userID == cfg.ADMIN_ID {
+		return RoleOwner
+	}
+	name, err := adminService.Role(ctx, userID)
+	if err != nil {
+		slog.Error("Failed to get role", "user", userID, "error", err)
+		return RoleUser
+	}
+	role, _ := ParseRole(name)
+	return role
+}
+
+func (bc *Context) roleOf(userID int64) Role {
+	return userRole(bc.ctx, bc.cfg, bc.adminService, userID)
+}
+
+// Role returns the role of the user who sent the message.
+func (bc *Context) Role() Role {
+	return bc.roleOf(bc.userInfo.ID)
+}
+
+// Can reports whether the user who sent the message has every permission of p.
+func (bc *Context) Can(p Permission) bool {
+	return bc.Role().Can(p)
+}
+
+func parseUserID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%q is not a user id", arg)
+	}
+	return id, nil
+}
+
+// HandleGrant gives a user a staff role, /grant <user id> <role>.
+func (bc *Context) HandleGrant() (tg.UpdatesClass, error) {
+	parts := strings.Fields(bc.msg.Message)
+	if len(parts) < 3 {
+		return bc.Reply(fmt.Sprintf("Usage: /grant <user id> <role>\nRoles: %s", strings.Join(roleNames[RoleSupport:], ", ")))
+	}
+	userID, err := parseUserID(parts[1])
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to parse user id! Err : %s", err.Error()))
+	}
+	role, ok := ParseRole(parts[2])
+	if !ok {
+		return bc.Reply(fmt.Sprintf("Unknown role %q!\nRoles: %s", parts[2], strings.Join(roleNames[RoleSupport:], ", ")))
+	}
+	if userID == bc.cfg.ADMIN_ID {
+		return bc.Reply("ADMIN_ID is always the owner!")
+	}
+	if _, err := bc.userService.GetUserByTgID(bc.ctx, userID); err != nil {
+		if errors.Is(err, types.ErrorNotFound) {
+			return bc.Reply("User not found! They have to start the bot first.")
+		}
+		return bc.Reply(fmt.Sprintf("Failed to get user! Err : %s", err.Error()))
+	}
+	if _, err := bc.adminService.Grant(bc.ctx, userID, role.String(), bc.userInfo.ID); err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to grant role! Err : %s", err.Error()))
+	}
+	bc.syncUserMenu(userID, role)
+	bc.notifyRole(userID, fmt.Sprintf("You are now %s of this bot, send /help to see your commands.", role))
+	return bc.Reply(fmt.Sprintf("User %d is now %s!", userID, role))
+}
+
+// HandleRevokeRole takes the staff role of a user, /revokerole <user id>.
+func (bc *Context) HandleRevokeRole() (tg.UpdatesClass, error) {
+	parts := strings.Fields(bc.msg.Message)
+	if len(parts) < 2 {
+		return bc.Reply("Usage: /revokerole <user id>")
+	}
+	userID, err := parseUserID(parts[1])
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to parse user id! Err : %s", err.Error()))
+	}
+	if userID == bc.cfg.ADMIN_ID {
+		return bc.Reply("ADMIN_ID is always the owner!")
+	}
+	a, err := bc.adminService.Revoke(bc.ctx, userID)
+	if err != nil {
+		if errors.Is(err, types.ErrorNotFound) {
+			return bc.Reply("User has no role!")
+		}
+		return bc.Reply(fmt.Sprintf("Failed to revoke role! Err : %s", err.Error()))
+	}
+	bc.syncUserMenu(userID, RoleUser)
+	bc.notifyRole(userID, fmt.Sprintf("You are no longer %s of this bot.", a.Role))
+	return bc.Reply(fmt.Sprintf("Role %s of user %d revoked!", a.Role, userID))
+}
+
+// HandleAdmins lists the staff of the bot.
+func (bc *Context) HandleAdmins() (tg.UpdatesClass, error) {
+	admins, err := bc.adminService.List(bc.ctx)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to get staff! Err : %s", err.Error()))
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Staff (%d):\n", len(admins)+1))
+	sb.WriteString(fmt.Sprintf("\n%d - %s (ADMIN_ID)", bc.cfg.ADMIN_ID, RoleOwner))
+	for _, a := range admins {
+		sb.WriteString(fmt.Sprintf("\n%d - %s, granted by %d on %s", a.UserID, a.Role, a.GrantedBy, a.CreatedAt.Time.Format("2006-01-02")))
+	}
+	return bc.Reply(sb.String())
+}
+
+// syncUserMenu shows the menu of role to a user in the chat with this bot,
+// other bots update it on their next start.
+func (bc *Context) syncUserMenu(userID int64, role Role) {
+	peer, err := botutils.GetUserPeer(bc.peers, bc.ctx, userID)
+	if err != nil {
+		slog.Warn("Failed to resolve user, the menu is set after a restart", "user", userID, "error", err)
+		return
+	}
+	if err := bc.registry.SetUserMenu(bc.ctx, bc.client.API(), peer.InputPeer(), role); err != nil {
+		slog.Error("Failed to set user commands", "user", userID, "error", err)
+	}
+}
+
+func (bc *Context) notifyRole(userID int64, msg string) {
+	peer, err := botutils.GetUserPeer(bc.peers, bc.ctx, userID)
+	if err != nil {
+		slog.Warn("Failed to resolve user", "user", userID, "error", err)
+		return
+	}
+	if _, err := bc.sender.To(peer.InputPeer()).Text(bc.ctx, msg); err != nil {
+		slog.Error("Failed to send role message", "user", userID, "error", err)
+	}
+}
@@ -0,0 +1,403 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/biisal/fast-stream-bot/config"
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	adminsvc "github.com/biisal/fast-stream-bot/internal/service/admin"
+	ticketsvc "github.com/biisal/fast-stream-bot/internal/service/ticket"
+	"github.com/biisal/fast-stream-bot/internal/service/user"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	TicketListSize   int = 15
+	TicketSubjectLen int = 64
+)
+
+const supportUsage = `Send /support <message> or reply to a message with /support to ask support.
+/tickets lists your tickets and /close closes the open one.`
+
+// SupportDesk relays the messages of support tickets between users and the
+// support group of SUPPORT_GROUP_ID. Staff answers a ticket by replying to
+// its messages in the group, users by replying to the answers they got.
+type SupportDesk struct {
+	api           *tg.Client
+	peers         *peers.Manager
+	sender        *message.Sender
+	cfg           *config.Config
+	adminService  adminsvc.Service
+	ticketService ticketsvc.Service
+}
+
+func NewSupportDesk(api *tg.Client, peerManager *peers.Manager, sender *message.Sender,
+	cfg *config.Config, adminService adminsvc.Service, ticketService ticketsvc.Service,
+) *SupportDesk {
+	return &SupportDesk{api, peerManager, sender, cfg, adminService, ticketService}
+}
+
+func (bc *Context) supportDesk() *SupportDesk {
+	return NewSupportDesk(bc.client.API(), bc.peers, bc.sender, bc.cfg, bc.adminService, bc.ticketService)
+}
+
+func (sd *SupportDesk) groupPeer(ctx context.Context) (tg.InputPeerClass, error) {
+	group, err := botutils.GetChannelPeer(sd.peers, ctx, sd.cfg.SUPPORT_GROUP_ID)
+	if err != nil {
+		return nil, err
+	}
+	return group.InputPeer(), nil
+}
+
+// forward copies the message id of from to to and returns the id of the copy.
+func (sd *SupportDesk) forward(ctx context.Context, from, to tg.InputPeerClass, id int, dropAuthor bool) (int, error) {
+	res, err := sd.api.MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+		FromPeer:   from,
+		ToPeer:     to,
+		ID:         []int{id},
+		RandomID:   []int64{rand.Int64()},
+		DropAuthor: dropAuthor,
+	})
+	if err != nil {
+		return 0, err
+	}
+	sentID, ok := botutils.SentMessageID(res)
+	if !ok {
+		return 0, errors.New("forwarded message not found")
+	}
+	return sentID, nil
+}
+
+func (sd *SupportDesk) postToGroup(ctx context.Context, replyTo int, text string) (int, error) {
+	group, err := sd.groupPeer(ctx)
+	if err != nil {
+		return 0, err
+	}
+	builder := sd.sender.To(group)
+	if replyTo != 0 {
+		builder.Reply(replyTo)
+	}
+	res, err := builder.Text(ctx, text)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := botutils.SentMessageID(res)
+	return id, nil
+}
+
+func (sd *SupportDesk) notifyUser(ctx context.Context, userID int64, text string) {
+	peer, err := botutils.GetUserPeer(sd.peers, ctx, userID)
+	if err != nil {
+		slog.Warn("Failed to resolve user", "user", userID, "error", err)
+		return
+	}
+	if _, err := sd.sender.To(peer.InputPeer()).Text(ctx, text); err != nil {
+		slog.Error("Failed to send ticket message", "user", userID, "error", err)
+	}
+}
+
+// announce posts the header of a new ticket to the support group, replying to
+// it answers the ticket like replying to its messages.
+func (sd *SupportDesk) announce(ctx context.Context, t *repo.Ticket, u *user.TgUser, userMessageID int) error {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if u.Username != "" {
+		name += " @" + u.Username
+	}
+	text := fmt.Sprintf("🎫 Ticket #%d from %s (ID: %d)\n%s\n\nReply to the messages of this ticket to answer, /close %d closes it.",
+		t.ID, name, t.UserID, t.Subject, t.ID)
+	id, err := sd.postToGroup(ctx, 0, text)
+	if err != nil {
+		return err
+	}
+	return sd.ticketService.AddMessage(ctx, t.ID, t.UserID, id, userMessageID)
+}
+
+// relayToGroup forwards a message of the user's chat to the support group.
+func (sd *SupportDesk) relayToGroup(ctx context.Context, t *repo.Ticket, userPeer tg.InputPeerClass, messageID int) error {
+	group, err := sd.groupPeer(ctx)
+	if err != nil {
+		return err
+	}
+	groupID, err := sd.forward(ctx, userPeer, group, messageID, false)
+	if err != nil {
+		return err
+	}
+	return sd.ticketService.AddMessage(ctx, t.ID, t.UserID, groupID, messageID)
+}
+
+// closeTicket closes a ticket and tells the side which didn't close it.
+func (sd *SupportDesk) closeTicket(ctx context.Context, id, closedBy int64, byStaff bool) (*repo.Ticket, error) {
+	t, err := sd.ticketService.Close(ctx, id, closedBy)
+	if err != nil {
+		return nil, err
+	}
+	by := "the user"
+	if byStaff {
+		by = fmt.Sprintf("staff %d", closedBy)
+		sd.notifyUser(ctx, t.UserID, fmt.Sprintf("Your ticket #%d was closed by support. Send /support to open a new one.", t.ID))
+	}
+	if _, err := sd.postToGroup(ctx, 0, fmt.Sprintf("Ticket #%d was closed by %s.", t.ID, by)); err != nil {
+		slog.Error("Failed to post to support group", "ticket", t.ID, "error", err)
+	}
+	return t, nil
+}
+
+// HandleGroupMessage routes the answers of staff in the support group to the
+// user of their ticket and runs /close there. Messages of members without
+// PermTickets are ignored.
+func (sd *SupportDesk) HandleGroupMessage(ctx context.Context, m *tg.Message) error {
+	from, ok := m.FromID.(*tg.PeerUser)
+	if !ok || !userRole(ctx, sd.cfg, sd.adminService, from.UserID).Can(PermTickets) {
+		return nil
+	}
+	var replyTo int
+	if h, ok := m.ReplyTo.(*tg.MessageReplyHeader); ok {
+		replyTo = h.ReplyToMsgID
+	}
+	fields := strings.Fields(m.Message)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "/") {
+		if name, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@"); strings.ToLower(name) == "close" {
+			return sd.closeFromGroup(ctx, m.ID, fields, replyTo, from.UserID)
+		}
+		return nil
+	}
+	if replyTo == 0 {
+		return nil
+	}
+	t, err := sd.ticketService.ByGroupMessage(ctx, replyTo)
+	if err != nil {
+		if errors.Is(err, types.ErrorNotFound) {
+			return nil
+		}
+		return err
+	}
+	if t.Status != ticketsvc.StatusOpen {
+		_, err := sd.postToGroup(ctx, m.ID, fmt.Sprintf("Ticket #%d is closed!", t.ID))
+		return err
+	}
+	group, err := sd.groupPeer(ctx)
+	if err != nil {
+		return err
+	}
+	userPeer, err := botutils.GetUserPeer(sd.peers, ctx, t.UserID)
+	if err != nil {
+		_, err := sd.postToGroup(ctx, m.ID, fmt.Sprintf("Failed to answer ticket #%d! Err : %s", t.ID, err.Error()))
+		return err
+	}
+	userMessageID, err := sd.forward(ctx, group, userPeer.InputPeer(), m.ID, true)
+	if err != nil {
+		_, err := sd.postToGroup(ctx, m.ID, fmt.Sprintf("Failed to answer ticket #%d! Err : %s", t.ID, err.Error()))
+		return err
+	}
+	return sd.ticketService.AddMessage(ctx, t.ID, from.UserID, m.ID, userMessageID)
+}
+
+// closeFromGroup closes the ticket of /close <ticket id> or of the message
+// /close replies to.
+func (sd *SupportDesk) closeFromGroup(ctx context.Context, messageID int, fields []string, replyTo int, staffID int64) error {
+	var id int64
+	switch {
+	case len(fields) > 1:
+		var err error
+		if id, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			_, err := sd.postToGroup(ctx, messageID, "Usage: /close <ticket id> or reply to a message of the ticket")
+			return err
+		}
+	case replyTo != 0:
+		t, err := sd.ticketService.ByGroupMessage(ctx, replyTo)
+		if err != nil && !errors.Is(err, types.ErrorNotFound) {
+			return err
+		}
+		if t != nil {
+			id = t.ID
+		}
+	}
+	if id == 0 {
+		_, err := sd.postToGroup(ctx, messageID, "Usage: /close <ticket id> or reply to a message of the ticket")
+		return err
+	}
+	if _, err := sd.closeTicket(ctx, id, staffID, true); err != nil {
+		text := fmt.Sprintf("Failed to close the ticket! Err : %s", err.Error())
+		if errors.Is(err, types.ErrorNotFound) {
+			text = "Ticket not found or already closed!"
+		}
+		_, err := sd.postToGroup(ctx, messageID, text)
+		return err
+	}
+	return nil
+}
+
+// HandleSupport opens a ticket or adds to the open one, /support <message> or
+// /support as a reply to the message to send.
+func (bc *Context) HandleSupport() (tg.UpdatesClass, error) {
+	if bc.Role() > RoleUser {
+		return bc.Reply("Staff answers tickets in the support group!")
+	}
+	if bc.cfg.SUPPORT_GROUP_ID == 0 {
+		return bc.Reply("Support isn't available right now! please try again later")
+	}
+	_, text, _ := strings.Cut(strings.TrimSpace(bc.msg.Message), " ")
+	text = strings.TrimSpace(text)
+	var ids []int
+	switch reply := bc.msg.ReplyTo.(type) {
+	case *tg.MessageReplyHeader:
+		ids = append(ids, reply.ReplyToMsgID)
+	case *tg.MessageReplyStoryHeader:
+		return bc.Reply("can't report story")
+	}
+	if text != "" {
+		ids = append(ids, bc.msg.ID)
+	}
+	if len(ids) == 0 {
+		return bc.Reply(supportUsage)
+	}
+	subject := "Reported message"
+	if text != "" {
+		subject = text
+		if r := []rune(subject); len(r) > TicketSubjectLen {
+			subject = string(r[:TicketSubjectLen]) + "…"
+		}
+	}
+	t, created, err := bc.ticketService.Open(bc.ctx, bc.userInfo.ID, subject)
+	if err != nil {
+		slog.Error("Failed to open ticket", "user", bc.userInfo.ID, "error", err)
+		return bc.Reply(fmt.Sprintf("Failed to open a ticket! Err : %s", err.Error()))
+	}
+	sd := bc.supportDesk()
+	if created {
+		if err := sd.announce(bc.ctx, t, bc.userInfo, bc.msg.ID); err != nil {
+			slog.Error("Failed to announce ticket", "ticket", t.ID, "error", err)
+			return bc.Reply("Failed to reach support! please try again later")
+		}
+	}
+	for _, id := range ids {
+		if err := sd.relayToGroup(bc.ctx, t, bc.inputPeer(), id); err != nil {
+			slog.Error("Failed to relay ticket message", "ticket", t.ID, "error", err)
+			return bc.Reply("Failed to reach support! please try again later")
+		}
+	}
+	if created {
+		return bc.Reply(fmt.Sprintf("Ticket #%d opened! Support answers here, reply to their answers to add more.\n/close closes the ticket.", t.ID))
+	}
+	return bc.Reply(fmt.Sprintf("Sent to your ticket #%d!", t.ID))
+}
+
+// SupportReply returns the command relaying a reply of the user to an answer
+// of support to its ticket. Commands sent as replies run as usual.
+func SupportReply(bc *Context) (*Command, bool) {
+	h, ok := bc.msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || bc.cfg.SUPPORT_GROUP_ID == 0 || strings.HasPrefix(strings.TrimSpace(bc.msg.Message), "/") {
+		return nil, false
+	}
+	t, err := bc.ticketService.ByUserMessage(bc.ctx, bc.userInfo.ID, h.ReplyToMsgID)
+	if err != nil {
+		if !errors.Is(err, types.ErrorNotFound) {
+			slog.Error("Failed to get ticket", "user", bc.userInfo.ID, "error", err)
+		}
+		return nil, false
+	}
+	return &Command{
+		Name:   "support.reply",
+		Hidden: true,
+		Handler: func(bc *Context) (tg.UpdatesClass, error) {
+			if t.Status != ticketsvc.StatusOpen {
+				return bc.Reply(fmt.Sprintf("Ticket #%d is closed! Send /support to open a new one.", t.ID))
+			}
+			if err := bc.supportDesk().relayToGroup(bc.ctx, t, bc.inputPeer(), bc.msg.ID); err != nil {
+				slog.Error("Failed to relay ticket message", "ticket", t.ID, "error", err)
+				return bc.Reply("Failed to reach support! please try again later")
+			}
+			return bc.Reply(fmt.Sprintf("Sent to your ticket #%d!", t.ID))
+		},
+	}, true
+}
+
+// HandleClose closes the user's open ticket, staff closes any ticket with
+// /close <ticket id>.
+func (bc *Context) HandleClose() (tg.UpdatesClass, error) {
+	sd := bc.supportDesk()
+	if bc.Can(PermTickets) {
+		args := strings.Fields(bc.msg.Message)
+		if len(args) < 2 {
+			return bc.Reply("Usage: /close <ticket id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return bc.Reply("Invalid ticket id!")
+		}
+		t, err := sd.closeTicket(bc.ctx, id, bc.userInfo.ID, true)
+		if err != nil {
+			if errors.Is(err, types.ErrorNotFound) {
+				return bc.Reply("Ticket not found or already closed!")
+			}
+			return bc.Reply(fmt.Sprintf("Failed to close the ticket! Err : %s", err.Error()))
+		}
+		return bc.Reply(fmt.Sprintf("Ticket #%d closed!", t.ID))
+	}
+	t, err := bc.ticketService.Current(bc.ctx, bc.userInfo.ID)
+	if err == nil {
+		t, err = sd.closeTicket(bc.ctx, t.ID, bc.userInfo.ID, false)
+	}
+	if err != nil {
+		if errors.Is(err, types.ErrorNotFound) {
+			return bc.Reply("You have no open ticket!")
+		}
+		return bc.Reply(fmt.Sprintf("Failed to close the ticket! Err : %s", err.Error()))
+	}
+	return bc.Reply(fmt.Sprintf("Ticket #%d closed! Thanks for reaching out :)", t.ID))
+}
+
+// HandleTickets lists the tickets of the user, staff gets every ticket with
+// /tickets [open|closed|all].
+func (bc *Context) HandleTickets() (tg.UpdatesClass, error) {
+	if !bc.Can(PermTickets) {
+		tickets, err := bc.ticketService.ByUser(bc.ctx, bc.userInfo.ID, TicketListSize)
+		if err != nil {
+			return bc.Reply(fmt.Sprintf("Failed to get your tickets! Err : %s", err.Error()))
+		}
+		if len(tickets) == 0 {
+			return bc.Reply("You have no tickets yet.\n\n" + supportUsage)
+		}
+		var sb strings.Builder
+		sb.WriteString("Your tickets:\n")
+		for _, t := range tickets {
+			sb.WriteString(fmt.Sprintf("\n#%d - %s - %s", t.ID, t.Status, t.Subject))
+		}
+		return bc.Reply(sb.String())
+	}
+	status := ticketsvc.StatusOpen
+	if args := strings.Fields(bc.msg.Message); len(args) > 1 {
+		switch strings.ToLower(args[1]) {
+		case ticketsvc.StatusOpen:
+		case ticketsvc.StatusClosed:
+			status = ticketsvc.StatusClosed
+		case "all":
+			status = ""
+		default:
+			return bc.Reply("Usage: /tickets [open|closed|all]")
+		}
+	}
+	tickets, err := bc.ticketService.List(bc.ctx, status, TicketListSize)
+	if err != nil {
+		return bc.Reply(fmt.Sprintf("Failed to get tickets! Err : %s", err.Error()))
+	}
+	if len(tickets) == 0 {
+		return bc.Reply("No tickets!")
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Tickets (%d):\n", len(tickets)))
+	for _, t := range tickets {
+		sb.WriteString(fmt.Sprintf("\n#%d - %s - user %d - %s, updated %s", t.ID, t.Status, t.UserID, t.Subject, t.UpdatedAt.Time.Format("2006-01-02 15:04")))
+	}
+	return bc.Reply(sb.String())
+}
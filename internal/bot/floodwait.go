@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	MaxFloodRetries int = 3
+)
+
+// floodGuard is an invoker middleware applied to every client. Short FLOOD_WAITs
+// are slept through and retried, long ones fail fast and put the bot into
+// cooldown so the balancer prefers other bots. It also spaces requests out to
+// honour the per-bot rate limit, except the file downloads of streams.
+type floodGuard struct {
+	maxSleep time.Duration
+	interval time.Duration
+
+	mu            sync.Mutex
+	nextRequest   time.Time
+	cooldownUntil time.Time
+}
+
+// newFloodGuard creates a guard sleeping through waits up to maxSleep and
+// allowing rps requests per second, rps <= 0 disables the rate limit.
+func newFloodGuard(maxSleep time.Duration, rps float64) *floodGuard {
+	f := &floodGuard{maxSleep: maxSleep}
+	if rps > 0 {
+		f.interval = time.Duration(float64(time.Second) / rps)
+	}
+	return f
+}
+
+func (f *floodGuard) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		// streams download in many small parts, spacing them out would throttle
+		// every stream with the rate limit
+		_, download := input.(*tg.UploadGetFileRequest)
+		for attempt := 0; ; attempt++ {
+			if !download {
+				if err := f.waitTurn(ctx); err != nil {
+					return err
+				}
+			}
+			err := next.Invoke(ctx, input, output)
+			wait, ok := tgerr.AsFloodWait(err)
+			if !ok {
+				return err
+			}
+			if wait > f.maxSleep || attempt >= MaxFloodRetries {
+				f.coolDown(wait)
+				slog.Warn("Flood wait too long, cooling down", "wait", wait, "request", requestName(input))
+				return err
+			}
+
+			slog.Warn("Flood wait, retrying", "wait", wait, "request", requestName(input))
+			timer := time.NewTimer(wait + time.Second)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// waitTurn blocks until the rate limit allows the next request.
+func (f *floodGuard) waitTurn(ctx context.Context) error {
+	if f.interval <= 0 {
+		return nil
+	}
+	f.mu.Lock()
+	now := time.Now()
+	if f.nextRequest.Before(now) {
+		f.nextRequest = now
+	}
+	wait := f.nextRequest.Sub(now)
+	f.nextRequest = f.nextRequest.Add(f.interval)
+	f.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *floodGuard) coolDown(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if until := time.Now().Add(d); until.After(f.cooldownUntil) {
+		f.cooldownUntil = until
+	}
+}
+
+// cooldownLeft returns how long the bot is still cooling down.
+func (f *floodGuard) cooldownLeft() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return max(time.Until(f.cooldownUntil), 0)
+}
+
+func requestName(input bin.Encoder) string {
+	if obj, ok := input.(interface{ TypeName() string }); ok {
+		return obj.TypeName()
+	}
+	return "unknown"
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/biisal/fast-stream-bot/internal/service/bottoken"
+	"github.com/biisal/fast-stream-bot/internal/types"
+)
+
+const (
+	AddBotTimeoutSec int = 30
+	DrainTimeoutSec  int = 600
+)
+
+// AddBot starts a new worker client for token, waits for it to come up and
+// stores the token so it is started again on the next boot. It returns the
+// username of the started bot.
+func (w *Worker) AddBot(ctx context.Context, token string, addedBy int64) (string, error) {
+	token = strings.TrimSpace(token)
+	w.mut.Lock()
+	for _, slot := range w.slots {
+		if slot.token == token {
+			w.mut.Unlock()
+			return "", fmt.Errorf("this bot is already running")
+		}
+	}
+	w.mut.Unlock()
+
+	started := make(chan error, 1)
+	slot := w.startSlot(token, false, func(err error) { started <- err })
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(AddBotTimeoutSec)*time.Second)
+	defer cancel()
+	select {
+	case err := <-started:
+		if err != nil {
+			slot.cancel()
+			return "", err
+		}
+	case <-waitCtx.Done():
+		slot.cancel()
+		return "", fmt.Errorf("bot did not start in %ds", AddBotTimeoutSec)
+	}
+
+	w.mut.Lock()
+	username := slot.bot.BotUserName
+	w.mut.Unlock()
+
+	if err := w.tokenService.Add(ctx, token, username, addedBy); err != nil && !errors.Is(err, bottoken.ErrDuplicate) {
+		slog.Error("Failed to store bot token", "bot_username", username, "error", err)
+		return username, fmt.Errorf("bot is running but its token was not saved, it will be gone after restart: %w", err)
+	}
+	return username, nil
+}
+
+// RemoveBot takes the bot out of rotation, forgets its stored token and stops
+// it in the background once its running streams are done or DrainTimeoutSec
+// passed. The default bot can't be removed since it handles user messages.
+func (w *Worker) RemoveBot(ctx context.Context, username string) (types.BotStatus, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+
+	w.mut.Lock()
+	var slot *workerSlot
+	for _, s := range w.slots {
+		if s.bot != nil && strings.EqualFold(s.bot.BotUserName, username) {
+			slot = s
+			break
+		}
+	}
+	if slot == nil {
+		w.mut.Unlock()
+		return types.BotStatus{}, fmt.Errorf("no running bot with username @%s", username)
+	}
+	if slot.bot.Default {
+		w.mut.Unlock()
+		return types.BotStatus{}, fmt.Errorf("@%s is the default bot and can't be removed", username)
+	}
+	if slot.userbot {
+		w.mut.Unlock()
+		return types.BotStatus{}, fmt.Errorf("@%s is a userbot, remove it from USERBOT_PHONES instead", username)
+	}
+	if slot.draining {
+		w.mut.Unlock()
+		return types.BotStatus{}, fmt.Errorf("@%s is already being removed", username)
+	}
+	slot.draining = true
+	status := w.slotStatus(slot)
+	w.mut.Unlock()
+
+	w.removeBot(slot.bot)
+	if _, err := w.tokenService.RemoveByUsername(ctx, username); err != nil {
+		slog.Error("Failed to delete stored bot token", "bot_username", username, "error", err)
+	}
+
+	go w.drain(slot)
+	return status, nil
+}
+
+func (w *Worker) drain(slot *workerSlot) {
+	deadline := time.Now().Add(time.Duration(DrainTimeoutSec) * time.Second)
+	for time.Now().Before(deadline) {
+		w.mut.Lock()
+		pressure := slot.bot.WorkingPressure
+		w.mut.Unlock()
+		if pressure <= 0 {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	slot.cancel()
+
+	w.mut.Lock()
+	name := slot.name()
+	w.mut.Unlock()
+	slog.Info("Bot removed", "bot", name)
+	w.notify(fmt.Sprintf("⚪ %s was removed from the worker pool", name))
+}
+
+// BotsStatus returns a snapshot of every supervised bot.
+func (w *Worker) BotsStatus() []types.BotStatus {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	statuses := make([]types.BotStatus, 0, len(w.slots))
+	for _, slot := range w.slots {
+		statuses = append(statuses, w.slotStatus(slot))
+	}
+	return statuses
+}
+
+// slotStatus must be called with w.mut held.
+func (w *Worker) slotStatus(slot *workerSlot) types.BotStatus {
+	status := types.BotStatus{
+		Username: slot.name(),
+		FromEnv:  slot.fromEnv,
+		Userbot:  slot.userbot,
+		Draining: slot.draining,
+	}
+	if slot.bot == nil {
+		return status
+	}
+	status.Default = slot.bot.Default
+	status.Pressure = slot.bot.WorkingPressure
+	status.Cooldown = slot.bot.CooldownLeft()
+	pool := w.Bots
+	if slot.userbot {
+		pool = w.Userbots
+	}
+	for _, b := range pool {
+		if b == slot.bot {
+			status.InRotation = true
+			break
+		}
+	}
+	return status
+}
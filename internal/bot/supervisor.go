@@ -0,0 +1,339 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/peerstore"
+	"github.com/biisal/fast-stream-bot/internal/service/bottoken"
+	"github.com/biisal/fast-stream-bot/internal/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	HealthCheckIntervalSec int = 60
+	HealthCheckTimeoutSec  int = 10
+	MaxHealthCheckFailures int = 3
+	MinRestartBackoffSec   int = 5
+	MaxRestartBackoffSec   int = 300
+)
+
+var errUnhealthy = errors.New("bot failed health checks")
+
+// isBrokenSession reports errors after which the stored session can't be used
+// anymore and the client has to authorize with a fresh auth key.
+func isBrokenSession(err error) bool {
+	return tgerr.Is(err, "AUTH_KEY_DUPLICATED", "AUTH_KEY_INVALID", "AUTH_KEY_PERM_EMPTY")
+}
+
+// isFatalAuthError reports errors that will not go away by restarting the client,
+// e.g. a revoked or mistyped bot token.
+func isFatalAuthError(err error) bool {
+	return tgerr.Is(err, tg.ErrAccessTokenInvalid, tg.ErrAccessTokenExpired) ||
+		errors.Is(err, errUserbotNotLoggedIn)
+}
+
+// workerSlot tracks one supervised bot token, or userbot phone, across client
+// restarts.
+type workerSlot struct {
+	token   string
+	num     int
+	fromEnv bool
+	userbot bool
+	cancel  context.CancelFunc
+	session session.Storage
+	// bot is the latest client started for token and draining marks a slot
+	// being removed, both are guarded by Worker.mut.
+	bot      *Bot
+	draining bool
+}
+
+func (s *workerSlot) name() string {
+	if s.bot != nil && s.bot.BotUserName != "" {
+		return "@" + s.bot.BotUserName
+	}
+	if s.userbot {
+		return fmt.Sprintf("userbot #%d", s.num)
+	}
+	return fmt.Sprintf("worker #%d", s.num)
+}
+
+// startSlot registers botToken and supervises it in the background until the
+// slot is cancelled. ready is called once with the outcome of the first attempt.
+func (w *Worker) startSlot(botToken string, fromEnv bool, ready func(error)) *workerSlot {
+	return w.start(&workerSlot{
+		token:   botToken,
+		fromEnv: fromEnv,
+		session: w.sessions(bottoken.HashToken(botToken)),
+	}, ready)
+}
+
+// startUserbotSlot supervises the user account logged in with phone.
+func (w *Worker) startUserbotSlot(phone string, ready func(error)) *workerSlot {
+	return w.start(&workerSlot{
+		token:   normalizePhone(phone),
+		fromEnv: true,
+		userbot: true,
+		session: w.sessions(UserbotSessionKey(phone)),
+	}, ready)
+}
+
+func (w *Worker) start(slot *workerSlot, ready func(error)) *workerSlot {
+	ctx, cancel := context.WithCancel(w.ctx)
+	slot.cancel = cancel
+	w.mut.Lock()
+	slot.num = w.nextWorkerNum
+	w.nextWorkerNum++
+	w.slots = append(w.slots, slot)
+	w.mut.Unlock()
+
+	var once sync.Once
+	go func() {
+		defer w.removeSlot(slot)
+		w.supervise(ctx, slot, func(err error) { once.Do(func() { ready(err) }) })
+	}()
+	return slot
+}
+
+func (w *Worker) removeSlot(slot *workerSlot) {
+	slot.cancel()
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	for i, s := range w.slots {
+		if s == slot {
+			w.slots = append(w.slots[:i], w.slots[i+1:]...)
+			break
+		}
+	}
+}
+
+// supervise keeps the slot's client running until ctx is done. Every time the
+// client stops (connection loss, failed health checks, auth errors) it is
+// restarted with exponential backoff.
+func (w *Worker) supervise(ctx context.Context, slot *workerSlot, ready func(error)) {
+	minBackoff := time.Duration(MinRestartBackoffSec) * time.Second
+	maxBackoff := time.Duration(MaxRestartBackoffSec) * time.Second
+	backoff := minBackoff
+
+	for {
+		startedAt := time.Now()
+		err := w.runClient(ctx, slot, ready)
+		if ctx.Err() != nil {
+			ready(ctx.Err())
+			return
+		}
+		if err == nil {
+			err = errors.New("client stopped")
+		}
+		ready(err)
+
+		w.mut.Lock()
+		name := slot.name()
+		w.mut.Unlock()
+		if isBrokenSession(err) {
+			slog.Warn("Dropping broken session", "bot", name, "error", err)
+			if err := slot.session.Reset(ctx); err != nil {
+				slog.Error("Failed to drop session", "bot", name, "error", err)
+			}
+		}
+		if isFatalAuthError(err) {
+			slog.Error("Bot token rejected, giving up", "bot", name, "error", err)
+			w.notify(fmt.Sprintf("🔴 %s stopped: bot token rejected by Telegram (%v)", name, err))
+			return
+		}
+
+		if time.Since(startedAt) > maxBackoff {
+			backoff = minBackoff
+		}
+		slog.Error("Bot stopped, restarting", "bot", name, "error", err, "backoff", backoff)
+		w.notify(fmt.Sprintf("🟠 %s stopped: %v\nRestarting in %s", name, err, backoff))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// runClient builds a fresh client for the slot and blocks until it stops.
+func (w *Worker) runClient(ctx context.Context, slot *workerSlot, ready func(error)) error {
+	dispatcher := tg.NewUpdateDispatcher()
+	flood := newFloodGuard(time.Duration(w.cfg.MAX_FLOOD_WAIT)*time.Second, w.cfg.RPC_RATE_LIMIT)
+	middlewares := []telegram.Middleware{flood}
+	account := peerstore.AccountFromToken(slot.token)
+	if slot.userbot {
+		middlewares = []telegram.Middleware{sendGuard{}, flood}
+		account = peerstore.AccountFromPhone(slot.token)
+	}
+	// the peer manager needs the client's API, so the update handler is set
+	// after the client is built. Updates go through its hook so peers seen in
+	// updates are stored too.
+	var updates telegram.UpdateHandler = dispatcher
+	client := telegram.NewClient(w.cfg.APP_KEY, w.cfg.APP_HASH, telegram.Options{
+		UpdateHandler: telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
+			return updates.Handle(ctx, u)
+		}),
+		SessionStorage: slot.session,
+		Middlewares:    middlewares,
+	})
+	store := peerstore.New(w.redis, account, time.Duration(PeerCacheTTLSec)*time.Second)
+	peerManager := store.Manager(client.API())
+	updates = peerManager.UpdateHook(dispatcher)
+
+	isDefault := slot.num == 0 && !slot.userbot
+	bot := NewBot(ctx, w.cfg, client, &dispatcher, w.userService, w.fileService, isDefault)
+	bot.Peers = peerManager
+	bot.Userbot = slot.userbot
+	bot.worker = w
+	bot.slot = slot
+	bot.flood = flood
+	if isDefault {
+		bot.SetUpOnMessage()
+		bot.SetUpOnCallback()
+		bot.SetUpOnInline()
+		bot.SetUpOnChannelPost()
+		bot.SetUpOnJoinRequest()
+	}
+
+	return client.Run(ctx, func(ctx context.Context) error {
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return err
+		}
+		if !status.Authorized {
+			if slot.userbot {
+				return errUserbotNotLoggedIn
+			}
+			if _, err := client.Auth().Bot(ctx, slot.token); err != nil {
+				return err
+			}
+		}
+		self, err := client.Self(ctx)
+		if err != nil {
+			return err
+		}
+		if err := peerManager.Init(ctx); err != nil {
+			return err
+		}
+		if self.Bot || slot.userbot {
+			bot.BotUserName = self.Username
+		}
+		if slot.userbot {
+			warmPeers(ctx, bot)
+		}
+		if isDefault {
+			bot.syncMenu(ctx)
+			bot.approveJoinRequests(ctx)
+		}
+
+		w.mut.Lock()
+		slot.bot = bot
+		name := slot.name()
+		w.mut.Unlock()
+
+		w.addBot(bot)
+		defer w.removeBot(bot)
+		slog.Info("Bot started", "bot_username", bot.BotUserName)
+		w.notify(fmt.Sprintf("🟢 %s is running", name))
+		ready(nil)
+
+		return w.healthCheck(ctx, bot, name)
+	})
+}
+
+// healthCheck pings Telegram periodically. A bot failing a check is taken out of
+// rotation until it passes again; after MaxHealthCheckFailures consecutive
+// failures errUnhealthy is returned so the supervisor restarts the client.
+func (w *Worker) healthCheck(ctx context.Context, bot *Bot, name string) error {
+	ticker := time.NewTicker(time.Duration(HealthCheckIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, time.Duration(HealthCheckTimeoutSec)*time.Second)
+		_, err := bot.Client.API().HelpGetConfig(checkCtx)
+		cancel()
+		if err == nil {
+			if failures > 0 {
+				w.addBot(bot)
+				slog.Info("Bot recovered", "bot", name)
+				w.notify(fmt.Sprintf("🟢 %s recovered and is back in rotation", name))
+			}
+			failures = 0
+			continue
+		}
+
+		failures++
+		slog.Warn("Bot health check failed", "bot", name, "failures", failures, "error", err)
+		if failures == 1 {
+			w.removeBot(bot)
+			w.notify(fmt.Sprintf("🟡 %s failed a health check and was removed from rotation: %v", name, err))
+		}
+		if failures >= MaxHealthCheckFailures {
+			return fmt.Errorf("%w: %v", errUnhealthy, err)
+		}
+	}
+}
+
+// notify reports a worker state change to the log channel, or to the admin when
+// no log channel is configured, using any bot that is still in rotation.
+func (w *Worker) notify(msg string) {
+	sender := w.DefaultBot()
+	if sender == nil {
+		w.mut.Lock()
+		if len(w.Bots) > 0 {
+			sender = w.Bots[0]
+		}
+		w.mut.Unlock()
+	}
+	if sender == nil {
+		slog.Warn("No bot available to send worker status", "message", msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if w.cfg.LOG_CHANNEL_ID != 0 {
+		if err := botutils.SendLogMessage(ctx, sender.Peers, sender.Sender, w.cfg.LOG_CHANNEL_ID, msg); err == nil {
+			return
+		}
+	}
+	if _, err := sender.Sender.To(&tg.InputPeerUser{UserID: w.cfg.ADMIN_ID}).Text(ctx, msg); err != nil {
+		slog.Error("Failed to send worker status to admin", "error", err)
+	}
+}
+
+// NotifyUser sends msg to a user of the bot, e.g. the owner of a file, using
+// the default bot.
+func (w *Worker) NotifyUser(userID int64, msg string) {
+	bot := w.DefaultBot()
+	if bot == nil || bot.Peers == nil {
+		slog.Warn("No bot available to notify user", "user", userID)
+		return
+	}
+	ctx, cancel := context.WithTimeout(w.ctx, 10*time.Second)
+	defer cancel()
+	peer, err := botutils.GetUserPeer(bot.Peers, ctx, userID)
+	if err != nil {
+		slog.Error("Failed to get user peer", "user", userID, "error", err)
+		return
+	}
+	if _, err := bot.Sender.To(peer.InputPeer()).Text(ctx, msg); err != nil {
+		slog.Error("Failed to notify user", "user", userID, "error", err)
+	}
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/biisal/fast-stream-bot/config"
+	"github.com/biisal/fast-stream-bot/internal/service/bottoken"
+	"github.com/biisal/fast-stream-bot/internal/session"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	UserbotDialogsLimit int = 100
+)
+
+var (
+	errUserbotNotLoggedIn = errors.New("userbot is not logged in, run with -login-userbot first")
+	errUserbotSend        = errors.New("userbots are not allowed to send or change messages")
+)
+
+// UserbotSessionKey returns the session key of the user account logged in with
+// phone.
+func UserbotSessionKey(phone string) string {
+	return "userbot_" + bottoken.HashToken(normalizePhone(phone))
+}
+
+func normalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+}
+
+// sendGuard is an invoker middleware applied to userbots. A user account
+// sending messages risks getting banned, so every request that sends, edits or
+// deletes messages is refused before it reaches Telegram.
+type sendGuard struct{}
+
+func (sendGuard) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		switch input.(type) {
+		case *tg.MessagesSendMessageRequest,
+			*tg.MessagesSendMediaRequest,
+			*tg.MessagesSendMultiMediaRequest,
+			*tg.MessagesForwardMessagesRequest,
+			*tg.MessagesSendInlineBotResultRequest,
+			*tg.MessagesSendReactionRequest,
+			*tg.MessagesEditMessageRequest,
+			*tg.MessagesDeleteMessagesRequest,
+			*tg.ChannelsDeleteMessagesRequest:
+			slog.Error("Blocked userbot request", "request", requestName(input))
+			return errUserbotSend
+		}
+		return next.Invoke(ctx, input, output)
+	}
+}
+
+// warmPeers stores the peers of the userbot's recent dialogs. Unlike bots a
+// user account can't resolve a channel without its access hash, so the DB
+// channel has to be seen in a dialog first.
+func warmPeers(ctx context.Context, bot *Bot) {
+	dialogs, err := bot.Client.API().MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+		OffsetPeer: &tg.InputPeerEmpty{},
+		Limit:      UserbotDialogsLimit,
+	})
+	if err != nil {
+		slog.Warn("Failed to load userbot dialogs", "error", err)
+		return
+	}
+	modified, ok := dialogs.AsModified()
+	if !ok {
+		return
+	}
+	if err := bot.Peers.Apply(ctx, modified.GetUsers(), modified.GetChats()); err != nil {
+		slog.Warn("Failed to store userbot peers", "error", err)
+	}
+}
+
+// LoginUserbot logs the user account with phone in from the terminal and
+// stores its session, so it can be started as a worker with USERBOT_PHONES.
+func LoginUserbot(ctx context.Context, cfg *config.Config, sessions session.Factory, phone string) error {
+	phone = normalizePhone(phone)
+	client := telegram.NewClient(cfg.APP_KEY, cfg.APP_HASH, telegram.Options{
+		SessionStorage: sessions(UserbotSessionKey(phone)),
+	})
+	return client.Run(ctx, func(ctx context.Context) error {
+		in := bufio.NewReader(os.Stdin)
+		flow := auth.NewFlow(terminalAuth{phone: phone, in: in}, auth.SendCodeOptions{})
+		if err := client.Auth().IfNecessary(ctx, flow); err != nil {
+			return err
+		}
+		self, err := client.Self(ctx)
+		if err != nil {
+			return err
+		}
+		if self.Bot {
+			return fmt.Errorf("%s is a bot, add it to BOT_TOKENS instead", phone)
+		}
+		fmt.Printf("Logged in as %s (%d). Add %s to USERBOT_PHONES to use it as a worker.\n",
+			strings.TrimSpace(self.FirstName+" "+self.LastName), self.ID, phone)
+		return nil
+	})
+}
+
+// terminalAuth asks for the login code and 2FA password on stdin.
+type terminalAuth struct {
+	phone string
+	in    *bufio.Reader
+}
+
+func (t terminalAuth) prompt(label string) (string, error) {
+	fmt.Print(label)
+	line, err := t.in.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func (t terminalAuth) Phone(_ context.Context) (string, error) {
+	return t.phone, nil
+}
+
+func (t terminalAuth) Password(_ context.Context) (string, error) {
+	return t.prompt("Enter 2FA password: ")
+}
+
+func (t terminalAuth) Code(_ context.Context, _ *tg.AuthSentCode) (string, error) {
+	return t.prompt("Enter the code Telegram sent you: ")
+}
+
+func (t terminalAuth) AcceptTermsOfService(_ context.Context, _ tg.HelpTermsOfService) error {
+	return errors.New("this phone has no Telegram account, sign up in an official app first")
+}
+
+func (t terminalAuth) SignUp(_ context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{}, errors.New("sign up is not supported")
+}
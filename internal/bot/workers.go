@@ -8,79 +8,116 @@ import (
 	"time"
 
 	"github.com/biisal/fast-stream-bot/config"
+	"github.com/biisal/fast-stream-bot/internal/bot/callback"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	adminsvc "github.com/biisal/fast-stream-bot/internal/service/admin"
+	"github.com/biisal/fast-stream-bot/internal/service/bottoken"
+	broadcastsvc "github.com/biisal/fast-stream-bot/internal/service/broadcast"
+	chansvc "github.com/biisal/fast-stream-bot/internal/service/channel"
+	collsvc "github.com/biisal/fast-stream-bot/internal/service/collection"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	mirrorsvc "github.com/biisal/fast-stream-bot/internal/service/mirror"
+	ticketsvc "github.com/biisal/fast-stream-bot/internal/service/ticket"
 	"github.com/biisal/fast-stream-bot/internal/service/user"
-	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/tg"
+	"github.com/biisal/fast-stream-bot/internal/session"
 )
 
 const (
 	WorkingTimerSec int = 30
+	PeerCacheTTLSec int = 3600
 )
 
 type Worker struct {
 	Bots            []*Bot
+	Userbots        []*Bot // only hired for large files, see HireUserbot
 	mut             sync.Mutex
 	RunningBotIndex int
 	Timer           time.Time
+	ctx             context.Context
+	stop            context.CancelFunc
+	slots           []*workerSlot
+	nextWorkerNum   int
+	cfg             *config.Config
+	userService     user.Service
+	fileService     filesvc.Service
+	collections     collsvc.Service
+	channels        chansvc.Service
+	mirrors         mirrorsvc.Service
+	admins          adminsvc.Service
+	broadcasts      broadcastsvc.Service
+	tickets         ticketsvc.Service
+	tokenService    bottoken.Service
+	sessions        session.Factory
+	redis           rs.RedisService
+	callbacks       *callback.Codec
 }
 
-func initWorker() *Worker {
+func initWorker(ctx context.Context, cfg *config.Config, userService user.Service,
+	fileService filesvc.Service, collections collsvc.Service, channels chansvc.Service,
+	mirrors mirrorsvc.Service, admins adminsvc.Service, broadcasts broadcastsvc.Service, tickets ticketsvc.Service,
+	tokenService bottoken.Service,
+	sessions session.Factory, redis rs.RedisService,
+) *Worker {
 	return &Worker{
-		Timer: time.Now(),
+		Timer:        time.Now(),
+		ctx:          ctx,
+		cfg:          cfg,
+		userService:  userService,
+		fileService:  fileService,
+		collections:  collections,
+		channels:     channels,
+		mirrors:      mirrors,
+		admins:       admins,
+		broadcasts:   broadcasts,
+		tickets:      tickets,
+		tokenService: tokenService,
+		sessions:     sessions,
+		redis:        redis,
+		callbacks:    callback.NewCodec(cfg.CALLBACK_SECRET, redis),
 	}
 }
 
-func startClient(worker *Worker, botToken string, cfg *config.Config, workerNum int,
-	wg *sync.WaitGroup, userService user.Service,
-) {
-	done := false
-	defer func() {
-		if !done {
-			wg.Done()
-		}
-	}()
-	ctx := context.Background()
-	dispatcher := tg.NewUpdateDispatcher()
-	client := telegram.NewClient(cfg.APP_KEY, cfg.APP_HASH, telegram.Options{UpdateHandler: dispatcher})
-	isDefault := workerNum == 0
-	bot := NewBot(ctx, cfg, client, &dispatcher, userService, isDefault)
-	if isDefault {
-		bot.SetUpOnMessage()
-	}
-	if err := client.Run(ctx, func(ctx context.Context) error {
-		if _, err := client.Auth().Bot(ctx, botToken); err != nil {
-			return err
-		}
-		worker.mut.Lock()
-		worker.Bots = append(worker.Bots, bot)
-		worker.mut.Unlock()
-		self, err := client.Self(ctx)
-		if err != nil {
-			return err
-		}
-		if self.Bot {
-			bot.BotUserName = self.Username
-		}
-		slog.Info("Bot started", "bot_username", bot.BotUserName)
-		if _, err := bot.Sender.To(&tg.InputPeerUser{UserID: cfg.ADMIN_ID}).Text(ctx, "Bot is running"); err != nil {
-			slog.Error("Failed to send status message to admin", "error", err)
-		}
-		done = true
-		wg.Done()
-		<-ctx.Done()
-		return nil
-	}); err != nil {
-		slog.Error("Failed to start bot", "error", err)
-	}
+// StartWorkers starts a supervised client for every token from BOT_TOKENS and
+// every token added earlier with /addbot, and waits until each of them either
+// started or failed its first attempt.
+func StartWorkers(cfg *config.Config, userService user.Service,
+	fileService filesvc.Service, collections collsvc.Service, channels chansvc.Service,
+	mirrors mirrorsvc.Service, admins adminsvc.Service, broadcasts broadcastsvc.Service, tickets ticketsvc.Service,
+	tokenService bottoken.Service,
+	sessions session.Factory, redis rs.RedisService,
+) *Worker {
+	ctx, stop := context.WithCancel(context.Background())
+	worker := initWorker(ctx, cfg, userService, fileService, collections, channels, mirrors, admins, broadcasts, tickets, tokenService, sessions, redis)
+	worker.stop = stop
 
-}
+	storedTokens, err := tokenService.GetAll(ctx)
+	if err != nil {
+		slog.Error("Failed to load stored bot tokens", "error", err)
+	}
 
-func StartWorkers(cfg *config.Config, userService user.Service) *Worker {
-	worker := initWorker()
 	var wg sync.WaitGroup
-	for i, botToken := range cfg.BOT_TOKENS {
+	seen := make(map[string]bool)
+	start := func(botToken string, fromEnv bool) {
+		if botToken == "" || seen[botToken] {
+			return
+		}
+		seen[botToken] = true
+		wg.Add(1)
+		worker.startSlot(botToken, fromEnv, func(error) { wg.Done() })
+	}
+	for _, botToken := range cfg.BOT_TOKENS {
+		start(botToken, true)
+	}
+	for _, botToken := range storedTokens {
+		start(botToken, false)
+	}
+	for _, phone := range cfg.USERBOT_PHONES {
+		if phone == "" || seen[phone] {
+			continue
+		}
+		seen[phone] = true
 		wg.Add(1)
-		go startClient(worker, botToken, cfg, i, &wg, userService)
+		worker.startUserbotSlot(phone, func(error) { wg.Done() })
 	}
 	slog.Debug("Waiting for bot workers to start")
 	wg.Wait()
@@ -88,6 +125,64 @@ func StartWorkers(cfg *config.Config, userService user.Service) *Worker {
 	return worker
 }
 
+// Stop stops every client and the work running with them.
+func (w *Worker) Stop() {
+	w.stop()
+}
+
+func (w *Worker) addBot(bot *Bot) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if bot.slot != nil && bot.slot.draining {
+		return
+	}
+	pool := &w.Bots
+	if bot.Userbot {
+		pool = &w.Userbots
+	}
+	for _, b := range *pool {
+		if b == bot {
+			return
+		}
+	}
+	*pool = append(*pool, bot)
+}
+
+func (w *Worker) removeBot(bot *Bot) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if bot.Userbot {
+		for i, b := range w.Userbots {
+			if b == bot {
+				w.Userbots = append(w.Userbots[:i], w.Userbots[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	for i, b := range w.Bots {
+		if b == bot {
+			w.Bots = append(w.Bots[:i], w.Bots[i+1:]...)
+			break
+		}
+	}
+	if w.RunningBotIndex >= len(w.Bots) {
+		w.RunningBotIndex = 0
+	}
+}
+
+// DefaultBot returns the bot handling user messages if it is in rotation.
+func (w *Worker) DefaultBot() *Bot {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	for _, bot := range w.Bots {
+		if bot.Default {
+			return bot
+		}
+	}
+	return nil
+}
+
 func (w *Worker) HireFreeWorker() (*Bot, error) {
 	w.mut.Lock()
 	defer w.mut.Unlock()
@@ -97,28 +192,60 @@ func (w *Worker) HireFreeWorker() (*Bot, error) {
 		return nil, fmt.Errorf("no bots available in worker pool")
 	}
 	selected := w.Bots[w.RunningBotIndex]
-	if time.Since(w.Timer) < time.Duration(WorkingTimerSec)*time.Second {
+	if time.Since(w.Timer) < time.Duration(WorkingTimerSec)*time.Second && selected.CooldownLeft() <= 0 {
 		selected.WorkingPressure++
 		return selected, nil
 	}
 
-	botIdx := 0
-	minPressure := w.Bots[botIdx].WorkingPressure
+	// bots cooling down after a long FLOOD_WAIT are skipped, when every bot is
+	// cooling down the one with the shortest cooldown left is used
+	botIdx := -1
 	for i, bot := range w.Bots {
-		if bot.WorkingPressure < minPressure {
-			minPressure = bot.WorkingPressure
+		if bot.CooldownLeft() > 0 {
+			continue
+		}
+		if botIdx < 0 || bot.WorkingPressure < w.Bots[botIdx].WorkingPressure {
 			botIdx = i
 		}
-		if minPressure <= 0 {
+		if w.Bots[botIdx].WorkingPressure <= 0 {
 			break
 		}
 	}
+	if botIdx < 0 {
+		botIdx = 0
+		for i, bot := range w.Bots {
+			if bot.CooldownLeft() < w.Bots[botIdx].CooldownLeft() {
+				botIdx = i
+			}
+		}
+	}
 	w.Timer = time.Now()
+	w.RunningBotIndex = botIdx
 	selected = w.Bots[botIdx]
 	selected.WorkingPressure++
 	return selected, nil
 }
 
+// HireUserbot returns the least busy userbot to stream a large file with, or
+// nil when no userbot is in rotation. It is released with ReleaseWorker.
+func (w *Worker) HireUserbot() *Bot {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	var selected *Bot
+	for _, bot := range w.Userbots {
+		if bot.CooldownLeft() > 0 {
+			continue
+		}
+		if selected == nil || bot.WorkingPressure < selected.WorkingPressure {
+			selected = bot
+		}
+	}
+	if selected != nil {
+		selected.WorkingPressure++
+	}
+	return selected
+}
+
 func (w *Worker) ReleaseWorker(bot *Bot) {
 	w.mut.Lock()
 	defer w.mut.Unlock()
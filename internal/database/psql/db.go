@@ -24,6 +24,161 @@ CREATE TABLE IF NOT EXISTS users (
     is_verified BOOLEAN NOT NULL DEFAULT false,
     is_premium BOOLEAN NOT NULL DEFAULT false
 );
+
+CREATE TABLE IF NOT EXISTS bot_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    encrypted_token BYTEA NOT NULL,
+    bot_username TEXT NOT NULL DEFAULT '',
+    added_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS bot_sessions (
+    key TEXT PRIMARY KEY,
+    data BYTEA NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS files (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    message_id INTEGER NOT NULL,
+    document_id BIGINT NOT NULL,
+    file_name TEXT NOT NULL,
+    file_size BIGINT NOT NULL,
+    mime_type TEXT NOT NULL DEFAULT '',
+    hash TEXT NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (channel_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS files_owner_id_idx ON files (owner_id, id);
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS files_expires_at_idx ON files (expires_at) WHERE status = 'active';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS view_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS unique_views BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS destroy_on_limit BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS plays BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS exhausted_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS files_exhausted_at_idx ON files (exhausted_at) WHERE status = 'active' AND destroy_on_limit;
+CREATE TABLE IF NOT EXISTS file_viewers (
+    file_id BIGINT NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    viewer TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (file_id, viewer)
+);
+
+CREATE TABLE IF NOT EXISTS admins (
+    user_id BIGINT PRIMARY KEY,
+    role TEXT NOT NULL,
+    granted_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+    id BIGSERIAL PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    owner_id BIGINT NOT NULL,
+    title TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collections_owner_id_idx ON collections (owner_id, id);
+
+CREATE TABLE IF NOT EXISTS collection_files (
+    collection_id BIGINT NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+    file_id BIGINT NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, file_id)
+);
+
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE TABLE IF NOT EXISTS channels (
+    id BIGINT PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    title TEXT NOT NULL,
+    caption_template TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS channels_owner_id_idx ON channels (owner_id);
+
+CREATE TABLE IF NOT EXISTS mirrors (
+    id BIGSERIAL PRIMARY KEY,
+    source_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    mime_filter TEXT NOT NULL DEFAULT '',
+    min_size BIGINT NOT NULL DEFAULT 0,
+    keyword TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source_id, target_id)
+);
+CREATE TABLE IF NOT EXISTS mirror_posts (
+    mirror_id BIGINT NOT NULL REFERENCES mirrors (id) ON DELETE CASCADE,
+    document_id BIGINT NOT NULL,
+    source_message_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (mirror_id, document_id)
+);
+
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id BIGSERIAL PRIMARY KEY,
+    created_by BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    message_id INTEGER NOT NULL,
+    pin BOOLEAN NOT NULL DEFAULT false,
+    status TEXT NOT NULL DEFAULT 'scheduled',
+    send_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    total INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+    broadcast_id BIGINT NOT NULL REFERENCES broadcasts (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP,
+    PRIMARY KEY (broadcast_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS broadcast_deliveries_status_idx ON broadcast_deliveries (broadcast_id, status);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS segment JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS tickets (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    closed_by BIGINT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS tickets_open_user_idx ON tickets (user_id) WHERE status = 'open';
+
+CREATE TABLE IF NOT EXISTS ticket_messages (
+    ticket_id BIGINT NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+    sender_id BIGINT NOT NULL,
+    group_message_id INT NOT NULL,
+    user_message_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (ticket_id, group_message_id)
+);
+
+CREATE INDEX IF NOT EXISTS ticket_messages_group_idx ON ticket_messages (group_message_id);
 	`
 	_, err := db.Exec(ctx, query)
 	return err
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS files (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    message_id INTEGER NOT NULL,
+    document_id BIGINT NOT NULL,
+    file_name TEXT NOT NULL,
+    file_size BIGINT NOT NULL,
+    mime_type TEXT NOT NULL DEFAULT '',
+    hash TEXT NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (channel_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS files_owner_id_idx ON files (owner_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS files;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS mirrors (
+    id BIGSERIAL PRIMARY KEY,
+    source_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    mime_filter TEXT NOT NULL DEFAULT '',
+    min_size BIGINT NOT NULL DEFAULT 0,
+    keyword TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source_id, target_id)
+);
+CREATE TABLE IF NOT EXISTS mirror_posts (
+    mirror_id BIGINT NOT NULL REFERENCES mirrors (id) ON DELETE CASCADE,
+    document_id BIGINT NOT NULL,
+    source_message_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (mirror_id, document_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS mirror_posts;
+DROP TABLE IF EXISTS mirrors;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN IF NOT EXISTS view_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS unique_views BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS destroy_on_limit BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS plays BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS exhausted_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS files_exhausted_at_idx ON files (exhausted_at) WHERE status = 'active' AND destroy_on_limit;
+CREATE TABLE IF NOT EXISTS file_viewers (
+    file_id BIGINT NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    viewer TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (file_id, viewer)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_viewers;
+DROP INDEX IF EXISTS files_exhausted_at_idx;
+ALTER TABLE files DROP COLUMN IF EXISTS exhausted_at;
+ALTER TABLE files DROP COLUMN IF EXISTS plays;
+ALTER TABLE files DROP COLUMN IF EXISTS destroy_on_limit;
+ALTER TABLE files DROP COLUMN IF EXISTS unique_views;
+ALTER TABLE files DROP COLUMN IF EXISTS view_limit;
+-- +goose StatementEnd
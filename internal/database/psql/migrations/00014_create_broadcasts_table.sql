@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id BIGSERIAL PRIMARY KEY,
+    created_by BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    message_id INTEGER NOT NULL,
+    pin BOOLEAN NOT NULL DEFAULT false,
+    status TEXT NOT NULL DEFAULT 'scheduled',
+    send_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    total INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+    broadcast_id BIGINT NOT NULL REFERENCES broadcasts (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP,
+    PRIMARY KEY (broadcast_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS broadcast_deliveries_status_idx ON broadcast_deliveries (broadcast_id, status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS broadcast_deliveries;
+DROP TABLE IF EXISTS broadcasts;
+-- +goose StatementEnd
@@ -18,6 +18,12 @@ UPDATE users
 SET is_deleted = true
 WHERE id = $1;
 
+-- name: SetUserDeleted :one
+UPDATE users
+SET is_deleted = $2
+WHERE id = $1
+RETURNING *;
+
 -- name: UpdateUserByID :one
 UPDATE users
 SET
@@ -54,3 +60,469 @@ RETURNING *;
 
 -- name: IncrementTotalLinks :one
 UPDATE users SET total_links = total_links + 1 WHERE id = $1 RETURNING *;
+
+-- name: TouchUser :one
+UPDATE users
+SET last_active_at = now(),
+    language = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateBotToken :one
+INSERT INTO bot_tokens (token_hash, encrypted_token, bot_username, added_by)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetAllBotTokens :many
+SELECT *
+FROM bot_tokens
+ORDER BY id;
+
+-- name: DeleteBotTokenByUsername :execrows
+DELETE FROM bot_tokens
+WHERE bot_username = $1;
+
+-- name: GetBotSession :one
+SELECT data
+FROM bot_sessions
+WHERE key = $1;
+
+-- name: UpsertBotSession :exec
+INSERT INTO bot_sessions (key, data)
+VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE
+SET data = EXCLUDED.data,
+    updated_at = now();
+
+-- name: DeleteBotSession :exec
+DELETE FROM bot_sessions
+WHERE key = $1;
+
+-- name: CreateFile :one
+INSERT INTO files (owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, expires_at, display_name)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: GetFileByID :one
+SELECT *
+FROM files
+WHERE id = $1;
+
+-- name: GetFileByMessage :one
+SELECT *
+FROM files
+WHERE channel_id = $1 AND message_id = $2;
+
+-- name: GetFilesByOwner :many
+SELECT *
+FROM files
+WHERE owner_id = $1 AND status = 'active'
+ORDER BY id DESC
+LIMIT $2 OFFSET $3;
+
+-- name: SearchFilesByOwner :many
+SELECT *
+FROM files
+WHERE owner_id = $1 AND status = 'active' AND (file_name ILIKE $2 OR display_name ILIKE $2)
+ORDER BY id DESC
+LIMIT $3 OFFSET $4;
+
+-- name: CountFilesByOwner :one
+SELECT COUNT(*)
+FROM files
+WHERE owner_id = $1 AND status = 'active';
+
+-- name: SetFileStatus :one
+UPDATE files
+SET status = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: IncrementFileViews :exec
+UPDATE files
+SET views = views + 1
+WHERE channel_id = $1 AND message_id = $2;
+
+-- name: SetFileDisplayName :one
+UPDATE files
+SET display_name = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetFilePassword :one
+UPDATE files
+SET password_hash = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetFileViewLimit :one
+UPDATE files
+SET view_limit = $2, unique_views = $3, destroy_on_limit = $4, plays = 0, exhausted_at = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: CountFilePlay :one
+UPDATE files
+SET plays = plays + 1,
+    exhausted_at = CASE WHEN plays + 1 >= view_limit THEN CURRENT_TIMESTAMP ELSE exhausted_at END
+WHERE id = $1 AND status = 'active' AND view_limit > 0 AND plays < view_limit
+RETURNING *;
+
+-- name: AddFileViewer :one
+INSERT INTO file_viewers (file_id, viewer)
+VALUES ($1, $2)
+ON CONFLICT (file_id, viewer) DO NOTHING
+RETURNING *;
+
+-- name: GetFileViewer :one
+SELECT *
+FROM file_viewers
+WHERE file_id = $1 AND viewer = $2;
+
+-- name: DeleteFileViewer :exec
+DELETE FROM file_viewers
+WHERE file_id = $1 AND viewer = $2;
+
+-- name: DeleteFileViewers :exec
+DELETE FROM file_viewers
+WHERE file_id = $1;
+
+-- name: GetExhaustedFiles :many
+SELECT *
+FROM files
+WHERE status = 'active' AND destroy_on_limit AND exhausted_at < $1
+ORDER BY exhausted_at
+LIMIT $2;
+
+-- name: SetFileExpiry :one
+UPDATE files
+SET expires_at = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: GetExpiredFiles :many
+SELECT *
+FROM files
+WHERE status = 'active' AND expires_at < $1
+ORDER BY expires_at
+LIMIT $2;
+
+-- name: CreateCollection :one
+INSERT INTO collections (slug, owner_id, title)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetCollectionBySlug :one
+SELECT *
+FROM collections
+WHERE slug = $1;
+
+-- name: AddCollectionFile :exec
+INSERT INTO collection_files (collection_id, file_id, position)
+VALUES ($1, $2, $3)
+ON CONFLICT (collection_id, file_id) DO NOTHING;
+
+-- name: GetCollectionFiles :many
+SELECT f.*
+FROM files f
+JOIN collection_files cf ON cf.file_id = f.id
+WHERE cf.collection_id = $1
+ORDER BY cf.position;
+
+-- name: GetCollectionByID :one
+SELECT *
+FROM collections
+WHERE id = $1;
+
+-- name: GetCollectionsByOwner :many
+SELECT c.*, COUNT(cf.file_id) AS file_count
+FROM collections c
+LEFT JOIN collection_files cf ON cf.collection_id = c.id
+WHERE c.owner_id = $1
+GROUP BY c.id
+ORDER BY c.id DESC
+LIMIT $2;
+
+-- name: SetCollectionPublic :one
+UPDATE collections
+SET is_public = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteCollection :exec
+DELETE FROM collections
+WHERE id = $1;
+
+-- name: GetCollectionFileIDs :many
+SELECT file_id
+FROM collection_files
+WHERE collection_id = $1
+ORDER BY position;
+
+-- name: RemoveCollectionFile :exec
+DELETE FROM collection_files
+WHERE collection_id = $1 AND file_id = $2;
+
+-- name: SetCollectionFilePosition :exec
+UPDATE collection_files
+SET position = $3
+WHERE collection_id = $1 AND file_id = $2;
+
+-- name: UpsertChannel :one
+INSERT INTO channels (id, owner_id, title)
+VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE
+SET owner_id = EXCLUDED.owner_id, title = EXCLUDED.title, enabled = TRUE
+RETURNING *;
+
+-- name: GetChannel :one
+SELECT *
+FROM channels
+WHERE id = $1;
+
+-- name: GetChannelsByOwner :many
+SELECT *
+FROM channels
+WHERE owner_id = $1
+ORDER BY created_at;
+
+-- name: SetChannelTemplate :one
+UPDATE channels
+SET caption_template = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: SetChannelEnabled :one
+UPDATE channels
+SET enabled = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteChannel :exec
+DELETE FROM channels
+WHERE id = $1;
+
+-- name: CreateMirror :one
+INSERT INTO mirrors (source_id, target_id, created_by)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetMirror :one
+SELECT *
+FROM mirrors
+WHERE id = $1;
+
+-- name: GetMirrors :many
+SELECT *
+FROM mirrors
+ORDER BY id;
+
+-- name: GetMirrorsBySource :many
+SELECT *
+FROM mirrors
+WHERE source_id = $1 AND enabled = TRUE
+ORDER BY id;
+
+-- name: SetMirrorFilters :one
+UPDATE mirrors
+SET mime_filter = $2, min_size = $3, keyword = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: SetMirrorEnabled :one
+UPDATE mirrors
+SET enabled = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteMirror :exec
+DELETE FROM mirrors
+WHERE id = $1;
+
+-- name: ClaimMirrorPost :one
+INSERT INTO mirror_posts (mirror_id, document_id, source_message_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (mirror_id, document_id) DO NOTHING
+RETURNING *;
+
+-- name: DeleteMirrorPost :exec
+DELETE FROM mirror_posts
+WHERE mirror_id = $1 AND document_id = $2;
+
+-- name: GetAdmin :one
+SELECT *
+FROM admins
+WHERE user_id = $1;
+
+-- name: GetAdmins :many
+SELECT *
+FROM admins
+ORDER BY created_at;
+
+-- name: UpsertAdmin :one
+INSERT INTO admins (user_id, role, granted_by)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by
+RETURNING *;
+
+-- name: DeleteAdmin :one
+DELETE FROM admins
+WHERE user_id = $1
+RETURNING *;
+
+-- name: CreateBroadcast :one
+INSERT INTO broadcasts (created_by, channel_id, message_id, pin, send_at, segment)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetBroadcast :one
+SELECT *
+FROM broadcasts
+WHERE id = $1;
+
+-- name: GetBroadcasts :many
+SELECT *
+FROM broadcasts
+ORDER BY id DESC
+LIMIT $1;
+
+-- name: GetDueBroadcasts :many
+SELECT *
+FROM broadcasts
+WHERE status = 'running' OR (status = 'scheduled' AND send_at <= $1)
+ORDER BY send_at, id;
+
+-- name: CountSegment :one
+SELECT COUNT(*)
+FROM users
+WHERE is_deleted = false AND is_banned = false
+    AND (@active_days::int = 0 OR last_active_at >= now() - make_interval(days => @active_days::int))
+    AND (NOT @premium::boolean OR is_premium)
+    AND (NOT @verified::boolean OR is_verified)
+    AND (sqlc.narg(min_credit)::int IS NULL OR credit >= sqlc.narg(min_credit)::int)
+    AND (sqlc.narg(max_credit)::int IS NULL OR credit <= sqlc.narg(max_credit)::int)
+    AND (sqlc.narg(joined_after)::timestamp IS NULL OR created_at >= sqlc.narg(joined_after)::timestamp)
+    AND (@language::text = '' OR language = @language::text);
+
+-- name: AddBroadcastDeliveries :execrows
+INSERT INTO broadcast_deliveries (broadcast_id, user_id)
+SELECT @broadcast_id::bigint, id
+FROM users
+WHERE is_deleted = false AND is_banned = false
+    AND (@active_days::int = 0 OR last_active_at >= now() - make_interval(days => @active_days::int))
+    AND (NOT @premium::boolean OR is_premium)
+    AND (NOT @verified::boolean OR is_verified)
+    AND (sqlc.narg(min_credit)::int IS NULL OR credit >= sqlc.narg(min_credit)::int)
+    AND (sqlc.narg(max_credit)::int IS NULL OR credit <= sqlc.narg(max_credit)::int)
+    AND (sqlc.narg(joined_after)::timestamp IS NULL OR created_at >= sqlc.narg(joined_after)::timestamp)
+    AND (@language::text = '' OR language = @language::text)
+ON CONFLICT (broadcast_id, user_id) DO NOTHING;
+
+-- name: StartBroadcast :one
+UPDATE broadcasts
+SET status = 'running',
+    total = (SELECT COUNT(*) FROM broadcast_deliveries WHERE broadcast_id = $1)
+WHERE id = $1 AND status = 'scheduled'
+RETURNING *;
+
+-- name: FinishBroadcast :one
+UPDATE broadcasts
+SET status = 'done',
+    finished_at = now()
+WHERE id = $1 AND status = 'running'
+RETURNING *;
+
+-- name: CancelBroadcast :one
+UPDATE broadcasts
+SET status = 'cancelled',
+    finished_at = now()
+WHERE id = $1 AND status IN ('scheduled', 'running')
+RETURNING *;
+
+-- name: GetPendingDeliveries :many
+SELECT *
+FROM broadcast_deliveries
+WHERE broadcast_id = $1 AND status = 'pending'
+ORDER BY user_id
+LIMIT $2;
+
+-- name: SetDeliveryStatus :exec
+UPDATE broadcast_deliveries
+SET status = $3,
+    error = $4,
+    updated_at = now()
+WHERE broadcast_id = $1 AND user_id = $2;
+
+-- name: CountDeliveries :one
+SELECT COUNT(*) FILTER (WHERE status = 'pending') AS pending,
+    COUNT(*) FILTER (WHERE status = 'sent') AS sent,
+    COUNT(*) FILTER (WHERE status = 'failed') AS failed,
+    COUNT(*) FILTER (WHERE status = 'blocked') AS blocked
+FROM broadcast_deliveries
+WHERE broadcast_id = $1;
+
+-- name: GetFailedDeliveries :many
+SELECT *
+FROM broadcast_deliveries
+WHERE broadcast_id = $1 AND status = 'failed'
+ORDER BY user_id;
+
+-- name: CreateTicket :one
+INSERT INTO tickets (user_id, subject)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetTicket :one
+SELECT *
+FROM tickets
+WHERE id = $1;
+
+-- name: GetOpenTicket :one
+SELECT *
+FROM tickets
+WHERE user_id = $1 AND status = 'open';
+
+-- name: GetTickets :many
+SELECT *
+FROM tickets
+WHERE @status::text = '' OR status = @status::text
+ORDER BY updated_at DESC
+LIMIT @max_rows::int;
+
+-- name: GetUserTickets :many
+SELECT *
+FROM tickets
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT $2;
+
+-- name: CloseTicket :one
+UPDATE tickets
+SET status = 'closed', closed_by = $2, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: TouchTicket :exec
+UPDATE tickets
+SET updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: AddTicketMessage :exec
+INSERT INTO ticket_messages (ticket_id, sender_id, group_message_id, user_message_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (ticket_id, group_message_id) DO NOTHING;
+
+-- name: GetTicketMessageByGroup :one
+SELECT *
+FROM ticket_messages
+WHERE group_message_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetTicketMessageByUser :one
+SELECT *
+FROM ticket_messages
+WHERE user_message_id = @user_message_id::int
+    AND ticket_id IN (SELECT id FROM tickets WHERE user_id = @user_id::bigint)
+ORDER BY created_at DESC
+LIMIT 1;
@@ -8,6 +8,141 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Admin struct {
+	UserID    int64            `json:"user_id"`
+	Role      string           `json:"role"`
+	GrantedBy int64            `json:"granted_by"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type BotSession struct {
+	Key       string           `json:"key"`
+	Data      []byte           `json:"data"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+type BotToken struct {
+	ID             int64            `json:"id"`
+	TokenHash      string           `json:"token_hash"`
+	EncryptedToken []byte           `json:"encrypted_token"`
+	BotUsername    string           `json:"bot_username"`
+	AddedBy        int64            `json:"added_by"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+}
+
+type Broadcast struct {
+	ID         int64            `json:"id"`
+	CreatedBy  int64            `json:"created_by"`
+	ChannelID  int64            `json:"channel_id"`
+	MessageID  int32            `json:"message_id"`
+	Pin        bool             `json:"pin"`
+	Status     string           `json:"status"`
+	SendAt     pgtype.Timestamp `json:"send_at"`
+	Total      int32            `json:"total"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	FinishedAt pgtype.Timestamp `json:"finished_at"`
+	Segment    []byte           `json:"segment"`
+}
+
+type BroadcastDelivery struct {
+	BroadcastID int64            `json:"broadcast_id"`
+	UserID      int64            `json:"user_id"`
+	Status      string           `json:"status"`
+	Error       string           `json:"error"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+}
+
+type Channel struct {
+	ID              int64            `json:"id"`
+	OwnerID         int64            `json:"owner_id"`
+	Title           string           `json:"title"`
+	CaptionTemplate string           `json:"caption_template"`
+	Enabled         bool             `json:"enabled"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+}
+
+type Collection struct {
+	ID        int64            `json:"id"`
+	Slug      string           `json:"slug"`
+	OwnerID   int64            `json:"owner_id"`
+	Title     string           `json:"title"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	IsPublic  bool             `json:"is_public"`
+}
+
+type CollectionFile struct {
+	CollectionID int64 `json:"collection_id"`
+	FileID       int64 `json:"file_id"`
+	Position     int32 `json:"position"`
+}
+
+type File struct {
+	ID             int64            `json:"id"`
+	OwnerID        int64            `json:"owner_id"`
+	ChannelID      int64            `json:"channel_id"`
+	MessageID      int32            `json:"message_id"`
+	DocumentID     int64            `json:"document_id"`
+	FileName       string           `json:"file_name"`
+	FileSize       int64            `json:"file_size"`
+	MimeType       string           `json:"mime_type"`
+	Hash           string           `json:"hash"`
+	Views          int64            `json:"views"`
+	Status         string           `json:"status"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+	ExpiresAt      pgtype.Timestamp `json:"expires_at"`
+	DisplayName    string           `json:"display_name"`
+	PasswordHash   string           `json:"password_hash"`
+	ViewLimit      int32            `json:"view_limit"`
+	UniqueViews    bool             `json:"unique_views"`
+	DestroyOnLimit bool             `json:"destroy_on_limit"`
+	Plays          int64            `json:"plays"`
+	ExhaustedAt    pgtype.Timestamp `json:"exhausted_at"`
+}
+
+type FileViewer struct {
+	FileID    int64            `json:"file_id"`
+	Viewer    string           `json:"viewer"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type Mirror struct {
+	ID         int64            `json:"id"`
+	SourceID   int64            `json:"source_id"`
+	TargetID   int64            `json:"target_id"`
+	MimeFilter string           `json:"mime_filter"`
+	MinSize    int64            `json:"min_size"`
+	Keyword    string           `json:"keyword"`
+	Enabled    bool             `json:"enabled"`
+	CreatedBy  int64            `json:"created_by"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+}
+
+type MirrorPost struct {
+	MirrorID        int64            `json:"mirror_id"`
+	DocumentID      int64            `json:"document_id"`
+	SourceMessageID int32            `json:"source_message_id"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+}
+
+type Ticket struct {
+	ID        int64            `json:"id"`
+	UserID    int64            `json:"user_id"`
+	Subject   string           `json:"subject"`
+	Status    string           `json:"status"`
+	ClosedBy  pgtype.Int8      `json:"closed_by"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+	ClosedAt  pgtype.Timestamp `json:"closed_at"`
+}
+
+type TicketMessage struct {
+	TicketID       int64            `json:"ticket_id"`
+	SenderID       int64            `json:"sender_id"`
+	GroupMessageID int32            `json:"group_message_id"`
+	UserMessageID  int32            `json:"user_message_id"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+}
+
 type User struct {
 	ID               int64            `json:"id"`
 	CreatedAt        pgtype.Timestamp `json:"created_at"`
@@ -19,4 +154,6 @@ type User struct {
 	IsDeleted        bool             `json:"is_deleted"`
 	IsVerified       bool             `json:"is_verified"`
 	IsPremium        bool             `json:"is_premium"`
+	LastActiveAt     pgtype.Timestamp `json:"last_active_at"`
+	Language         string           `json:"language"`
 }
@@ -6,19 +6,101 @@ package repo
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AddBroadcastDeliveries(ctx context.Context, arg AddBroadcastDeliveriesParams) (int64, error)
+	AddCollectionFile(ctx context.Context, arg AddCollectionFileParams) error
+	AddFileViewer(ctx context.Context, arg AddFileViewerParams) (*FileViewer, error)
+	AddTicketMessage(ctx context.Context, arg AddTicketMessageParams) error
+	CancelBroadcast(ctx context.Context, id int64) (*Broadcast, error)
+	ClaimMirrorPost(ctx context.Context, arg ClaimMirrorPostParams) (*MirrorPost, error)
+	CloseTicket(ctx context.Context, arg CloseTicketParams) (*Ticket, error)
+	CountDeliveries(ctx context.Context, broadcastID int64) (*CountDeliveriesRow, error)
+	CountFilePlay(ctx context.Context, id int64) (*File, error)
+	CountFilesByOwner(ctx context.Context, ownerID int64) (int64, error)
+	CountSegment(ctx context.Context, arg CountSegmentParams) (int64, error)
+	CreateBotToken(ctx context.Context, arg CreateBotTokenParams) (*BotToken, error)
+	CreateBroadcast(ctx context.Context, arg CreateBroadcastParams) (*Broadcast, error)
+	CreateCollection(ctx context.Context, arg CreateCollectionParams) (*Collection, error)
+	CreateFile(ctx context.Context, arg CreateFileParams) (*File, error)
+	CreateMirror(ctx context.Context, arg CreateMirrorParams) (*Mirror, error)
+	CreateTicket(ctx context.Context, arg CreateTicketParams) (*Ticket, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (*User, error)
 	DecrementCredit(ctx context.Context, arg DecrementCreditParams) (*User, error)
+	DeleteAdmin(ctx context.Context, userID int64) (*Admin, error)
+	DeleteBotSession(ctx context.Context, key string) error
+	DeleteBotTokenByUsername(ctx context.Context, botUsername string) (int64, error)
+	DeleteChannel(ctx context.Context, id int64) error
+	DeleteCollection(ctx context.Context, id int64) error
+	DeleteFileViewer(ctx context.Context, arg DeleteFileViewerParams) error
+	DeleteFileViewers(ctx context.Context, fileID int64) error
+	DeleteMirror(ctx context.Context, id int64) error
+	DeleteMirrorPost(ctx context.Context, arg DeleteMirrorPostParams) error
 	DeleteUser(ctx context.Context, id int64) error
+	FinishBroadcast(ctx context.Context, id int64) (*Broadcast, error)
+	GetAdmin(ctx context.Context, userID int64) (*Admin, error)
+	GetAdmins(ctx context.Context) ([]*Admin, error)
+	GetAllBotTokens(ctx context.Context) ([]*BotToken, error)
 	GetAllUsers(ctx context.Context) ([]*User, error)
+	GetBotSession(ctx context.Context, key string) ([]byte, error)
+	GetBroadcast(ctx context.Context, id int64) (*Broadcast, error)
+	GetBroadcasts(ctx context.Context, limit int32) ([]*Broadcast, error)
+	GetChannel(ctx context.Context, id int64) (*Channel, error)
+	GetChannelsByOwner(ctx context.Context, ownerID int64) ([]*Channel, error)
+	GetCollectionByID(ctx context.Context, id int64) (*Collection, error)
+	GetCollectionBySlug(ctx context.Context, slug string) (*Collection, error)
+	GetCollectionFileIDs(ctx context.Context, collectionID int64) ([]int64, error)
+	GetCollectionFiles(ctx context.Context, collectionID int64) ([]*File, error)
+	GetCollectionsByOwner(ctx context.Context, arg GetCollectionsByOwnerParams) ([]*GetCollectionsByOwnerRow, error)
+	GetDueBroadcasts(ctx context.Context, sendAt pgtype.Timestamp) ([]*Broadcast, error)
+	GetExhaustedFiles(ctx context.Context, arg GetExhaustedFilesParams) ([]*File, error)
+	GetExpiredFiles(ctx context.Context, arg GetExpiredFilesParams) ([]*File, error)
+	GetFailedDeliveries(ctx context.Context, broadcastID int64) ([]*BroadcastDelivery, error)
+	GetFileByID(ctx context.Context, id int64) (*File, error)
+	GetFileByMessage(ctx context.Context, arg GetFileByMessageParams) (*File, error)
+	GetFileViewer(ctx context.Context, arg GetFileViewerParams) (*FileViewer, error)
+	GetFilesByOwner(ctx context.Context, arg GetFilesByOwnerParams) ([]*File, error)
+	GetMirror(ctx context.Context, id int64) (*Mirror, error)
+	GetMirrors(ctx context.Context) ([]*Mirror, error)
+	GetMirrorsBySource(ctx context.Context, sourceID int64) ([]*Mirror, error)
+	GetOpenTicket(ctx context.Context, userID int64) (*Ticket, error)
+	GetPendingDeliveries(ctx context.Context, arg GetPendingDeliveriesParams) ([]*BroadcastDelivery, error)
+	GetTicket(ctx context.Context, id int64) (*Ticket, error)
+	GetTicketMessageByGroup(ctx context.Context, groupMessageID int32) (*TicketMessage, error)
+	GetTicketMessageByUser(ctx context.Context, arg GetTicketMessageByUserParams) (*TicketMessage, error)
+	GetTickets(ctx context.Context, arg GetTicketsParams) ([]*Ticket, error)
 	GetTotalActiveUsersCount(ctx context.Context) (int64, error)
 	GetUserByID(ctx context.Context, id int64) (*User, error)
+	GetUserTickets(ctx context.Context, arg GetUserTicketsParams) ([]*Ticket, error)
 	IncrementCredit(ctx context.Context, arg IncrementCreditParams) (*User, error)
 	IncrementCreditWithDate(ctx context.Context, arg IncrementCreditWithDateParams) (*User, error)
+	IncrementFileViews(ctx context.Context, arg IncrementFileViewsParams) error
 	IncrementTotalLinks(ctx context.Context, id int64) (*User, error)
+	RemoveCollectionFile(ctx context.Context, arg RemoveCollectionFileParams) error
+	SearchFilesByOwner(ctx context.Context, arg SearchFilesByOwnerParams) ([]*File, error)
+	SetChannelEnabled(ctx context.Context, arg SetChannelEnabledParams) (*Channel, error)
+	SetChannelTemplate(ctx context.Context, arg SetChannelTemplateParams) (*Channel, error)
+	SetCollectionFilePosition(ctx context.Context, arg SetCollectionFilePositionParams) error
+	SetCollectionPublic(ctx context.Context, arg SetCollectionPublicParams) (*Collection, error)
+	SetDeliveryStatus(ctx context.Context, arg SetDeliveryStatusParams) error
+	SetFileDisplayName(ctx context.Context, arg SetFileDisplayNameParams) (*File, error)
+	SetFileExpiry(ctx context.Context, arg SetFileExpiryParams) (*File, error)
+	SetFilePassword(ctx context.Context, arg SetFilePasswordParams) (*File, error)
+	SetFileStatus(ctx context.Context, arg SetFileStatusParams) (*File, error)
+	SetFileViewLimit(ctx context.Context, arg SetFileViewLimitParams) (*File, error)
+	SetMirrorEnabled(ctx context.Context, arg SetMirrorEnabledParams) (*Mirror, error)
+	SetMirrorFilters(ctx context.Context, arg SetMirrorFiltersParams) (*Mirror, error)
+	SetUserDeleted(ctx context.Context, arg SetUserDeletedParams) (*User, error)
+	StartBroadcast(ctx context.Context, broadcastID int64) (*Broadcast, error)
+	TouchTicket(ctx context.Context, id int64) error
+	TouchUser(ctx context.Context, arg TouchUserParams) (*User, error)
 	UpdateUserByID(ctx context.Context, arg UpdateUserByIDParams) (*User, error)
+	UpsertAdmin(ctx context.Context, arg UpsertAdminParams) (*Admin, error)
+	UpsertBotSession(ctx context.Context, arg UpsertBotSessionParams) error
+	UpsertChannel(ctx context.Context, arg UpsertChannelParams) (*Channel, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -7,12 +7,524 @@ package repo
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addBroadcastDeliveries = `-- name: AddBroadcastDeliveries :execrows
+INSERT INTO broadcast_deliveries (broadcast_id, user_id)
+SELECT $1::bigint, id
+FROM users
+WHERE is_deleted = false AND is_banned = false
+    AND ($2::int = 0 OR last_active_at >= now() - make_interval(days => $2::int))
+    AND (NOT $3::boolean OR is_premium)
+    AND (NOT $4::boolean OR is_verified)
+    AND ($5::int IS NULL OR credit >= $5::int)
+    AND ($6::int IS NULL OR credit <= $6::int)
+    AND ($7::timestamp IS NULL OR created_at >= $7::timestamp)
+    AND ($8::text = '' OR language = $8::text)
+ON CONFLICT (broadcast_id, user_id) DO NOTHING
+`
+
+type AddBroadcastDeliveriesParams struct {
+	BroadcastID int64            `json:"broadcast_id"`
+	ActiveDays  int32            `json:"active_days"`
+	Premium     bool             `json:"premium"`
+	Verified    bool             `json:"verified"`
+	MinCredit   pgtype.Int4      `json:"min_credit"`
+	MaxCredit   pgtype.Int4      `json:"max_credit"`
+	JoinedAfter pgtype.Timestamp `json:"joined_after"`
+	Language    string           `json:"language"`
+}
+
+func (q *Queries) AddBroadcastDeliveries(ctx context.Context, arg AddBroadcastDeliveriesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addBroadcastDeliveries,
+		arg.BroadcastID,
+		arg.ActiveDays,
+		arg.Premium,
+		arg.Verified,
+		arg.MinCredit,
+		arg.MaxCredit,
+		arg.JoinedAfter,
+		arg.Language,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const addCollectionFile = `-- name: AddCollectionFile :exec
+INSERT INTO collection_files (collection_id, file_id, position)
+VALUES ($1, $2, $3)
+ON CONFLICT (collection_id, file_id) DO NOTHING
+`
+
+type AddCollectionFileParams struct {
+	CollectionID int64 `json:"collection_id"`
+	FileID       int64 `json:"file_id"`
+	Position     int32 `json:"position"`
+}
+
+func (q *Queries) AddCollectionFile(ctx context.Context, arg AddCollectionFileParams) error {
+	_, err := q.db.Exec(ctx, addCollectionFile, arg.CollectionID, arg.FileID, arg.Position)
+	return err
+}
+
+const addFileViewer = `-- name: AddFileViewer :one
+INSERT INTO file_viewers (file_id, viewer)
+VALUES ($1, $2)
+ON CONFLICT (file_id, viewer) DO NOTHING
+RETURNING file_id, viewer, created_at
+`
+
+type AddFileViewerParams struct {
+	FileID int64  `json:"file_id"`
+	Viewer string `json:"viewer"`
+}
+
+func (q *Queries) AddFileViewer(ctx context.Context, arg AddFileViewerParams) (*FileViewer, error) {
+	row := q.db.QueryRow(ctx, addFileViewer, arg.FileID, arg.Viewer)
+	var i FileViewer
+	err := row.Scan(&i.FileID, &i.Viewer, &i.CreatedAt)
+	return &i, err
+}
+
+const addTicketMessage = `-- name: AddTicketMessage :exec
+INSERT INTO ticket_messages (ticket_id, sender_id, group_message_id, user_message_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (ticket_id, group_message_id) DO NOTHING
+`
+
+type AddTicketMessageParams struct {
+	TicketID       int64 `json:"ticket_id"`
+	SenderID       int64 `json:"sender_id"`
+	GroupMessageID int32 `json:"group_message_id"`
+	UserMessageID  int32 `json:"user_message_id"`
+}
+
+func (q *Queries) AddTicketMessage(ctx context.Context, arg AddTicketMessageParams) error {
+	_, err := q.db.Exec(ctx, addTicketMessage,
+		arg.TicketID,
+		arg.SenderID,
+		arg.GroupMessageID,
+		arg.UserMessageID,
+	)
+	return err
+}
+
+const cancelBroadcast = `-- name: CancelBroadcast :one
+UPDATE broadcasts
+SET status = 'cancelled',
+    finished_at = now()
+WHERE id = $1 AND status IN ('scheduled', 'running')
+RETURNING id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
+`
+
+func (q *Queries) CancelBroadcast(ctx context.Context, id int64) (*Broadcast, error) {
+	row := q.db.QueryRow(ctx, cancelBroadcast, id)
+	var i Broadcast
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.Pin,
+		&i.Status,
+		&i.SendAt,
+		&i.Total,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Segment,
+	)
+	return &i, err
+}
+
+const claimMirrorPost = `-- name: ClaimMirrorPost :one
+INSERT INTO mirror_posts (mirror_id, document_id, source_message_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (mirror_id, document_id) DO NOTHING
+RETURNING mirror_id, document_id, source_message_id, created_at
+`
+
+type ClaimMirrorPostParams struct {
+	MirrorID        int64 `json:"mirror_id"`
+	DocumentID      int64 `json:"document_id"`
+	SourceMessageID int32 `json:"source_message_id"`
+}
+
+func (q *Queries) ClaimMirrorPost(ctx context.Context, arg ClaimMirrorPostParams) (*MirrorPost, error) {
+	row := q.db.QueryRow(ctx, claimMirrorPost, arg.MirrorID, arg.DocumentID, arg.SourceMessageID)
+	var i MirrorPost
+	err := row.Scan(
+		&i.MirrorID,
+		&i.DocumentID,
+		&i.SourceMessageID,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const closeTicket = `-- name: CloseTicket :one
+UPDATE tickets
+SET status = 'closed', closed_by = $2, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'open'
+RETURNING id, user_id, subject, status, closed_by, created_at, updated_at, closed_at
+`
+
+type CloseTicketParams struct {
+	ID       int64       `json:"id"`
+	ClosedBy pgtype.Int8 `json:"closed_by"`
+}
+
+func (q *Queries) CloseTicket(ctx context.Context, arg CloseTicketParams) (*Ticket, error) {
+	row := q.db.QueryRow(ctx, closeTicket, arg.ID, arg.ClosedBy)
+	var i Ticket
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Subject,
+		&i.Status,
+		&i.ClosedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ClosedAt,
+	)
+	return &i, err
+}
+
+const countDeliveries = `-- name: CountDeliveries :one
+SELECT COUNT(*) FILTER (WHERE status = 'pending') AS pending,
+    COUNT(*) FILTER (WHERE status = 'sent') AS sent,
+    COUNT(*) FILTER (WHERE status = 'failed') AS failed,
+    COUNT(*) FILTER (WHERE status = 'blocked') AS blocked
+FROM broadcast_deliveries
+WHERE broadcast_id = $1
+`
+
+type CountDeliveriesRow struct {
+	Pending int64 `json:"pending"`
+	Sent    int64 `json:"sent"`
+	Failed  int64 `json:"failed"`
+	Blocked int64 `json:"blocked"`
+}
+
+func (q *Queries) CountDeliveries(ctx context.Context, broadcastID int64) (*CountDeliveriesRow, error) {
+	row := q.db.QueryRow(ctx, countDeliveries, broadcastID)
+	var i CountDeliveriesRow
+	err := row.Scan(
+		&i.Pending,
+		&i.Sent,
+		&i.Failed,
+		&i.Blocked,
+	)
+	return &i, err
+}
+
+const countFilePlay = `-- name: CountFilePlay :one
+UPDATE files
+SET plays = plays + 1,
+    exhausted_at = CASE WHEN plays + 1 >= view_limit THEN CURRENT_TIMESTAMP ELSE exhausted_at END
+WHERE id = $1 AND status = 'active' AND view_limit > 0 AND plays < view_limit
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+func (q *Queries) CountFilePlay(ctx context.Context, id int64) (*File, error) {
+	row := q.db.QueryRow(ctx, countFilePlay, id)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const countFilesByOwner = `-- name: CountFilesByOwner :one
+SELECT COUNT(*)
+FROM files
+WHERE owner_id = $1 AND status = 'active'
+`
+
+func (q *Queries) CountFilesByOwner(ctx context.Context, ownerID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countFilesByOwner, ownerID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countSegment = `-- name: CountSegment :one
+SELECT COUNT(*)
+FROM users
+WHERE is_deleted = false AND is_banned = false
+    AND ($1::int = 0 OR last_active_at >= now() - make_interval(days => $1::int))
+    AND (NOT $2::boolean OR is_premium)
+    AND (NOT $3::boolean OR is_verified)
+    AND ($4::int IS NULL OR credit >= $4::int)
+    AND ($5::int IS NULL OR credit <= $5::int)
+    AND ($6::timestamp IS NULL OR created_at >= $6::timestamp)
+    AND ($7::text = '' OR language = $7::text)
+`
+
+type CountSegmentParams struct {
+	ActiveDays  int32            `json:"active_days"`
+	Premium     bool             `json:"premium"`
+	Verified    bool             `json:"verified"`
+	MinCredit   pgtype.Int4      `json:"min_credit"`
+	MaxCredit   pgtype.Int4      `json:"max_credit"`
+	JoinedAfter pgtype.Timestamp `json:"joined_after"`
+	Language    string           `json:"language"`
+}
+
+func (q *Queries) CountSegment(ctx context.Context, arg CountSegmentParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countSegment,
+		arg.ActiveDays,
+		arg.Premium,
+		arg.Verified,
+		arg.MinCredit,
+		arg.MaxCredit,
+		arg.JoinedAfter,
+		arg.Language,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createBotToken = `-- name: CreateBotToken :one
+INSERT INTO bot_tokens (token_hash, encrypted_token, bot_username, added_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, token_hash, encrypted_token, bot_username, added_by, created_at
+`
+
+type CreateBotTokenParams struct {
+	TokenHash      string `json:"token_hash"`
+	EncryptedToken []byte `json:"encrypted_token"`
+	BotUsername    string `json:"bot_username"`
+	AddedBy        int64  `json:"added_by"`
+}
+
+func (q *Queries) CreateBotToken(ctx context.Context, arg CreateBotTokenParams) (*BotToken, error) {
+	row := q.db.QueryRow(ctx, createBotToken,
+		arg.TokenHash,
+		arg.EncryptedToken,
+		arg.BotUsername,
+		arg.AddedBy,
+	)
+	var i BotToken
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.EncryptedToken,
+		&i.BotUsername,
+		&i.AddedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const createBroadcast = `-- name: CreateBroadcast :one
+INSERT INTO broadcasts (created_by, channel_id, message_id, pin, send_at, segment)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
+`
+
+type CreateBroadcastParams struct {
+	CreatedBy int64            `json:"created_by"`
+	ChannelID int64            `json:"channel_id"`
+	MessageID int32            `json:"message_id"`
+	Pin       bool             `json:"pin"`
+	SendAt    pgtype.Timestamp `json:"send_at"`
+	Segment   []byte           `json:"segment"`
+}
+
+func (q *Queries) CreateBroadcast(ctx context.Context, arg CreateBroadcastParams) (*Broadcast, error) {
+	row := q.db.QueryRow(ctx, createBroadcast,
+		arg.CreatedBy,
+		arg.ChannelID,
+		arg.MessageID,
+		arg.Pin,
+		arg.SendAt,
+		arg.Segment,
+	)
+	var i Broadcast
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.Pin,
+		&i.Status,
+		&i.SendAt,
+		&i.Total,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Segment,
+	)
+	return &i, err
+}
+
+const createCollection = `-- name: CreateCollection :one
+INSERT INTO collections (slug, owner_id, title)
+VALUES ($1, $2, $3)
+RETURNING id, slug, owner_id, title, created_at, is_public
+`
+
+type CreateCollectionParams struct {
+	Slug    string `json:"slug"`
+	OwnerID int64  `json:"owner_id"`
+	Title   string `json:"title"`
+}
+
+func (q *Queries) CreateCollection(ctx context.Context, arg CreateCollectionParams) (*Collection, error) {
+	row := q.db.QueryRow(ctx, createCollection, arg.Slug, arg.OwnerID, arg.Title)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Slug,
+		&i.OwnerID,
+		&i.Title,
+		&i.CreatedAt,
+		&i.IsPublic,
+	)
+	return &i, err
+}
+
+const createFile = `-- name: CreateFile :one
+INSERT INTO files (owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, expires_at, display_name)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+type CreateFileParams struct {
+	OwnerID     int64            `json:"owner_id"`
+	ChannelID   int64            `json:"channel_id"`
+	MessageID   int32            `json:"message_id"`
+	DocumentID  int64            `json:"document_id"`
+	FileName    string           `json:"file_name"`
+	FileSize    int64            `json:"file_size"`
+	MimeType    string           `json:"mime_type"`
+	Hash        string           `json:"hash"`
+	ExpiresAt   pgtype.Timestamp `json:"expires_at"`
+	DisplayName string           `json:"display_name"`
+}
+
+func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (*File, error) {
+	row := q.db.QueryRow(ctx, createFile,
+		arg.OwnerID,
+		arg.ChannelID,
+		arg.MessageID,
+		arg.DocumentID,
+		arg.FileName,
+		arg.FileSize,
+		arg.MimeType,
+		arg.Hash,
+		arg.ExpiresAt,
+		arg.DisplayName,
+	)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const createMirror = `-- name: CreateMirror :one
+INSERT INTO mirrors (source_id, target_id, created_by)
+VALUES ($1, $2, $3)
+RETURNING id, source_id, target_id, mime_filter, min_size, keyword, enabled, created_by, created_at
+`
+
+type CreateMirrorParams struct {
+	SourceID  int64 `json:"source_id"`
+	TargetID  int64 `json:"target_id"`
+	CreatedBy int64 `json:"created_by"`
+}
+
+func (q *Queries) CreateMirror(ctx context.Context, arg CreateMirrorParams) (*Mirror, error) {
+	row := q.db.QueryRow(ctx, createMirror, arg.SourceID, arg.TargetID, arg.CreatedBy)
+	var i Mirror
+	err := row.Scan(
+		&i.ID,
+		&i.SourceID,
+		&i.TargetID,
+		&i.MimeFilter,
+		&i.MinSize,
+		&i.Keyword,
+		&i.Enabled,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const createTicket = `-- name: CreateTicket :one
+INSERT INTO tickets (user_id, subject)
+VALUES ($1, $2)
+RETURNING id, user_id, subject, status, closed_by, created_at, updated_at, closed_at
+`
+
+type CreateTicketParams struct {
+	UserID  int64  `json:"user_id"`
+	Subject string `json:"subject"`
+}
+
+func (q *Queries) CreateTicket(ctx context.Context, arg CreateTicketParams) (*Ticket, error) {
+	row := q.db.QueryRow(ctx, createTicket, arg.UserID, arg.Subject)
+	var i Ticket
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Subject,
+		&i.Status,
+		&i.ClosedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ClosedAt,
+	)
+	return &i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, credit)
 VALUES ($1, $2)
-RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
 `
 
 type CreateUserParams struct {
@@ -34,24 +546,1377 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (*User,
 		&i.IsDeleted,
 		&i.IsVerified,
 		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
+	)
+	return &i, err
+}
+
+const decrementCredit = `-- name: DecrementCredit :one
+UPDATE users
+SET credit = credit - $2
+WHERE id = $1
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+`
+
+type DecrementCreditParams struct {
+	ID     int64 `json:"id"`
+	Credit int32 `json:"credit"`
+}
+
+func (q *Queries) DecrementCredit(ctx context.Context, arg DecrementCreditParams) (*User, error) {
+	row := q.db.QueryRow(ctx, decrementCredit, arg.ID, arg.Credit)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotalLinks,
+		&i.Credit,
+		&i.LastCreditUpdate,
+		&i.IsBanned,
+		&i.IsDeleted,
+		&i.IsVerified,
+		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
+	)
+	return &i, err
+}
+
+const deleteAdmin = `-- name: DeleteAdmin :one
+DELETE FROM admins
+WHERE user_id = $1
+RETURNING user_id, role, granted_by, created_at
+`
+
+func (q *Queries) DeleteAdmin(ctx context.Context, userID int64) (*Admin, error) {
+	row := q.db.QueryRow(ctx, deleteAdmin, userID)
+	var i Admin
+	err := row.Scan(
+		&i.UserID,
+		&i.Role,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const deleteBotSession = `-- name: DeleteBotSession :exec
+DELETE FROM bot_sessions
+WHERE key = $1
+`
+
+func (q *Queries) DeleteBotSession(ctx context.Context, key string) error {
+	_, err := q.db.Exec(ctx, deleteBotSession, key)
+	return err
+}
+
+const deleteBotTokenByUsername = `-- name: DeleteBotTokenByUsername :execrows
+DELETE FROM bot_tokens
+WHERE bot_username = $1
+`
+
+func (q *Queries) DeleteBotTokenByUsername(ctx context.Context, botUsername string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteBotTokenByUsername, botUsername)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteChannel = `-- name: DeleteChannel :exec
+DELETE FROM channels
+WHERE id = $1
+`
+
+func (q *Queries) DeleteChannel(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteChannel, id)
+	return err
+}
+
+const deleteCollection = `-- name: DeleteCollection :exec
+DELETE FROM collections
+WHERE id = $1
+`
+
+func (q *Queries) DeleteCollection(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteCollection, id)
+	return err
+}
+
+const deleteFileViewer = `-- name: DeleteFileViewer :exec
+DELETE FROM file_viewers
+WHERE file_id = $1 AND viewer = $2
+`
+
+type DeleteFileViewerParams struct {
+	FileID int64  `json:"file_id"`
+	Viewer string `json:"viewer"`
+}
+
+func (q *Queries) DeleteFileViewer(ctx context.Context, arg DeleteFileViewerParams) error {
+	_, err := q.db.Exec(ctx, deleteFileViewer, arg.FileID, arg.Viewer)
+	return err
+}
+
+const deleteFileViewers = `-- name: DeleteFileViewers :exec
+DELETE FROM file_viewers
+WHERE file_id = $1
+`
+
+func (q *Queries) DeleteFileViewers(ctx context.Context, fileID int64) error {
+	_, err := q.db.Exec(ctx, deleteFileViewers, fileID)
+	return err
+}
+
+const deleteMirror = `-- name: DeleteMirror :exec
+DELETE FROM mirrors
+WHERE id = $1
+`
+
+func (q *Queries) DeleteMirror(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteMirror, id)
+	return err
+}
+
+const deleteMirrorPost = `-- name: DeleteMirrorPost :exec
+DELETE FROM mirror_posts
+WHERE mirror_id = $1 AND document_id = $2
+`
+
+type DeleteMirrorPostParams struct {
+	MirrorID   int64 `json:"mirror_id"`
+	DocumentID int64 `json:"document_id"`
+}
+
+func (q *Queries) DeleteMirrorPost(ctx context.Context, arg DeleteMirrorPostParams) error {
+	_, err := q.db.Exec(ctx, deleteMirrorPost, arg.MirrorID, arg.DocumentID)
+	return err
+}
+
+const deleteUser = `-- name: DeleteUser :exec
+UPDATE users
+SET is_deleted = true
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteUser, id)
+	return err
+}
+
+const finishBroadcast = `-- name: FinishBroadcast :one
+UPDATE broadcasts
+SET status = 'done',
+    finished_at = now()
+WHERE id = $1 AND status = 'running'
+RETURNING id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
+`
+
+func (q *Queries) FinishBroadcast(ctx context.Context, id int64) (*Broadcast, error) {
+	row := q.db.QueryRow(ctx, finishBroadcast, id)
+	var i Broadcast
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.Pin,
+		&i.Status,
+		&i.SendAt,
+		&i.Total,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Segment,
+	)
+	return &i, err
+}
+
+const getAdmin = `-- name: GetAdmin :one
+SELECT user_id, role, granted_by, created_at
+FROM admins
+WHERE user_id = $1
+`
+
+func (q *Queries) GetAdmin(ctx context.Context, userID int64) (*Admin, error) {
+	row := q.db.QueryRow(ctx, getAdmin, userID)
+	var i Admin
+	err := row.Scan(
+		&i.UserID,
+		&i.Role,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getAdmins = `-- name: GetAdmins :many
+SELECT user_id, role, granted_by, created_at
+FROM admins
+ORDER BY created_at
+`
+
+func (q *Queries) GetAdmins(ctx context.Context) ([]*Admin, error) {
+	rows, err := q.db.Query(ctx, getAdmins)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Admin
+	for rows.Next() {
+		var i Admin
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Role,
+			&i.GrantedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllBotTokens = `-- name: GetAllBotTokens :many
+SELECT id, token_hash, encrypted_token, bot_username, added_by, created_at
+FROM bot_tokens
+ORDER BY id
+`
+
+func (q *Queries) GetAllBotTokens(ctx context.Context) ([]*BotToken, error) {
+	rows, err := q.db.Query(ctx, getAllBotTokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*BotToken
+	for rows.Next() {
+		var i BotToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.TokenHash,
+			&i.EncryptedToken,
+			&i.BotUsername,
+			&i.AddedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllUsers = `-- name: GetAllUsers :many
+SELECT id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+FROM users
+`
+
+func (q *Queries) GetAllUsers(ctx context.Context) ([]*User, error) {
+	rows, err := q.db.Query(ctx, getAllUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TotalLinks,
+			&i.Credit,
+			&i.LastCreditUpdate,
+			&i.IsBanned,
+			&i.IsDeleted,
+			&i.IsVerified,
+			&i.IsPremium,
+			&i.LastActiveAt,
+			&i.Language,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getBotSession = `-- name: GetBotSession :one
+SELECT data
+FROM bot_sessions
+WHERE key = $1
+`
+
+func (q *Queries) GetBotSession(ctx context.Context, key string) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getBotSession, key)
+	var data []byte
+	err := row.Scan(&data)
+	return data, err
+}
+
+const getBroadcast = `-- name: GetBroadcast :one
+SELECT id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
+FROM broadcasts
+WHERE id = $1
+`
+
+func (q *Queries) GetBroadcast(ctx context.Context, id int64) (*Broadcast, error) {
+	row := q.db.QueryRow(ctx, getBroadcast, id)
+	var i Broadcast
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.Pin,
+		&i.Status,
+		&i.SendAt,
+		&i.Total,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Segment,
+	)
+	return &i, err
+}
+
+const getBroadcasts = `-- name: GetBroadcasts :many
+SELECT id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
+FROM broadcasts
+ORDER BY id DESC
+LIMIT $1
+`
+
+func (q *Queries) GetBroadcasts(ctx context.Context, limit int32) ([]*Broadcast, error) {
+	rows, err := q.db.Query(ctx, getBroadcasts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Broadcast
+	for rows.Next() {
+		var i Broadcast
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedBy,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.Pin,
+			&i.Status,
+			&i.SendAt,
+			&i.Total,
+			&i.CreatedAt,
+			&i.FinishedAt,
+			&i.Segment,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChannel = `-- name: GetChannel :one
+SELECT id, owner_id, title, caption_template, enabled, created_at
+FROM channels
+WHERE id = $1
+`
+
+func (q *Queries) GetChannel(ctx context.Context, id int64) (*Channel, error) {
+	row := q.db.QueryRow(ctx, getChannel, id)
+	var i Channel
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Title,
+		&i.CaptionTemplate,
+		&i.Enabled,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getChannelsByOwner = `-- name: GetChannelsByOwner :many
+SELECT id, owner_id, title, caption_template, enabled, created_at
+FROM channels
+WHERE owner_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetChannelsByOwner(ctx context.Context, ownerID int64) ([]*Channel, error) {
+	rows, err := q.db.Query(ctx, getChannelsByOwner, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Channel
+	for rows.Next() {
+		var i Channel
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.Title,
+			&i.CaptionTemplate,
+			&i.Enabled,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCollectionByID = `-- name: GetCollectionByID :one
+SELECT id, slug, owner_id, title, created_at, is_public
+FROM collections
+WHERE id = $1
+`
+
+func (q *Queries) GetCollectionByID(ctx context.Context, id int64) (*Collection, error) {
+	row := q.db.QueryRow(ctx, getCollectionByID, id)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Slug,
+		&i.OwnerID,
+		&i.Title,
+		&i.CreatedAt,
+		&i.IsPublic,
+	)
+	return &i, err
+}
+
+const getCollectionBySlug = `-- name: GetCollectionBySlug :one
+SELECT id, slug, owner_id, title, created_at, is_public
+FROM collections
+WHERE slug = $1
+`
+
+func (q *Queries) GetCollectionBySlug(ctx context.Context, slug string) (*Collection, error) {
+	row := q.db.QueryRow(ctx, getCollectionBySlug, slug)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Slug,
+		&i.OwnerID,
+		&i.Title,
+		&i.CreatedAt,
+		&i.IsPublic,
+	)
+	return &i, err
+}
+
+const getCollectionFileIDs = `-- name: GetCollectionFileIDs :many
+SELECT file_id
+FROM collection_files
+WHERE collection_id = $1
+ORDER BY position
+`
+
+func (q *Queries) GetCollectionFileIDs(ctx context.Context, collectionID int64) ([]int64, error) {
+	rows, err := q.db.Query(ctx, getCollectionFileIDs, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var fileID int64
+		if err := rows.Scan(&fileID); err != nil {
+			return nil, err
+		}
+		items = append(items, fileID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCollectionFiles = `-- name: GetCollectionFiles :many
+SELECT f.id, f.owner_id, f.channel_id, f.message_id, f.document_id, f.file_name, f.file_size, f.mime_type, f.hash, f.views, f.status, f.created_at, f.expires_at, f.display_name, f.password_hash, f.view_limit, f.unique_views, f.destroy_on_limit, f.plays, f.exhausted_at
+FROM files f
+JOIN collection_files cf ON cf.file_id = f.id
+WHERE cf.collection_id = $1
+ORDER BY cf.position
+`
+
+func (q *Queries) GetCollectionFiles(ctx context.Context, collectionID int64) ([]*File, error) {
+	rows, err := q.db.Query(ctx, getCollectionFiles, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.DocumentID,
+			&i.FileName,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Hash,
+			&i.Views,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.DisplayName,
+			&i.PasswordHash,
+			&i.ViewLimit,
+			&i.UniqueViews,
+			&i.DestroyOnLimit,
+			&i.Plays,
+			&i.ExhaustedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCollectionsByOwner = `-- name: GetCollectionsByOwner :many
+SELECT c.id, c.slug, c.owner_id, c.title, c.created_at, c.is_public, COUNT(cf.file_id) AS file_count
+FROM collections c
+LEFT JOIN collection_files cf ON cf.collection_id = c.id
+WHERE c.owner_id = $1
+GROUP BY c.id
+ORDER BY c.id DESC
+LIMIT $2
+`
+
+type GetCollectionsByOwnerParams struct {
+	OwnerID int64 `json:"owner_id"`
+	Limit   int32 `json:"limit"`
+}
+
+type GetCollectionsByOwnerRow struct {
+	ID        int64            `json:"id"`
+	Slug      string           `json:"slug"`
+	OwnerID   int64            `json:"owner_id"`
+	Title     string           `json:"title"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	IsPublic  bool             `json:"is_public"`
+	FileCount int64            `json:"file_count"`
+}
+
+func (q *Queries) GetCollectionsByOwner(ctx context.Context, arg GetCollectionsByOwnerParams) ([]*GetCollectionsByOwnerRow, error) {
+	rows, err := q.db.Query(ctx, getCollectionsByOwner, arg.OwnerID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetCollectionsByOwnerRow
+	for rows.Next() {
+		var i GetCollectionsByOwnerRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Slug,
+			&i.OwnerID,
+			&i.Title,
+			&i.CreatedAt,
+			&i.IsPublic,
+			&i.FileCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDueBroadcasts = `-- name: GetDueBroadcasts :many
+SELECT id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
+FROM broadcasts
+WHERE status = 'running' OR (status = 'scheduled' AND send_at <= $1)
+ORDER BY send_at, id
+`
+
+func (q *Queries) GetDueBroadcasts(ctx context.Context, sendAt pgtype.Timestamp) ([]*Broadcast, error) {
+	rows, err := q.db.Query(ctx, getDueBroadcasts, sendAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Broadcast
+	for rows.Next() {
+		var i Broadcast
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedBy,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.Pin,
+			&i.Status,
+			&i.SendAt,
+			&i.Total,
+			&i.CreatedAt,
+			&i.FinishedAt,
+			&i.Segment,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExhaustedFiles = `-- name: GetExhaustedFiles :many
+SELECT id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+FROM files
+WHERE status = 'active' AND destroy_on_limit AND exhausted_at < $1
+ORDER BY exhausted_at
+LIMIT $2
+`
+
+type GetExhaustedFilesParams struct {
+	ExhaustedAt pgtype.Timestamp `json:"exhausted_at"`
+	Limit       int32            `json:"limit"`
+}
+
+func (q *Queries) GetExhaustedFiles(ctx context.Context, arg GetExhaustedFilesParams) ([]*File, error) {
+	rows, err := q.db.Query(ctx, getExhaustedFiles, arg.ExhaustedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.DocumentID,
+			&i.FileName,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Hash,
+			&i.Views,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.DisplayName,
+			&i.PasswordHash,
+			&i.ViewLimit,
+			&i.UniqueViews,
+			&i.DestroyOnLimit,
+			&i.Plays,
+			&i.ExhaustedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExpiredFiles = `-- name: GetExpiredFiles :many
+SELECT id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+FROM files
+WHERE status = 'active' AND expires_at < $1
+ORDER BY expires_at
+LIMIT $2
+`
+
+type GetExpiredFilesParams struct {
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	Limit     int32            `json:"limit"`
+}
+
+func (q *Queries) GetExpiredFiles(ctx context.Context, arg GetExpiredFilesParams) ([]*File, error) {
+	rows, err := q.db.Query(ctx, getExpiredFiles, arg.ExpiresAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.DocumentID,
+			&i.FileName,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Hash,
+			&i.Views,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.DisplayName,
+			&i.PasswordHash,
+			&i.ViewLimit,
+			&i.UniqueViews,
+			&i.DestroyOnLimit,
+			&i.Plays,
+			&i.ExhaustedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFailedDeliveries = `-- name: GetFailedDeliveries :many
+SELECT broadcast_id, user_id, status, error, updated_at
+FROM broadcast_deliveries
+WHERE broadcast_id = $1 AND status = 'failed'
+ORDER BY user_id
+`
+
+func (q *Queries) GetFailedDeliveries(ctx context.Context, broadcastID int64) ([]*BroadcastDelivery, error) {
+	rows, err := q.db.Query(ctx, getFailedDeliveries, broadcastID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*BroadcastDelivery
+	for rows.Next() {
+		var i BroadcastDelivery
+		if err := rows.Scan(
+			&i.BroadcastID,
+			&i.UserID,
+			&i.Status,
+			&i.Error,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFileByID = `-- name: GetFileByID :one
+SELECT id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+FROM files
+WHERE id = $1
+`
+
+func (q *Queries) GetFileByID(ctx context.Context, id int64) (*File, error) {
+	row := q.db.QueryRow(ctx, getFileByID, id)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const getFileByMessage = `-- name: GetFileByMessage :one
+SELECT id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+FROM files
+WHERE channel_id = $1 AND message_id = $2
+`
+
+type GetFileByMessageParams struct {
+	ChannelID int64 `json:"channel_id"`
+	MessageID int32 `json:"message_id"`
+}
+
+func (q *Queries) GetFileByMessage(ctx context.Context, arg GetFileByMessageParams) (*File, error) {
+	row := q.db.QueryRow(ctx, getFileByMessage, arg.ChannelID, arg.MessageID)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const getFileViewer = `-- name: GetFileViewer :one
+SELECT file_id, viewer, created_at
+FROM file_viewers
+WHERE file_id = $1 AND viewer = $2
+`
+
+type GetFileViewerParams struct {
+	FileID int64  `json:"file_id"`
+	Viewer string `json:"viewer"`
+}
+
+func (q *Queries) GetFileViewer(ctx context.Context, arg GetFileViewerParams) (*FileViewer, error) {
+	row := q.db.QueryRow(ctx, getFileViewer, arg.FileID, arg.Viewer)
+	var i FileViewer
+	err := row.Scan(&i.FileID, &i.Viewer, &i.CreatedAt)
+	return &i, err
+}
+
+const getFilesByOwner = `-- name: GetFilesByOwner :many
+SELECT id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+FROM files
+WHERE owner_id = $1 AND status = 'active'
+ORDER BY id DESC
+LIMIT $2 OFFSET $3
+`
+
+type GetFilesByOwnerParams struct {
+	OwnerID int64 `json:"owner_id"`
+	Limit   int32 `json:"limit"`
+	Offset  int32 `json:"offset"`
+}
+
+func (q *Queries) GetFilesByOwner(ctx context.Context, arg GetFilesByOwnerParams) ([]*File, error) {
+	rows, err := q.db.Query(ctx, getFilesByOwner, arg.OwnerID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.DocumentID,
+			&i.FileName,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Hash,
+			&i.Views,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.DisplayName,
+			&i.PasswordHash,
+			&i.ViewLimit,
+			&i.UniqueViews,
+			&i.DestroyOnLimit,
+			&i.Plays,
+			&i.ExhaustedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMirror = `-- name: GetMirror :one
+SELECT id, source_id, target_id, mime_filter, min_size, keyword, enabled, created_by, created_at
+FROM mirrors
+WHERE id = $1
+`
+
+func (q *Queries) GetMirror(ctx context.Context, id int64) (*Mirror, error) {
+	row := q.db.QueryRow(ctx, getMirror, id)
+	var i Mirror
+	err := row.Scan(
+		&i.ID,
+		&i.SourceID,
+		&i.TargetID,
+		&i.MimeFilter,
+		&i.MinSize,
+		&i.Keyword,
+		&i.Enabled,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getMirrors = `-- name: GetMirrors :many
+SELECT id, source_id, target_id, mime_filter, min_size, keyword, enabled, created_by, created_at
+FROM mirrors
+ORDER BY id
+`
+
+func (q *Queries) GetMirrors(ctx context.Context) ([]*Mirror, error) {
+	rows, err := q.db.Query(ctx, getMirrors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Mirror
+	for rows.Next() {
+		var i Mirror
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceID,
+			&i.TargetID,
+			&i.MimeFilter,
+			&i.MinSize,
+			&i.Keyword,
+			&i.Enabled,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMirrorsBySource = `-- name: GetMirrorsBySource :many
+SELECT id, source_id, target_id, mime_filter, min_size, keyword, enabled, created_by, created_at
+FROM mirrors
+WHERE source_id = $1 AND enabled = TRUE
+ORDER BY id
+`
+
+func (q *Queries) GetMirrorsBySource(ctx context.Context, sourceID int64) ([]*Mirror, error) {
+	rows, err := q.db.Query(ctx, getMirrorsBySource, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Mirror
+	for rows.Next() {
+		var i Mirror
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceID,
+			&i.TargetID,
+			&i.MimeFilter,
+			&i.MinSize,
+			&i.Keyword,
+			&i.Enabled,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOpenTicket = `-- name: GetOpenTicket :one
+SELECT id, user_id, subject, status, closed_by, created_at, updated_at, closed_at
+FROM tickets
+WHERE user_id = $1 AND status = 'open'
+`
+
+func (q *Queries) GetOpenTicket(ctx context.Context, userID int64) (*Ticket, error) {
+	row := q.db.QueryRow(ctx, getOpenTicket, userID)
+	var i Ticket
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Subject,
+		&i.Status,
+		&i.ClosedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ClosedAt,
+	)
+	return &i, err
+}
+
+const getPendingDeliveries = `-- name: GetPendingDeliveries :many
+SELECT broadcast_id, user_id, status, error, updated_at
+FROM broadcast_deliveries
+WHERE broadcast_id = $1 AND status = 'pending'
+ORDER BY user_id
+LIMIT $2
+`
+
+type GetPendingDeliveriesParams struct {
+	BroadcastID int64 `json:"broadcast_id"`
+	Limit       int32 `json:"limit"`
+}
+
+func (q *Queries) GetPendingDeliveries(ctx context.Context, arg GetPendingDeliveriesParams) ([]*BroadcastDelivery, error) {
+	rows, err := q.db.Query(ctx, getPendingDeliveries, arg.BroadcastID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*BroadcastDelivery
+	for rows.Next() {
+		var i BroadcastDelivery
+		if err := rows.Scan(
+			&i.BroadcastID,
+			&i.UserID,
+			&i.Status,
+			&i.Error,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTicket = `-- name: GetTicket :one
+SELECT id, user_id, subject, status, closed_by, created_at, updated_at, closed_at
+FROM tickets
+WHERE id = $1
+`
+
+func (q *Queries) GetTicket(ctx context.Context, id int64) (*Ticket, error) {
+	row := q.db.QueryRow(ctx, getTicket, id)
+	var i Ticket
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Subject,
+		&i.Status,
+		&i.ClosedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ClosedAt,
+	)
+	return &i, err
+}
+
+const getTicketMessageByGroup = `-- name: GetTicketMessageByGroup :one
+SELECT ticket_id, sender_id, group_message_id, user_message_id, created_at
+FROM ticket_messages
+WHERE group_message_id = $1
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+func (q *Queries) GetTicketMessageByGroup(ctx context.Context, groupMessageID int32) (*TicketMessage, error) {
+	row := q.db.QueryRow(ctx, getTicketMessageByGroup, groupMessageID)
+	var i TicketMessage
+	err := row.Scan(
+		&i.TicketID,
+		&i.SenderID,
+		&i.GroupMessageID,
+		&i.UserMessageID,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getTicketMessageByUser = `-- name: GetTicketMessageByUser :one
+SELECT ticket_id, sender_id, group_message_id, user_message_id, created_at
+FROM ticket_messages
+WHERE user_message_id = $1::int
+    AND ticket_id IN (SELECT id FROM tickets WHERE user_id = $2::bigint)
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+type GetTicketMessageByUserParams struct {
+	UserMessageID int32 `json:"user_message_id"`
+	UserID        int64 `json:"user_id"`
+}
+
+func (q *Queries) GetTicketMessageByUser(ctx context.Context, arg GetTicketMessageByUserParams) (*TicketMessage, error) {
+	row := q.db.QueryRow(ctx, getTicketMessageByUser, arg.UserMessageID, arg.UserID)
+	var i TicketMessage
+	err := row.Scan(
+		&i.TicketID,
+		&i.SenderID,
+		&i.GroupMessageID,
+		&i.UserMessageID,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getTickets = `-- name: GetTickets :many
+SELECT id, user_id, subject, status, closed_by, created_at, updated_at, closed_at
+FROM tickets
+WHERE $1::text = '' OR status = $1::text
+ORDER BY updated_at DESC
+LIMIT $2::int
+`
+
+type GetTicketsParams struct {
+	Status  string `json:"status"`
+	MaxRows int32  `json:"max_rows"`
+}
+
+func (q *Queries) GetTickets(ctx context.Context, arg GetTicketsParams) ([]*Ticket, error) {
+	rows, err := q.db.Query(ctx, getTickets, arg.Status, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Ticket
+	for rows.Next() {
+		var i Ticket
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Subject,
+			&i.Status,
+			&i.ClosedBy,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ClosedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTotalActiveUsersCount = `-- name: GetTotalActiveUsersCount :one
+SELECT COUNT(*)
+FROM users
+WHERE is_deleted = false
+`
+
+func (q *Queries) GetTotalActiveUsersCount(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, getTotalActiveUsersCount)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+FROM users
+WHERE id = $1 AND is_deleted = false
+LIMIT 1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	row := q.db.QueryRow(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotalLinks,
+		&i.Credit,
+		&i.LastCreditUpdate,
+		&i.IsBanned,
+		&i.IsDeleted,
+		&i.IsVerified,
+		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
+	)
+	return &i, err
+}
+
+const getUserTickets = `-- name: GetUserTickets :many
+SELECT id, user_id, subject, status, closed_by, created_at, updated_at, closed_at
+FROM tickets
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT $2
+`
+
+type GetUserTicketsParams struct {
+	UserID int64 `json:"user_id"`
+	Limit  int32 `json:"limit"`
+}
+
+func (q *Queries) GetUserTickets(ctx context.Context, arg GetUserTicketsParams) ([]*Ticket, error) {
+	rows, err := q.db.Query(ctx, getUserTickets, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Ticket
+	for rows.Next() {
+		var i Ticket
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Subject,
+			&i.Status,
+			&i.ClosedBy,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ClosedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementCredit = `-- name: IncrementCredit :one
+UPDATE users
+SET credit = credit + $2
+WHERE id = $1
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+`
+
+type IncrementCreditParams struct {
+	ID     int64 `json:"id"`
+	Credit int32 `json:"credit"`
+}
+
+func (q *Queries) IncrementCredit(ctx context.Context, arg IncrementCreditParams) (*User, error) {
+	row := q.db.QueryRow(ctx, incrementCredit, arg.ID, arg.Credit)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotalLinks,
+		&i.Credit,
+		&i.LastCreditUpdate,
+		&i.IsBanned,
+		&i.IsDeleted,
+		&i.IsVerified,
+		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
+	)
+	return &i, err
+}
+
+const incrementCreditWithDate = `-- name: IncrementCreditWithDate :one
+UPDATE users
+SET credit = credit + $2,
+    last_credit_update = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+`
+
+type IncrementCreditWithDateParams struct {
+	ID     int64 `json:"id"`
+	Credit int32 `json:"credit"`
+}
+
+func (q *Queries) IncrementCreditWithDate(ctx context.Context, arg IncrementCreditWithDateParams) (*User, error) {
+	row := q.db.QueryRow(ctx, incrementCreditWithDate, arg.ID, arg.Credit)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotalLinks,
+		&i.Credit,
+		&i.LastCreditUpdate,
+		&i.IsBanned,
+		&i.IsDeleted,
+		&i.IsVerified,
+		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
 	)
 	return &i, err
 }
 
-const decrementCredit = `-- name: DecrementCredit :one
-UPDATE users
-SET credit = credit - $2
-WHERE id = $1
-RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
+const incrementFileViews = `-- name: IncrementFileViews :exec
+UPDATE files
+SET views = views + 1
+WHERE channel_id = $1 AND message_id = $2
 `
 
-type DecrementCreditParams struct {
-	ID     int64 `json:"id"`
-	Credit int32 `json:"credit"`
+type IncrementFileViewsParams struct {
+	ChannelID int64 `json:"channel_id"`
+	MessageID int32 `json:"message_id"`
 }
 
-func (q *Queries) DecrementCredit(ctx context.Context, arg DecrementCreditParams) (*User, error) {
-	row := q.db.QueryRow(ctx, decrementCredit, arg.ID, arg.Credit)
+func (q *Queries) IncrementFileViews(ctx context.Context, arg IncrementFileViewsParams) error {
+	_, err := q.db.Exec(ctx, incrementFileViews, arg.ChannelID, arg.MessageID)
+	return err
+}
+
+const incrementTotalLinks = `-- name: IncrementTotalLinks :one
+UPDATE users SET total_links = total_links + 1 WHERE id = $1 RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+`
+
+func (q *Queries) IncrementTotalLinks(ctx context.Context, id int64) (*User, error) {
+	row := q.db.QueryRow(ctx, incrementTotalLinks, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -64,46 +1929,77 @@ func (q *Queries) DecrementCredit(ctx context.Context, arg DecrementCreditParams
 		&i.IsDeleted,
 		&i.IsVerified,
 		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
 	)
 	return &i, err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
-UPDATE users
-SET is_deleted = true
-WHERE id = $1
+const removeCollectionFile = `-- name: RemoveCollectionFile :exec
+DELETE FROM collection_files
+WHERE collection_id = $1 AND file_id = $2
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
-	_, err := q.db.Exec(ctx, deleteUser, id)
+type RemoveCollectionFileParams struct {
+	CollectionID int64 `json:"collection_id"`
+	FileID       int64 `json:"file_id"`
+}
+
+func (q *Queries) RemoveCollectionFile(ctx context.Context, arg RemoveCollectionFileParams) error {
+	_, err := q.db.Exec(ctx, removeCollectionFile, arg.CollectionID, arg.FileID)
 	return err
 }
 
-const getAllUsers = `-- name: GetAllUsers :many
-SELECT id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
-FROM users
+const searchFilesByOwner = `-- name: SearchFilesByOwner :many
+SELECT id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+FROM files
+WHERE owner_id = $1 AND status = 'active' AND (file_name ILIKE $2 OR display_name ILIKE $2)
+ORDER BY id DESC
+LIMIT $3 OFFSET $4
 `
 
-func (q *Queries) GetAllUsers(ctx context.Context) ([]*User, error) {
-	rows, err := q.db.Query(ctx, getAllUsers)
+type SearchFilesByOwnerParams struct {
+	OwnerID  int64  `json:"owner_id"`
+	FileName string `json:"file_name"`
+	Limit    int32  `json:"limit"`
+	Offset   int32  `json:"offset"`
+}
+
+func (q *Queries) SearchFilesByOwner(ctx context.Context, arg SearchFilesByOwnerParams) ([]*File, error) {
+	rows, err := q.db.Query(ctx, searchFilesByOwner,
+		arg.OwnerID,
+		arg.FileName,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []*User
+	var items []*File
 	for rows.Next() {
-		var i User
+		var i File
 		if err := rows.Scan(
 			&i.ID,
+			&i.OwnerID,
+			&i.ChannelID,
+			&i.MessageID,
+			&i.DocumentID,
+			&i.FileName,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Hash,
+			&i.Views,
+			&i.Status,
 			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.TotalLinks,
-			&i.Credit,
-			&i.LastCreditUpdate,
-			&i.IsBanned,
-			&i.IsDeleted,
-			&i.IsVerified,
-			&i.IsPremium,
+			&i.ExpiresAt,
+			&i.DisplayName,
+			&i.PasswordHash,
+			&i.ViewLimit,
+			&i.UniqueViews,
+			&i.DestroyOnLimit,
+			&i.Plays,
+			&i.ExhaustedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -115,89 +2011,412 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]*User, error) {
 	return items, nil
 }
 
-const getTotalActiveUsersCount = `-- name: GetTotalActiveUsersCount :one
-SELECT COUNT(*)
-FROM users
-WHERE is_deleted = false
+const setChannelEnabled = `-- name: SetChannelEnabled :one
+UPDATE channels
+SET enabled = $2
+WHERE id = $1
+RETURNING id, owner_id, title, caption_template, enabled, created_at
 `
 
-func (q *Queries) GetTotalActiveUsersCount(ctx context.Context) (int64, error) {
-	row := q.db.QueryRow(ctx, getTotalActiveUsersCount)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+type SetChannelEnabledParams struct {
+	ID      int64 `json:"id"`
+	Enabled bool  `json:"enabled"`
 }
 
-const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
-FROM users
-WHERE id = $1 AND is_deleted = false
-LIMIT 1
+func (q *Queries) SetChannelEnabled(ctx context.Context, arg SetChannelEnabledParams) (*Channel, error) {
+	row := q.db.QueryRow(ctx, setChannelEnabled, arg.ID, arg.Enabled)
+	var i Channel
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Title,
+		&i.CaptionTemplate,
+		&i.Enabled,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const setChannelTemplate = `-- name: SetChannelTemplate :one
+UPDATE channels
+SET caption_template = $2
+WHERE id = $1
+RETURNING id, owner_id, title, caption_template, enabled, created_at
 `
 
-func (q *Queries) GetUserByID(ctx context.Context, id int64) (*User, error) {
-	row := q.db.QueryRow(ctx, getUserByID, id)
-	var i User
+type SetChannelTemplateParams struct {
+	ID              int64  `json:"id"`
+	CaptionTemplate string `json:"caption_template"`
+}
+
+func (q *Queries) SetChannelTemplate(ctx context.Context, arg SetChannelTemplateParams) (*Channel, error) {
+	row := q.db.QueryRow(ctx, setChannelTemplate, arg.ID, arg.CaptionTemplate)
+	var i Channel
 	err := row.Scan(
 		&i.ID,
+		&i.OwnerID,
+		&i.Title,
+		&i.CaptionTemplate,
+		&i.Enabled,
 		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.TotalLinks,
-		&i.Credit,
-		&i.LastCreditUpdate,
-		&i.IsBanned,
-		&i.IsDeleted,
-		&i.IsVerified,
-		&i.IsPremium,
 	)
 	return &i, err
 }
 
-const incrementCredit = `-- name: IncrementCredit :one
-UPDATE users
-SET credit = credit + $2
+const setCollectionFilePosition = `-- name: SetCollectionFilePosition :exec
+UPDATE collection_files
+SET position = $3
+WHERE collection_id = $1 AND file_id = $2
+`
+
+type SetCollectionFilePositionParams struct {
+	CollectionID int64 `json:"collection_id"`
+	FileID       int64 `json:"file_id"`
+	Position     int32 `json:"position"`
+}
+
+func (q *Queries) SetCollectionFilePosition(ctx context.Context, arg SetCollectionFilePositionParams) error {
+	_, err := q.db.Exec(ctx, setCollectionFilePosition, arg.CollectionID, arg.FileID, arg.Position)
+	return err
+}
+
+const setCollectionPublic = `-- name: SetCollectionPublic :one
+UPDATE collections
+SET is_public = $2
 WHERE id = $1
-RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
+RETURNING id, slug, owner_id, title, created_at, is_public
 `
 
-type IncrementCreditParams struct {
-	ID     int64 `json:"id"`
-	Credit int32 `json:"credit"`
+type SetCollectionPublicParams struct {
+	ID       int64 `json:"id"`
+	IsPublic bool  `json:"is_public"`
 }
 
-func (q *Queries) IncrementCredit(ctx context.Context, arg IncrementCreditParams) (*User, error) {
-	row := q.db.QueryRow(ctx, incrementCredit, arg.ID, arg.Credit)
-	var i User
+func (q *Queries) SetCollectionPublic(ctx context.Context, arg SetCollectionPublicParams) (*Collection, error) {
+	row := q.db.QueryRow(ctx, setCollectionPublic, arg.ID, arg.IsPublic)
+	var i Collection
 	err := row.Scan(
 		&i.ID,
+		&i.Slug,
+		&i.OwnerID,
+		&i.Title,
 		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.TotalLinks,
-		&i.Credit,
-		&i.LastCreditUpdate,
-		&i.IsBanned,
-		&i.IsDeleted,
-		&i.IsVerified,
-		&i.IsPremium,
+		&i.IsPublic,
 	)
 	return &i, err
 }
 
-const incrementCreditWithDate = `-- name: IncrementCreditWithDate :one
+const setDeliveryStatus = `-- name: SetDeliveryStatus :exec
+UPDATE broadcast_deliveries
+SET status = $3,
+    error = $4,
+    updated_at = now()
+WHERE broadcast_id = $1 AND user_id = $2
+`
+
+type SetDeliveryStatusParams struct {
+	BroadcastID int64  `json:"broadcast_id"`
+	UserID      int64  `json:"user_id"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+}
+
+func (q *Queries) SetDeliveryStatus(ctx context.Context, arg SetDeliveryStatusParams) error {
+	_, err := q.db.Exec(ctx, setDeliveryStatus,
+		arg.BroadcastID,
+		arg.UserID,
+		arg.Status,
+		arg.Error,
+	)
+	return err
+}
+
+const setFileDisplayName = `-- name: SetFileDisplayName :one
+UPDATE files
+SET display_name = $2
+WHERE id = $1
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+type SetFileDisplayNameParams struct {
+	ID          int64  `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+func (q *Queries) SetFileDisplayName(ctx context.Context, arg SetFileDisplayNameParams) (*File, error) {
+	row := q.db.QueryRow(ctx, setFileDisplayName, arg.ID, arg.DisplayName)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const setFileExpiry = `-- name: SetFileExpiry :one
+UPDATE files
+SET expires_at = $2
+WHERE id = $1
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+type SetFileExpiryParams struct {
+	ID        int64            `json:"id"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+}
+
+func (q *Queries) SetFileExpiry(ctx context.Context, arg SetFileExpiryParams) (*File, error) {
+	row := q.db.QueryRow(ctx, setFileExpiry, arg.ID, arg.ExpiresAt)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const setFilePassword = `-- name: SetFilePassword :one
+UPDATE files
+SET password_hash = $2
+WHERE id = $1
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+type SetFilePasswordParams struct {
+	ID           int64  `json:"id"`
+	PasswordHash string `json:"password_hash"`
+}
+
+func (q *Queries) SetFilePassword(ctx context.Context, arg SetFilePasswordParams) (*File, error) {
+	row := q.db.QueryRow(ctx, setFilePassword, arg.ID, arg.PasswordHash)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const setFileStatus = `-- name: SetFileStatus :one
+UPDATE files
+SET status = $2
+WHERE id = $1
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+type SetFileStatusParams struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+func (q *Queries) SetFileStatus(ctx context.Context, arg SetFileStatusParams) (*File, error) {
+	row := q.db.QueryRow(ctx, setFileStatus, arg.ID, arg.Status)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const setFileViewLimit = `-- name: SetFileViewLimit :one
+UPDATE files
+SET view_limit = $2, unique_views = $3, destroy_on_limit = $4, plays = 0, exhausted_at = NULL
+WHERE id = $1
+RETURNING id, owner_id, channel_id, message_id, document_id, file_name, file_size, mime_type, hash, views, status, created_at, expires_at, display_name, password_hash, view_limit, unique_views, destroy_on_limit, plays, exhausted_at
+`
+
+type SetFileViewLimitParams struct {
+	ID             int64 `json:"id"`
+	ViewLimit      int32 `json:"view_limit"`
+	UniqueViews    bool  `json:"unique_views"`
+	DestroyOnLimit bool  `json:"destroy_on_limit"`
+}
+
+func (q *Queries) SetFileViewLimit(ctx context.Context, arg SetFileViewLimitParams) (*File, error) {
+	row := q.db.QueryRow(ctx, setFileViewLimit,
+		arg.ID,
+		arg.ViewLimit,
+		arg.UniqueViews,
+		arg.DestroyOnLimit,
+	)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.DocumentID,
+		&i.FileName,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Hash,
+		&i.Views,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.PasswordHash,
+		&i.ViewLimit,
+		&i.UniqueViews,
+		&i.DestroyOnLimit,
+		&i.Plays,
+		&i.ExhaustedAt,
+	)
+	return &i, err
+}
+
+const setMirrorEnabled = `-- name: SetMirrorEnabled :one
+UPDATE mirrors
+SET enabled = $2
+WHERE id = $1
+RETURNING id, source_id, target_id, mime_filter, min_size, keyword, enabled, created_by, created_at
+`
+
+type SetMirrorEnabledParams struct {
+	ID      int64 `json:"id"`
+	Enabled bool  `json:"enabled"`
+}
+
+func (q *Queries) SetMirrorEnabled(ctx context.Context, arg SetMirrorEnabledParams) (*Mirror, error) {
+	row := q.db.QueryRow(ctx, setMirrorEnabled, arg.ID, arg.Enabled)
+	var i Mirror
+	err := row.Scan(
+		&i.ID,
+		&i.SourceID,
+		&i.TargetID,
+		&i.MimeFilter,
+		&i.MinSize,
+		&i.Keyword,
+		&i.Enabled,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const setMirrorFilters = `-- name: SetMirrorFilters :one
+UPDATE mirrors
+SET mime_filter = $2, min_size = $3, keyword = $4
+WHERE id = $1
+RETURNING id, source_id, target_id, mime_filter, min_size, keyword, enabled, created_by, created_at
+`
+
+type SetMirrorFiltersParams struct {
+	ID         int64  `json:"id"`
+	MimeFilter string `json:"mime_filter"`
+	MinSize    int64  `json:"min_size"`
+	Keyword    string `json:"keyword"`
+}
+
+func (q *Queries) SetMirrorFilters(ctx context.Context, arg SetMirrorFiltersParams) (*Mirror, error) {
+	row := q.db.QueryRow(ctx, setMirrorFilters,
+		arg.ID,
+		arg.MimeFilter,
+		arg.MinSize,
+		arg.Keyword,
+	)
+	var i Mirror
+	err := row.Scan(
+		&i.ID,
+		&i.SourceID,
+		&i.TargetID,
+		&i.MimeFilter,
+		&i.MinSize,
+		&i.Keyword,
+		&i.Enabled,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const setUserDeleted = `-- name: SetUserDeleted :one
 UPDATE users
-SET credit = credit + $2,
-    last_credit_update = now()
+SET is_deleted = $2
 WHERE id = $1
-RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
 `
 
-type IncrementCreditWithDateParams struct {
-	ID     int64 `json:"id"`
-	Credit int32 `json:"credit"`
+type SetUserDeletedParams struct {
+	ID        int64 `json:"id"`
+	IsDeleted bool  `json:"is_deleted"`
 }
 
-func (q *Queries) IncrementCreditWithDate(ctx context.Context, arg IncrementCreditWithDateParams) (*User, error) {
-	row := q.db.QueryRow(ctx, incrementCreditWithDate, arg.ID, arg.Credit)
+func (q *Queries) SetUserDeleted(ctx context.Context, arg SetUserDeletedParams) (*User, error) {
+	row := q.db.QueryRow(ctx, setUserDeleted, arg.ID, arg.IsDeleted)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -210,16 +2429,65 @@ func (q *Queries) IncrementCreditWithDate(ctx context.Context, arg IncrementCred
 		&i.IsDeleted,
 		&i.IsVerified,
 		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
 	)
 	return &i, err
 }
 
-const incrementTotalLinks = `-- name: IncrementTotalLinks :one
-UPDATE users SET total_links = total_links + 1 WHERE id = $1 RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
+const startBroadcast = `-- name: StartBroadcast :one
+UPDATE broadcasts
+SET status = 'running',
+    total = (SELECT COUNT(*) FROM broadcast_deliveries WHERE broadcast_id = $1)
+WHERE id = $1 AND status = 'scheduled'
+RETURNING id, created_by, channel_id, message_id, pin, status, send_at, total, created_at, finished_at, segment
 `
 
-func (q *Queries) IncrementTotalLinks(ctx context.Context, id int64) (*User, error) {
-	row := q.db.QueryRow(ctx, incrementTotalLinks, id)
+func (q *Queries) StartBroadcast(ctx context.Context, broadcastID int64) (*Broadcast, error) {
+	row := q.db.QueryRow(ctx, startBroadcast, broadcastID)
+	var i Broadcast
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.ChannelID,
+		&i.MessageID,
+		&i.Pin,
+		&i.Status,
+		&i.SendAt,
+		&i.Total,
+		&i.CreatedAt,
+		&i.FinishedAt,
+		&i.Segment,
+	)
+	return &i, err
+}
+
+const touchTicket = `-- name: TouchTicket :exec
+UPDATE tickets
+SET updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+func (q *Queries) TouchTicket(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, touchTicket, id)
+	return err
+}
+
+const touchUser = `-- name: TouchUser :one
+UPDATE users
+SET last_active_at = now(),
+    language = $2
+WHERE id = $1
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
+`
+
+type TouchUserParams struct {
+	ID       int64  `json:"id"`
+	Language string `json:"language"`
+}
+
+func (q *Queries) TouchUser(ctx context.Context, arg TouchUserParams) (*User, error) {
+	row := q.db.QueryRow(ctx, touchUser, arg.ID, arg.Language)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -232,6 +2500,8 @@ func (q *Queries) IncrementTotalLinks(ctx context.Context, id int64) (*User, err
 		&i.IsDeleted,
 		&i.IsVerified,
 		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
 	)
 	return &i, err
 }
@@ -244,7 +2514,7 @@ SET
     is_verified = $3,
     total_links = $4
 WHERE id = $5
-RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium
+RETURNING id, created_at, updated_at, total_links, credit, last_credit_update, is_banned, is_deleted, is_verified, is_premium, last_active_at, language
 `
 
 type UpdateUserByIDParams struct {
@@ -275,6 +2545,79 @@ func (q *Queries) UpdateUserByID(ctx context.Context, arg UpdateUserByIDParams)
 		&i.IsDeleted,
 		&i.IsVerified,
 		&i.IsPremium,
+		&i.LastActiveAt,
+		&i.Language,
+	)
+	return &i, err
+}
+
+const upsertAdmin = `-- name: UpsertAdmin :one
+INSERT INTO admins (user_id, role, granted_by)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by
+RETURNING user_id, role, granted_by, created_at
+`
+
+type UpsertAdminParams struct {
+	UserID    int64  `json:"user_id"`
+	Role      string `json:"role"`
+	GrantedBy int64  `json:"granted_by"`
+}
+
+func (q *Queries) UpsertAdmin(ctx context.Context, arg UpsertAdminParams) (*Admin, error) {
+	row := q.db.QueryRow(ctx, upsertAdmin, arg.UserID, arg.Role, arg.GrantedBy)
+	var i Admin
+	err := row.Scan(
+		&i.UserID,
+		&i.Role,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const upsertBotSession = `-- name: UpsertBotSession :exec
+INSERT INTO bot_sessions (key, data)
+VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE
+SET data = EXCLUDED.data,
+    updated_at = now()
+`
+
+type UpsertBotSessionParams struct {
+	Key  string `json:"key"`
+	Data []byte `json:"data"`
+}
+
+func (q *Queries) UpsertBotSession(ctx context.Context, arg UpsertBotSessionParams) error {
+	_, err := q.db.Exec(ctx, upsertBotSession, arg.Key, arg.Data)
+	return err
+}
+
+const upsertChannel = `-- name: UpsertChannel :one
+INSERT INTO channels (id, owner_id, title)
+VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE
+SET owner_id = EXCLUDED.owner_id, title = EXCLUDED.title, enabled = TRUE
+RETURNING id, owner_id, title, caption_template, enabled, created_at
+`
+
+type UpsertChannelParams struct {
+	ID      int64  `json:"id"`
+	OwnerID int64  `json:"owner_id"`
+	Title   string `json:"title"`
+}
+
+func (q *Queries) UpsertChannel(ctx context.Context, arg UpsertChannelParams) (*Channel, error) {
+	row := q.db.QueryRow(ctx, upsertChannel, arg.ID, arg.OwnerID, arg.Title)
+	var i Channel
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Title,
+		&i.CaptionTemplate,
+		&i.Enabled,
+		&i.CreatedAt,
 	)
 	return &i, err
 }
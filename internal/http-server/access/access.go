@@ -0,0 +1,190 @@
+// Package access guards the links of password protected files
+package access
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biisal/fast-stream-bot/config"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/biisal/fast-stream-bot/internal/redis"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// MaxAttemptsPerIP wrong passwords lock the file for one address, and
+	// MaxAttemptsPerFile for everyone, until LockMin minutes after the first
+	// wrong one.
+	MaxAttemptsPerIP   int64 = 5
+	MaxAttemptsPerFile int64 = 50
+	LockMin            int   = 15
+)
+
+var (
+	ErrWrongPassword = errors.New("wrong password")
+	ErrLocked        = errors.New("too many wrong passwords")
+)
+
+type Guard interface {
+	// Allowed reports whether the request may open f, files without a
+	// password are always allowed.
+	Allowed(r *http.Request, f *repo.File) bool
+	// Unlock checks password and sets the cookie allowing the browser to
+	// open f.
+	Unlock(w http.ResponseWriter, r *http.Request, f *repo.File, password string) error
+}
+
+type svc struct {
+	ttl    time.Duration
+	secret []byte
+	redis  redis.RedisService
+	cfg    config.Config
+}
+
+func NewGuard(ttl time.Duration, secret []byte, redis redis.RedisService, cfg config.Config) Guard {
+	return &svc{ttl, secret, redis, cfg}
+}
+
+func cookieName(f *repo.File) string {
+	return fmt.Sprintf("file_%d", f.ID)
+}
+
+// passwordTag changes with the password, so cookies stop working when the
+// owner changes it.
+func passwordTag(f *repo.File) string {
+	sum := sha256.Sum256([]byte(f.PasswordHash))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func (s *svc) Allowed(r *http.Request, f *repo.File) bool {
+	if f == nil || !filesvc.Protected(f) {
+		return true
+	}
+	cookie, err := r.Cookie(cookieName(f))
+	if err != nil {
+		return false
+	}
+	var claims jwt.RegisteredClaims
+	token, err := jwt.ParseWithClaims(cookie.Value, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.secret, nil
+	})
+	if err != nil || !token.Valid {
+		return false
+	}
+	return claims.Subject == strconv.FormatInt(f.ID, 10) && claims.ID == passwordTag(f)
+}
+
+// ClientIP is the address the request came from. Requests of a trusted proxy
+// carry the address of the client in X-Forwarded-For, the nearest address
+// which isn't a trusted proxy is the client, or in X-Real-IP. Other requests
+// can forge these headers, so their own address is used.
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrusted(host, trusted) {
+		return host
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if addr == "" {
+				continue
+			}
+			host = addr
+			if !isTrusted(addr, trusted) {
+				break
+			}
+		}
+		return host
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return host
+}
+
+func isTrusted(host string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func attemptsKey(f *repo.File, ip string) string {
+	if ip == "" {
+		return fmt.Sprintf("password:attempts:%d", f.ID)
+	}
+	return fmt.Sprintf("password:attempts:%d:%s", f.ID, ip)
+}
+
+// locked reports whether the wrong passwords counted at key reached limit. A
+// failing redis locks, the guard must not open up while it can't count.
+func (s *svc) locked(r *http.Request, key string, limit int64) bool {
+	n, err := s.redis.Counter(r.Context(), key)
+	if err != nil {
+		slog.Error("Failed to get password attempts, locking", "key", key, "error", err)
+		return true
+	}
+	return n >= limit
+}
+
+func (s *svc) Unlock(w http.ResponseWriter, r *http.Request, f *repo.File, password string) error {
+	ipKey, fileKey := attemptsKey(f, ClientIP(r, s.cfg.TRUSTED_PROXIES)), attemptsKey(f, "")
+	if s.locked(r, ipKey, MaxAttemptsPerIP) || s.locked(r, fileKey, MaxAttemptsPerFile) {
+		return ErrLocked
+	}
+	if !filesvc.CheckPassword(f, password) {
+		lock := time.Duration(LockMin) * time.Minute
+		for _, key := range []string{ipKey, fileKey} {
+			if _, err := s.redis.Incr(r.Context(), key, lock); err != nil {
+				slog.Error("Failed to count wrong password", "key", key, "error", err)
+			}
+		}
+		return ErrWrongPassword
+	}
+	s.redis.Del(r.Context(), ipKey)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.FormatInt(f.ID, 10),
+		ID:        passwordTag(f),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.ttl)),
+	})
+	tokenString, err := token.SignedString(s.secret)
+	if err != nil {
+		slog.Error("Failed to sign access token", "error", err)
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName(f),
+		Value:    tokenString,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.cfg.ENVIRONMENT == config.ENVIRONMENT_PROD,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(s.ttl.Seconds()),
+	})
+	return nil
+}
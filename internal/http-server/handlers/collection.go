@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/biisal/fast-stream-bot/internal/types"
+)
+
+// collectionFiles returns the public collection with slug and its files which
+// can still be served, the same files /watch would serve. Files with a
+// password or at their view limit are left out, their stream links would
+// only be refused.
+func (h *StreamHandler) collectionFiles(ctx context.Context, slug string) (*repo.Collection, []*repo.File, error) {
+	collection, err := h.CollectionService.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !collection.IsPublic {
+		return nil, nil, types.ErrorNotFound
+	}
+	files, err := h.CollectionService.Files(ctx, collection.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	servable := make([]*repo.File, 0, len(files))
+	for _, f := range files {
+		if filesvc.Servable(f) && !filesvc.Protected(f) && !filesvc.LimitReached(f) {
+			servable = append(servable, f)
+		}
+	}
+	return collection, servable, nil
+}
+
+func streamPath(f *repo.File) string {
+	return fmt.Sprintf("/stream/%d/%d/%s", f.ChannelID, f.MessageID, f.Hash)
+}
+
+func (h *StreamHandler) CollectionPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.PathValue("slug")
+		collection, files, err := h.collectionFiles(r.Context(), slug)
+		if err != nil {
+			slog.Error("Failed to get collection", "slug", slug, "error", err)
+			renderHTMLWithStatus(w, http.StatusNotFound, "error.html", &types.ErrorResponse{Error: "Collection not found. Check your URL"})
+			return
+		}
+		if len(files) == 0 {
+			renderHTMLWithStatus(w, http.StatusGone, "error.html", &types.ErrorResponse{Error: "This collection has no files left"})
+			return
+		}
+
+		data := &types.CollectionResponse{
+			Title:        collection.Title,
+			PlaylistLink: fmt.Sprintf("/c/%s/playlist.m3u", collection.Slug),
+			AppName:      h.Cfg.APP_NAME,
+		}
+		var totalSize int64
+		for _, f := range files {
+			totalSize += f.FileSize
+			data.Files = append(data.Files, types.CollectionFileResponse{
+				Title:        filesvc.Name(f),
+				Size:         botutils.MakeSizeReadable(f.FileSize),
+				WatchLink:    fmt.Sprintf("/watch/%d/%d?hash=%s", f.ChannelID, f.MessageID, f.Hash),
+				DownloadLink: streamPath(f) + "?d=1",
+			})
+		}
+		data.TotalSize = botutils.MakeSizeReadable(totalSize)
+		renderHTML(w, "collection.html", data)
+	}
+}
+
+// CollectionPlaylist exports the collection as an M3U playlist of stream links
+// for players like VLC.
+func (h *StreamHandler) CollectionPlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.PathValue("slug")
+		collection, files, err := h.collectionFiles(r.Context(), slug)
+		if err != nil {
+			slog.Error("Failed to get collection", "slug", slug, "error", err)
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		if len(files) == 0 {
+			http.Error(w, "This collection has no files left", http.StatusGone)
+			return
+		}
+
+		baseURL := fmt.Sprintf("%s://%s", h.Cfg.HTTP_SCHEME, r.Host)
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n")
+		fmt.Fprintf(&b, "#PLAYLIST:%s\n", playlistText(collection.Title))
+		for _, f := range files {
+			fmt.Fprintf(&b, "#EXTINF:-1,%s\n%s%s\n", playlistText(filesvc.Name(f)), baseURL, streamPath(f))
+		}
+		w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.m3u"`, collection.Slug))
+		if _, err := w.Write([]byte(b.String())); err != nil {
+			slog.Error("Failed to write playlist", "error", err)
+		}
+	}
+}
+
+// playlistText keeps a title from breaking the line based M3U format.
+func playlistText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -3,6 +3,8 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,15 +19,22 @@ import (
 	"github.com/biisal/fast-stream-bot/config"
 	"github.com/biisal/fast-stream-bot/internal/bot"
 	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/biisal/fast-stream-bot/internal/http-server/access"
 	"github.com/biisal/fast-stream-bot/internal/http-server/shortner"
+	collsvc "github.com/biisal/fast-stream-bot/internal/service/collection"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
 	"github.com/biisal/fast-stream-bot/internal/stream"
 	"github.com/biisal/fast-stream-bot/internal/types"
 )
 
 type StreamHandler struct {
-	Worker   *bot.Worker
-	Cfg      config.Config
-	Shortner shortner.Shortner
+	Worker            *bot.Worker
+	Cfg               config.Config
+	Shortner          shortner.Shortner
+	Guard             access.Guard
+	FileService       filesvc.Service
+	CollectionService collsvc.Service
 }
 
 func (h *StreamHandler) ServerFile() http.HandlerFunc {
@@ -43,6 +52,15 @@ func (h *StreamHandler) ServerFile() http.HandlerFunc {
 			isDownload = true
 		}
 		hash := r.PathValue("hash")
+		record, reason, gone := h.fileRecord(r.Context(), channelID, messageID)
+		if gone {
+			http.Error(w, reason, http.StatusGone)
+			return
+		}
+		if !h.Guard.Allowed(r, record) {
+			http.Error(w, "This file is protected by a password, open its watch page first", http.StatusUnauthorized)
+			return
+		}
 		bot, err := h.Worker.HireFreeWorker()
 		if bot == nil {
 			slog.Error("failed to get bots", "error", err)
@@ -51,7 +69,7 @@ func (h *StreamHandler) ServerFile() http.HandlerFunc {
 		}
 		defer h.Worker.ReleaseWorker(bot)
 
-		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelID, messageID, bot.Client.API())
+		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelID, messageID, bot.Peers)
 
 		if err != nil {
 			slog.Error("Failed to get file message", "error", err)
@@ -66,11 +84,23 @@ func (h *StreamHandler) ServerFile() http.HandlerFunc {
 			return
 		}
 
-		if !botutils.CheckFileHash(file, hash) {
+		if !validHash(file, record, hash) {
 			slog.Error("Invalid hash", "hash", hash)
 			http.Error(w, "Invalid hash", http.StatusForbidden)
 			return
 		}
+		if !h.countView(r, record) {
+			http.Error(w, limitReached, http.StatusGone)
+			return
+		}
+
+		if file.Size >= h.Cfg.LARGE_FILE_MB*1024*1024 {
+			if userbot, userbotFile := h.hireUserbot(r.Context(), channelID, messageID); userbot != nil {
+				defer h.Worker.ReleaseWorker(userbot)
+				bot, file = userbot, userbotFile
+			}
+		}
+		applyRecord(file, record)
 
 		reader := stream.NewTgFileReader(bot.Client.API(), r.Context(), file.Location, file, r)
 		if err = reader.SetupStream(r, w, isDownload); err != nil {
@@ -102,13 +132,115 @@ func (h *StreamHandler) ServerFile() http.HandlerFunc {
 
 }
 
+// hireUserbot hires a userbot and fetches the file with it, since file
+// locations are only valid for the account that fetched them. It returns nil
+// when no userbot is running or it can't read the message.
+func (h *StreamHandler) hireUserbot(ctx context.Context, channelID int64, messageID int) (*bot.Bot, *types.File) {
+	userbot := h.Worker.HireUserbot()
+	if userbot == nil {
+		return nil, nil
+	}
+	fileMsg, err := botutils.GetChannelMessage(ctx, channelID, messageID, userbot.Peers)
+	if err == nil {
+		var file *types.File
+		if file, err = botutils.GetMediaFromMessage(fileMsg); err == nil {
+			return userbot, file
+		}
+	}
+	slog.Warn("Userbot can't read the file, using a bot", "bot", userbot.BotUserName, "error", err)
+	h.Worker.ReleaseWorker(userbot)
+	return nil, nil
+}
+
+// fileRecord returns the record of the file of the message and whether it was
+// revoked, deleted or has expired. Messages without a file record have no
+// record and are always served.
+func (h *StreamHandler) fileRecord(ctx context.Context, channelID int64, messageID int) (*repo.File, string, bool) {
+	f, err := h.FileService.GetByMessage(ctx, channelID, messageID)
+	if err != nil {
+		if !errors.Is(err, types.ErrorNotFound) {
+			slog.Error("Failed to get file record", "error", err)
+		}
+		return nil, "", false
+	}
+	if filesvc.Servable(f) {
+		return f, "", false
+	}
+	switch f.Status {
+	case filesvc.StatusRevoked:
+		return f, "This link was revoked by its owner", true
+	case filesvc.StatusExhausted:
+		return f, limitReached, true
+	}
+	return f, "This link has expired", true
+}
+
+const limitReached = "This link reached its view limit"
+
+const invalidHash = "Invalid hash. Check your URL"
+
+// viewerID identifies the visitor for view limits without storing addresses.
+func (h *StreamHandler) viewerID(r *http.Request) string {
+	sum := sha256.Sum256([]byte(access.ClientIP(r, h.Cfg.TRUSTED_PROXIES)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// countView counts the view of a file with a view limit and tells its owner
+// when the view reached the limit. It reports whether the file may be served.
+func (h *StreamHandler) countView(r *http.Request, record *repo.File) bool {
+	// HEAD requests only ask about the file
+	if record == nil || record.ViewLimit <= 0 || r.Method == http.MethodHead {
+		return true
+	}
+	reached, err := h.FileService.View(r.Context(), record, h.viewerID(r))
+	if errors.Is(err, filesvc.ErrLimitReached) {
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to count file view", "id", record.ID, "error", err)
+		return true
+	}
+	if reached {
+		msg := fmt.Sprintf("The link of %s reached its limit of %d views and no longer works.", filesvc.Name(record), record.ViewLimit)
+		if record.DestroyOnLimit {
+			msg += fmt.Sprintf(" The file will be deleted in %d minutes.", bot.ExhaustedFileGraceMin)
+		} else {
+			msg += fmt.Sprintf(" Use /limit %d to allow more views.", record.ID)
+		}
+		go h.Worker.NotifyUser(record.OwnerID, msg)
+	}
+	return true
+}
+
+// validHash checks the hash of a link. Links of files with a record are
+// checked against the stored hash, which was made from the name Telegram has
+// for the file, so renaming a file keeps its links working.
+func validHash(file *types.File, record *repo.File, hash string) bool {
+	if record != nil && record.Hash == hash {
+		return true
+	}
+	return botutils.CheckFileHash(file, hash)
+}
+
+// applyRecord makes file use the name its owner gave it.
+func applyRecord(file *types.File, record *repo.File) {
+	if record != nil {
+		file.FileName = filesvc.Name(record)
+	}
+}
+
 func renderHTML(w http.ResponseWriter, htmlTemplate string, data any) {
+	renderHTMLWithStatus(w, http.StatusOK, htmlTemplate, data)
+}
+
+func renderHTMLWithStatus(w http.ResponseWriter, status int, htmlTemplate string, data any) {
 	t, err := template.ParseFiles("frontend/" + htmlTemplate)
 	if err != nil {
 		slog.Error("Failed to parse template", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(status)
 	err = t.Execute(w, data)
 	if err != nil {
 		slog.Error("Failed to execute template", "error", err)
@@ -127,6 +259,28 @@ func (h *StreamHandler) HomeStream() http.HandlerFunc {
 			return
 		}
 		hash := r.URL.Query().Get("hash")
+		record, reason, gone := h.fileRecord(r.Context(), channelID, messageID)
+		if gone {
+			errorResp.Error = reason
+			renderHTMLWithStatus(w, http.StatusGone, "error.html", errorResp)
+			return
+		}
+		if record != nil && !h.FileService.CanView(r.Context(), record, h.viewerID(r)) {
+			errorResp.Error = limitReached
+			renderHTMLWithStatus(w, http.StatusGone, "error.html", errorResp)
+			return
+		}
+		if !h.Guard.Allowed(r, record) {
+			// answered like any wrong hash, so it doesn't tell which files
+			// have a password
+			if hash != record.Hash {
+				errorResp.Error = invalidHash
+				renderHTML(w, "error.html", errorResp)
+				return
+			}
+			renderHTMLWithStatus(w, http.StatusUnauthorized, "password.html", h.passwordPage(""))
+			return
+		}
 		streamLink := fmt.Sprintf("/stream/%d/%d/%s", channelID, messageID, hash)
 
 		if strings.Contains(strings.ToLower(r.Header.Get("User-Agent")), "vlc") {
@@ -180,7 +334,7 @@ func (h *StreamHandler) HomeStream() http.HandlerFunc {
 		}
 		defer h.Worker.ReleaseWorker(client)
 
-		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelID, messageID, client.Client.API())
+		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelID, messageID, client.Peers)
 		if err != nil {
 			slog.Error("Failed to get file message", "error", err)
 			errorResp.Error = "Failed to get file message. Check your URL"
@@ -196,12 +350,13 @@ func (h *StreamHandler) HomeStream() http.HandlerFunc {
 			return
 		}
 
-		if !botutils.CheckFileHash(file, hash) {
+		if !validHash(file, record, hash) {
 			slog.Error("Invalid hash", "hash", hash)
-			errorResp.Error = "Invalid hash. Check your URL"
+			errorResp.Error = invalidHash
 			renderHTML(w, "error.html", errorResp)
 			return
 		}
+		applyRecord(file, record)
 
 		downloadLink := fmt.Sprintf("%s?d=1", streamLink)
 		var FileInfo = &types.FileResponse{
@@ -214,6 +369,10 @@ func (h *StreamHandler) HomeStream() http.HandlerFunc {
 			AppName:        h.Cfg.APP_NAME,
 		}
 
+		if err := h.FileService.IncrementViews(r.Context(), channelID, messageID); err != nil {
+			slog.Error("Failed to count file view", "error", err)
+		}
+
 		w.Header().Set("Cache-Control", "max-age=1200")
 		renderHTML(w, "index.html", FileInfo)
 	}
@@ -222,11 +381,8 @@ func (h *StreamHandler) HomeStream() http.HandlerFunc {
 func (h *StreamHandler) LandingPage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		botUsername := "biisal"
-		for _, bot := range h.Worker.Bots {
-			if bot.Default {
-				botUsername = bot.BotUserName
-				break
-			}
+		if bot := h.Worker.DefaultBot(); bot != nil {
+			botUsername = bot.BotUserName
 		}
 		var data = struct {
 			BotLink     string
@@ -263,7 +419,7 @@ func (h *StreamHandler) MakeHashByChanMsgID() http.HandlerFunc {
 		}
 		defer h.Worker.ReleaseWorker(bot)
 
-		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelId64, messageId, bot.Client.API())
+		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelId64, messageId, bot.Peers)
 		if err != nil {
 			slog.Error("Failed to get file message", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/http-server/access"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
+	"github.com/biisal/fast-stream-bot/internal/types"
+)
+
+func (h *StreamHandler) passwordPage(errMsg string) *types.PasswordResponse {
+	return &types.PasswordResponse{AppName: h.Cfg.APP_NAME, Error: errMsg}
+}
+
+// UnlockFile checks the password sent from the password page of a protected
+// file and opens its watch page.
+func (h *StreamHandler) UnlockFile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		messageID, channelID, err := botutils.ParseMessageAndChannelId(r.PathValue("messageId"), r.PathValue("channelId"), h.Cfg.DB_CHANNEL_ID)
+		if err != nil {
+			renderHTML(w, "error.html", &types.ErrorResponse{Error: err.Error()})
+			return
+		}
+		record, reason, gone := h.fileRecord(r.Context(), channelID, messageID)
+		if gone {
+			renderHTMLWithStatus(w, http.StatusGone, "error.html", &types.ErrorResponse{Error: reason})
+			return
+		}
+		watchPage := r.URL.RequestURI()
+		if record == nil || !filesvc.Protected(record) {
+			http.Redirect(w, r, watchPage, http.StatusSeeOther)
+			return
+		}
+		// only holders of the link may try passwords, so wrong ones can't be
+		// used to lock a file for everyone
+		if r.URL.Query().Get("hash") != record.Hash {
+			renderHTMLWithStatus(w, http.StatusNotFound, "error.html", &types.ErrorResponse{Error: invalidHash})
+			return
+		}
+
+		err = h.Guard.Unlock(w, r, record, r.PostFormValue("password"))
+		switch {
+		case err == nil:
+			http.Redirect(w, r, watchPage, http.StatusSeeOther)
+		case errors.Is(err, access.ErrWrongPassword):
+			renderHTMLWithStatus(w, http.StatusUnauthorized, "password.html", h.passwordPage("Wrong password, try again"))
+		case errors.Is(err, access.ErrLocked):
+			renderHTMLWithStatus(w, http.StatusTooManyRequests, "password.html",
+				h.passwordPage(fmt.Sprintf("Too many wrong passwords, try again in %d minutes", access.LockMin)))
+		default:
+			slog.Error("Failed to unlock file", "error", err)
+			renderHTMLWithStatus(w, http.StatusInternalServerError, "error.html", &types.ErrorResponse{Error: "Failed to unlock the file, try again"})
+		}
+	}
+}
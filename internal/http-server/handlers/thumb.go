@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	botutils "github.com/biisal/fast-stream-bot/internal/bot/bot-utils"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/gotd/td/telegram/downloader"
+)
+
+// Thumbnail serves the thumbnail Telegram made for a file, used as the picture
+// of inline results.
+func (h *StreamHandler) Thumbnail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		messageID, channelID, err := botutils.ParseMessageAndChannelId(r.PathValue("messageId"), r.PathValue("channelId"), h.Cfg.DB_CHANNEL_ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		record, reason, gone := h.fileRecord(r.Context(), channelID, messageID)
+		if gone {
+			http.Error(w, reason, http.StatusGone)
+			return
+		}
+		if !h.Guard.Allowed(r, record) {
+			http.Error(w, "This file is protected by a password", http.StatusUnauthorized)
+			return
+		}
+
+		bot, err := h.Worker.HireFreeWorker()
+		if bot == nil {
+			slog.Error("failed to get bots", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer h.Worker.ReleaseWorker(bot)
+
+		fileMsg, err := botutils.GetChannelMessage(r.Context(), channelID, messageID, bot.Peers)
+		if err != nil {
+			slog.Error("Failed to get file message", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		file, err := botutils.GetMediaFromMessage(fileMsg)
+		if err != nil || !validHash(file, record, r.PathValue("hash")) {
+			http.Error(w, "Invalid hash", http.StatusForbidden)
+			return
+		}
+		location, err := botutils.GetThumbLocation(fileMsg)
+		if err != nil {
+			if errors.Is(err, types.ErrorNotFound) {
+				http.Error(w, "This file has no thumbnail", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var thumb bytes.Buffer
+		if _, err := downloader.NewDownloader().Download(bot.Client.API(), location).Stream(r.Context(), &thumb); err != nil {
+			slog.Error("Failed to download thumbnail", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Cache-Control", "max-age=86400")
+		if _, err := w.Write(thumb.Bytes()); err != nil {
+			slog.Error("Failed to write thumbnail", "error", err)
+		}
+	}
+}
@@ -7,27 +7,44 @@ import (
 
 	"github.com/biisal/fast-stream-bot/config"
 	"github.com/biisal/fast-stream-bot/internal/bot"
+	"github.com/biisal/fast-stream-bot/internal/http-server/access"
 	"github.com/biisal/fast-stream-bot/internal/http-server/handlers"
 	"github.com/biisal/fast-stream-bot/internal/http-server/shortner"
+	collsvc "github.com/biisal/fast-stream-bot/internal/service/collection"
+	filesvc "github.com/biisal/fast-stream-bot/internal/service/file"
 )
 
 func GET(path string) string {
 	return fmt.Sprintf("GET %s", path)
 }
 
-func SetUpRouters(worker *bot.Worker, Cfg config.Config, shortner shortner.Shortner) *http.ServeMux {
+func POST(path string) string {
+	return fmt.Sprintf("POST %s", path)
+}
+
+func SetUpRouters(worker *bot.Worker, Cfg config.Config, shortner shortner.Shortner, guard access.Guard,
+	fileService filesvc.Service, collectionService collsvc.Service,
+) *http.ServeMux {
 	slog.Info("Setting up routers")
 	mux := http.NewServeMux()
-	h := handlers.StreamHandler{Worker: worker, Cfg: Cfg, Shortner: shortner}
+	h := handlers.StreamHandler{
+		Worker: worker, Cfg: Cfg, Shortner: shortner, Guard: guard,
+		FileService: fileService, CollectionService: collectionService,
+	}
 
 	mux.HandleFunc(GET("/ping"), h.Ping())
 
 	mux.Handle(GET("/stream/{messageId}/{hash}"), h.ServerFile())
 	mux.Handle(GET("/watch/{messageId}"), h.HomeStream())
+	mux.Handle(POST("/watch/{messageId}"), h.UnlockFile())
 
 	mux.Handle(GET("/stream/{channelId}/{messageId}/{hash}"), h.ServerFile())
 	mux.Handle(GET("/watch/{channelId}/{messageId}"), h.HomeStream())
+	mux.Handle(POST("/watch/{channelId}/{messageId}"), h.UnlockFile())
+	mux.Handle(GET("/thumb/{channelId}/{messageId}/{hash}"), h.Thumbnail())
 	mux.Handle(GET("/api/v1/hash/{channelId}/{messageId}"), h.MakeHashByChanMsgID())
+	mux.Handle(GET("/c/{slug}"), h.CollectionPage())
+	mux.Handle(GET("/c/{slug}/playlist.m3u"), h.CollectionPlaylist())
 	mux.Handle(GET("/"), h.LandingPage())
 
 	fs := http.FileServer(http.Dir("frontend/assets"))
@@ -0,0 +1,210 @@
+// Package peerstore keeps resolved peers and their access hashes in redis so
+// every bot can reuse them across requests and restarts
+package peerstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+)
+
+// Store implements peers.Storage and peers.Cache. Access hashes are only valid
+// for the account that received them, so every bot gets its own namespace.
+type Store struct {
+	redis  rs.RedisService
+	prefix string
+	ttl    time.Duration
+}
+
+var (
+	_ peers.Storage = (*Store)(nil)
+	_ peers.Cache   = (*Store)(nil)
+)
+
+// New creates a store for the given account, see AccountFromToken and
+// AccountFromPhone. Access hashes are kept forever, cached entities expire
+// after entityTTL.
+func New(redis rs.RedisService, account string, entityTTL time.Duration) *Store {
+	return &Store{
+		redis:  redis,
+		prefix: "peers:" + account + ":",
+		ttl:    entityTTL,
+	}
+}
+
+// AccountFromToken returns the bot id which prefixes every bot token.
+func AccountFromToken(token string) string {
+	id, _, _ := strings.Cut(token, ":")
+	return id
+}
+
+// AccountFromPhone returns the namespace of a user account logged in with phone.
+func AccountFromPhone(phone string) string {
+	return "user:" + strings.TrimPrefix(phone, "+")
+}
+
+// Manager builds a peers.Manager backed by the store.
+func (s *Store) Manager(api *tg.Client) *peers.Manager {
+	return peers.Options{Storage: s, Cache: s}.Build(api)
+}
+
+func (s *Store) key(parts ...any) string {
+	var sb strings.Builder
+	sb.WriteString(s.prefix)
+	for i, p := range parts {
+		if i > 0 {
+			sb.WriteByte(':')
+		}
+		fmt.Fprint(&sb, p)
+	}
+	return sb.String()
+}
+
+func (s *Store) getJSON(ctx context.Context, key string, v any) (bool, error) {
+	raw := s.redis.Get(ctx, key)
+	if len(raw) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) Save(ctx context.Context, key peers.Key, value peers.Value) error {
+	s.redis.Set(ctx, s.key("hash", key.Prefix, key.ID), value, 0)
+	return nil
+}
+
+func (s *Store) Find(ctx context.Context, key peers.Key) (peers.Value, bool, error) {
+	var value peers.Value
+	found, err := s.getJSON(ctx, s.key("hash", key.Prefix, key.ID), &value)
+	return value, found, err
+}
+
+func (s *Store) SavePhone(ctx context.Context, phone string, key peers.Key) error {
+	s.redis.Set(ctx, s.key("phone", phone), key, 0)
+	return nil
+}
+
+func (s *Store) FindPhone(ctx context.Context, phone string) (peers.Key, peers.Value, bool, error) {
+	var key peers.Key
+	found, err := s.getJSON(ctx, s.key("phone", phone), &key)
+	if err != nil || !found {
+		return peers.Key{}, peers.Value{}, false, err
+	}
+	value, found, err := s.Find(ctx, key)
+	return key, value, found, err
+}
+
+func (s *Store) GetContactsHash(ctx context.Context) (int64, error) {
+	var hash int64
+	_, err := s.getJSON(ctx, s.key("contacts_hash"), &hash)
+	return hash, err
+}
+
+func (s *Store) SaveContactsHash(ctx context.Context, hash int64) error {
+	s.redis.Set(ctx, s.key("contacts_hash"), hash, 0)
+	return nil
+}
+
+// entities are stored in their TL encoding since their interface typed
+// fields can't be decoded from json.
+func (s *Store) saveEntity(ctx context.Context, kind string, id int64, obj bin.Encoder) error {
+	var buf bin.Buffer
+	if err := obj.Encode(&buf); err != nil {
+		return err
+	}
+	s.redis.Set(ctx, s.key(kind, id), buf.Buf, s.ttl)
+	return nil
+}
+
+func (s *Store) findEntity(ctx context.Context, kind string, id int64, obj bin.Decoder) (bool, error) {
+	var data []byte
+	found, err := s.getJSON(ctx, s.key(kind, id), &data)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := obj.Decode(&bin.Buffer{Buf: data}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) SaveUsers(ctx context.Context, users ...*tg.User) error {
+	for _, u := range users {
+		if err := s.saveEntity(ctx, "user", u.ID, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) FindUser(ctx context.Context, id int64) (*tg.User, bool, error) {
+	u := &tg.User{}
+	found, err := s.findEntity(ctx, "user", id, u)
+	return u, found, err
+}
+
+func (s *Store) SaveChats(ctx context.Context, chats ...*tg.Chat) error {
+	for _, c := range chats {
+		if err := s.saveEntity(ctx, "chat", c.ID, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) FindChat(ctx context.Context, id int64) (*tg.Chat, bool, error) {
+	c := &tg.Chat{}
+	found, err := s.findEntity(ctx, "chat", id, c)
+	return c, found, err
+}
+
+func (s *Store) SaveChannels(ctx context.Context, channels ...*tg.Channel) error {
+	for _, c := range channels {
+		if err := s.saveEntity(ctx, "channel", c.ID, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) FindChannel(ctx context.Context, id int64) (*tg.Channel, bool, error) {
+	c := &tg.Channel{}
+	found, err := s.findEntity(ctx, "channel", id, c)
+	return c, found, err
+}
+
+// Full entities change often and are rarely needed, they are not cached.
+
+func (s *Store) SaveUserFulls(ctx context.Context, users ...*tg.UserFull) error {
+	return nil
+}
+
+func (s *Store) FindUserFull(ctx context.Context, id int64) (*tg.UserFull, bool, error) {
+	return nil, false, nil
+}
+
+func (s *Store) SaveChatFulls(ctx context.Context, chats ...*tg.ChatFull) error {
+	return nil
+}
+
+func (s *Store) FindChatFull(ctx context.Context, id int64) (*tg.ChatFull, bool, error) {
+	return nil, false, nil
+}
+
+func (s *Store) SaveChannelFulls(ctx context.Context, channels ...*tg.ChannelFull) error {
+	return nil
+}
+
+func (s *Store) FindChannelFull(ctx context.Context, id int64) (*tg.ChannelFull, bool, error) {
+	return nil, false, nil
+}
@@ -13,6 +13,13 @@ type RedisService interface {
 	Get(ctx context.Context, key string) []byte
 	Set(ctx context.Context, key string, value any, ttl time.Duration)
 	Del(ctx context.Context, key string)
+	// Incr increments the counter at key and returns its new value, the first
+	// increment starts its ttl.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Counter returns the value of the counter at key, 0 if there is none.
+	// Unlike Get it returns the error of redis, for callers which must not
+	// treat a failure as a missing key.
+	Counter(ctx context.Context, key string) (int64, error)
 }
 
 type svc struct {
@@ -66,3 +73,24 @@ func (c *svc) Del(ctx context.Context, key string) {
 		slog.Error("Failed to delete data from redis", "error", err)
 	}
 }
+
+func (c *svc) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, err := c.r.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := c.r.Expire(ctx, key, ttl).Err(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *svc) Counter(ctx context.Context, key string) (int64, error) {
+	n, err := c.r.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,100 @@
+// Package admin contains the service keeping the roles of the bot's staff
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+)
+
+type Service interface {
+	// Role returns the name of the user's role, empty for users without one.
+	// It is used on every command, so it is cached.
+	Role(ctx context.Context, userID int64) (string, error)
+	List(ctx context.Context) ([]*repo.Admin, error)
+	// Grant gives the user role, replacing the role the user had.
+	Grant(ctx context.Context, userID int64, role string, grantedBy int64) (*repo.Admin, error)
+	// Revoke removes the role of the user.
+	Revoke(ctx context.Context, userID int64) (*repo.Admin, error)
+}
+
+type svc struct {
+	repo         repo.Querier
+	redisService rs.RedisService
+	ttl          time.Duration
+}
+
+func NewService(repo repo.Querier, redis rs.RedisService, ttl time.Duration) Service {
+	return &svc{
+		repo:         repo,
+		redisService: redis,
+		ttl:          ttl,
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func roleKey(userID int64) string {
+	return fmt.Sprintf("role:%d", userID)
+}
+
+func (s *svc) Role(ctx context.Context, userID int64) (string, error) {
+	key := roleKey(userID)
+	if cached := s.redisService.Get(ctx, key); len(cached) > 0 {
+		var role string
+		if err := json.Unmarshal(cached, &role); err == nil {
+			return role, nil
+		}
+		slog.Warn("Failed to unmarshal role from redis continue to get from db", "key", key)
+	}
+	var role string
+	a, err := s.repo.GetAdmin(ctx, userID)
+	switch {
+	case err == nil:
+		role = a.Role
+	case !errors.Is(err, pgx.ErrNoRows):
+		return "", err
+	}
+	// users without a role are cached too, most users have none
+	s.redisService.Set(ctx, key, role, s.ttl)
+	return role, nil
+}
+
+func (s *svc) List(ctx context.Context) ([]*repo.Admin, error) {
+	return s.repo.GetAdmins(ctx)
+}
+
+func (s *svc) Grant(ctx context.Context, userID int64, role string, grantedBy int64) (*repo.Admin, error) {
+	a, err := s.repo.UpsertAdmin(ctx, repo.UpsertAdminParams{
+		UserID:    userID,
+		Role:      role,
+		GrantedBy: grantedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.redisService.Del(ctx, roleKey(userID))
+	return a, nil
+}
+
+func (s *svc) Revoke(ctx context.Context, userID int64) (*repo.Admin, error) {
+	a, err := s.repo.DeleteAdmin(ctx, userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Del(ctx, roleKey(userID))
+	return a, nil
+}
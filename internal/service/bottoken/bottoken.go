@@ -0,0 +1,157 @@
+// Package bottoken contains the service persisting worker bot tokens and the
+// cipher keeping them and other secrets encrypted at rest
+package bottoken
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrNoSecret  = errors.New("BOT_TOKEN_SECRET is not set, runtime bot tokens can't be stored")
+	ErrDuplicate = errors.New("bot token already exists")
+)
+
+type Service interface {
+	// Add stores token encrypted at rest.
+	Add(ctx context.Context, token, botUsername string, addedBy int64) error
+	// GetAll returns all stored tokens decrypted. Tokens that can't be
+	// decrypted (e.g. after the secret changed) are skipped.
+	GetAll(ctx context.Context) ([]string, error)
+	// RemoveByUsername deletes the token of the given bot and reports whether
+	// one was stored.
+	RemoveByUsername(ctx context.Context, botUsername string) (bool, error)
+}
+
+type svc struct {
+	repo   repo.Querier
+	cipher *Cipher
+}
+
+// NewService creates the token service. secret may be of any length, the
+// AES-256 key is derived from it.
+func NewService(repo repo.Querier, secret string) Service {
+	return &svc{repo: repo, cipher: NewCipher(secret)}
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeUsername(botUsername string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(botUsername), "@"))
+}
+
+// Cipher encrypts secrets at rest with AES-GCM, bot tokens and the sessions
+// of worker clients alike.
+type Cipher struct {
+	key []byte
+}
+
+// NewCipher derives the AES-256 key from secret, it returns nil for an empty
+// secret. A nil Cipher fails with ErrNoSecret.
+func NewCipher(secret string) *Cipher {
+	if secret == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return &Cipher{key: sum[:]}
+}
+
+func (c *Cipher) gcm() (cipher.AEAD, error) {
+	if c == nil {
+		return nil, ErrNoSecret
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts plain with a random nonce prepended.
+func (c *Cipher) Seal(plain []byte) ([]byte, error) {
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Open decrypts data sealed by Seal.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+	nonce, cipherText := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, cipherText, nil)
+}
+
+func (s *svc) Add(ctx context.Context, token, botUsername string, addedBy int64) error {
+	encrypted, err := s.cipher.Seal([]byte(token))
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.CreateBotToken(ctx, repo.CreateBotTokenParams{
+		TokenHash:      HashToken(token),
+		EncryptedToken: encrypted,
+		BotUsername:    normalizeUsername(botUsername),
+		AddedBy:        addedBy,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return ErrDuplicate
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *svc) GetAll(ctx context.Context) ([]string, error) {
+	if s.cipher == nil {
+		return nil, nil
+	}
+	rows, err := s.repo.GetAllBotTokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0, len(rows))
+	for _, row := range rows {
+		token, err := s.cipher.Open(row.EncryptedToken)
+		if err != nil {
+			slog.Error("Failed to decrypt stored bot token", "bot_username", row.BotUsername, "error", err)
+			continue
+		}
+		tokens = append(tokens, string(token))
+	}
+	return tokens, nil
+}
+
+func (s *svc) RemoveByUsername(ctx context.Context, botUsername string) (bool, error) {
+	n, err := s.repo.DeleteBotTokenByUsername(ctx, normalizeUsername(botUsername))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
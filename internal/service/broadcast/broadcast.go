@@ -0,0 +1,269 @@
+// Package broadcast contains the service keeping broadcast jobs and the
+// delivery of their message to every user, so they survive restarts
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	StatusScheduled = "scheduled"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusCancelled = "cancelled"
+
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	// DeliveryBlocked users blocked the bot or deleted their account.
+	DeliveryBlocked = "blocked"
+)
+
+// ErrUserGone wraps send errors of users who blocked the bot or deleted their
+// account.
+var ErrUserGone = errors.New("user blocked the bot or is deleted")
+
+// Segment picks the users a broadcast goes to, zero values match every user.
+// Banned and deleted users never get broadcasts.
+type Segment struct {
+	// ActiveDays matches users who used the bot in the last ActiveDays days.
+	ActiveDays int32 `json:"active_days,omitempty"`
+	Premium    bool  `json:"premium,omitempty"`
+	Verified   bool  `json:"verified,omitempty"`
+	// MinCredit and MaxCredit are inclusive.
+	MinCredit   *int32     `json:"min_credit,omitempty"`
+	MaxCredit   *int32     `json:"max_credit,omitempty"`
+	JoinedAfter *time.Time `json:"joined_after,omitempty"`
+	// Language is the language code of the user's Telegram app, e.g. "en".
+	Language string `json:"language,omitempty"`
+}
+
+func (s Segment) String() string {
+	var parts []string
+	if s.ActiveDays > 0 {
+		parts = append(parts, fmt.Sprintf("active in the last %d days", s.ActiveDays))
+	}
+	if s.Premium {
+		parts = append(parts, "premium")
+	}
+	if s.Verified {
+		parts = append(parts, "verified")
+	}
+	switch {
+	case s.MinCredit != nil && s.MaxCredit != nil:
+		parts = append(parts, fmt.Sprintf("%d to %d credits", *s.MinCredit, *s.MaxCredit))
+	case s.MinCredit != nil:
+		parts = append(parts, fmt.Sprintf("at least %d credits", *s.MinCredit))
+	case s.MaxCredit != nil:
+		parts = append(parts, fmt.Sprintf("at most %d credits", *s.MaxCredit))
+	}
+	if s.JoinedAfter != nil {
+		parts = append(parts, "joined after "+s.JoinedAfter.Format(time.DateOnly))
+	}
+	if s.Language != "" {
+		parts = append(parts, "language "+s.Language)
+	}
+	if len(parts) == 0 {
+		return "all users"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DecodeSegment returns the segment b was created with.
+func DecodeSegment(b *repo.Broadcast) Segment {
+	var s Segment
+	if err := json.Unmarshal(b.Segment, &s); err != nil {
+		slog.Warn("Failed to unmarshal broadcast segment", "id", b.ID, "error", err)
+	}
+	return s
+}
+
+func (s Segment) params() repo.CountSegmentParams {
+	arg := repo.CountSegmentParams{
+		ActiveDays: s.ActiveDays,
+		Premium:    s.Premium,
+		Verified:   s.Verified,
+		Language:   s.Language,
+	}
+	if s.MinCredit != nil {
+		arg.MinCredit = pgtype.Int4{Int32: *s.MinCredit, Valid: true}
+	}
+	if s.MaxCredit != nil {
+		arg.MaxCredit = pgtype.Int4{Int32: *s.MaxCredit, Valid: true}
+	}
+	if s.JoinedAfter != nil {
+		arg.JoinedAfter = timestamp(*s.JoinedAfter)
+	}
+	return arg
+}
+
+type Service interface {
+	// Create stores a broadcast of the message messageID of channelID to the
+	// users of segment, which starts at sendAt.
+	Create(ctx context.Context, createdBy, channelID int64, messageID int, pin bool, sendAt time.Time, segment Segment) (*repo.Broadcast, error)
+	// Count returns how many users a broadcast to segment would reach now.
+	Count(ctx context.Context, segment Segment) (int64, error)
+	Get(ctx context.Context, id int64) (*repo.Broadcast, error)
+	// List returns the newest broadcasts.
+	List(ctx context.Context, limit int) ([]*repo.Broadcast, error)
+	// Due returns the running broadcasts and the scheduled ones whose time
+	// has come, the oldest first.
+	Due(ctx context.Context) ([]*repo.Broadcast, error)
+	// Start adds a pending delivery for every user of its segment and marks
+	// the broadcast running. Users joining later don't get a running broadcast.
+	Start(ctx context.Context, id int64) (*repo.Broadcast, error)
+	// Finish marks a running broadcast done, it returns ErrorNotFound if it
+	// was cancelled meanwhile.
+	Finish(ctx context.Context, id int64) (*repo.Broadcast, error)
+	// Cancel stops a scheduled or running broadcast, it returns ErrorNotFound
+	// if it is neither.
+	Cancel(ctx context.Context, id int64) (*repo.Broadcast, error)
+	// Pending returns up to limit users which didn't get the broadcast yet.
+	Pending(ctx context.Context, id int64, limit int) ([]*repo.BroadcastDelivery, error)
+	// SetDelivered stores the result of sending the broadcast to a user, a nil
+	// sendErr marks it sent and one wrapping ErrUserGone blocked.
+	SetDelivered(ctx context.Context, id, userID int64, sendErr error) error
+	Counts(ctx context.Context, id int64) (*repo.CountDeliveriesRow, error)
+	Failed(ctx context.Context, id int64) ([]*repo.BroadcastDelivery, error)
+}
+
+type svc struct {
+	repo repo.Querier
+}
+
+func NewService(repo repo.Querier) Service {
+	return &svc{repo: repo}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func timestamp(t time.Time) pgtype.Timestamp {
+	return pgtype.Timestamp{Time: t.UTC(), Valid: true}
+}
+
+func (s *svc) Create(ctx context.Context, createdBy, channelID int64, messageID int, pin bool, sendAt time.Time, segment Segment) (*repo.Broadcast, error) {
+	raw, err := json.Marshal(segment)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.CreateBroadcast(ctx, repo.CreateBroadcastParams{
+		CreatedBy: createdBy,
+		ChannelID: channelID,
+		MessageID: int32(messageID),
+		Pin:       pin,
+		SendAt:    timestamp(sendAt),
+		Segment:   raw,
+	})
+}
+
+func (s *svc) Count(ctx context.Context, segment Segment) (int64, error) {
+	return s.repo.CountSegment(ctx, segment.params())
+}
+
+func (s *svc) Get(ctx context.Context, id int64) (*repo.Broadcast, error) {
+	b, err := s.repo.GetBroadcast(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return b, nil
+}
+
+func (s *svc) List(ctx context.Context, limit int) ([]*repo.Broadcast, error) {
+	return s.repo.GetBroadcasts(ctx, int32(limit))
+}
+
+func (s *svc) Due(ctx context.Context) ([]*repo.Broadcast, error) {
+	return s.repo.GetDueBroadcasts(ctx, timestamp(time.Now()))
+}
+
+func (s *svc) Start(ctx context.Context, id int64) (*repo.Broadcast, error) {
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status != StatusScheduled {
+		return b, nil
+	}
+	// the deliveries are added again if the bot stopped before marking it
+	// running, the conflict keeps them once
+	arg := DecodeSegment(b).params()
+	if _, err := s.repo.AddBroadcastDeliveries(ctx, repo.AddBroadcastDeliveriesParams{
+		BroadcastID: id,
+		ActiveDays:  arg.ActiveDays,
+		Premium:     arg.Premium,
+		Verified:    arg.Verified,
+		MinCredit:   arg.MinCredit,
+		MaxCredit:   arg.MaxCredit,
+		JoinedAfter: arg.JoinedAfter,
+		Language:    arg.Language,
+	}); err != nil {
+		return nil, err
+	}
+	b, err = s.repo.StartBroadcast(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.Get(ctx, id)
+	}
+	return b, err
+}
+
+func (s *svc) Finish(ctx context.Context, id int64) (*repo.Broadcast, error) {
+	b, err := s.repo.FinishBroadcast(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return b, nil
+}
+
+func (s *svc) Cancel(ctx context.Context, id int64) (*repo.Broadcast, error) {
+	b, err := s.repo.CancelBroadcast(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return b, nil
+}
+
+func (s *svc) Pending(ctx context.Context, id int64, limit int) ([]*repo.BroadcastDelivery, error) {
+	return s.repo.GetPendingDeliveries(ctx, repo.GetPendingDeliveriesParams{
+		BroadcastID: id,
+		Limit:       int32(limit),
+	})
+}
+
+func (s *svc) SetDelivered(ctx context.Context, id, userID int64, sendErr error) error {
+	arg := repo.SetDeliveryStatusParams{
+		BroadcastID: id,
+		UserID:      userID,
+		Status:      DeliverySent,
+	}
+	switch {
+	case errors.Is(sendErr, ErrUserGone):
+		arg.Status, arg.Error = DeliveryBlocked, sendErr.Error()
+	case sendErr != nil:
+		arg.Status, arg.Error = DeliveryFailed, sendErr.Error()
+	}
+	return s.repo.SetDeliveryStatus(ctx, arg)
+}
+
+func (s *svc) Counts(ctx context.Context, id int64) (*repo.CountDeliveriesRow, error) {
+	return s.repo.CountDeliveries(ctx, id)
+}
+
+func (s *svc) Failed(ctx context.Context, id int64) ([]*repo.BroadcastDelivery, error) {
+	return s.repo.GetFailedDeliveries(ctx, id)
+}
@@ -0,0 +1,127 @@
+// Package channel contains the service keeping the settings of channels users
+// registered for auto-linking
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNotOwner = errors.New("channel belongs to another user")
+
+type Service interface {
+	// Register stores the channel for ownerID, or moves it to ownerID and
+	// enables it when it was registered before.
+	Register(ctx context.Context, channelID, ownerID int64, title string) (*repo.Channel, error)
+	// Get is used on every channel post, so it is cached.
+	Get(ctx context.Context, channelID int64) (*repo.Channel, error)
+	// Owned returns the channel if userID may change it.
+	Owned(ctx context.Context, channelID, userID int64, isAdmin bool) (*repo.Channel, error)
+	ListByOwner(ctx context.Context, ownerID int64) ([]*repo.Channel, error)
+	SetTemplate(ctx context.Context, channelID int64, template string) (*repo.Channel, error)
+	SetEnabled(ctx context.Context, channelID int64, enabled bool) (*repo.Channel, error)
+	Delete(ctx context.Context, channelID int64) error
+}
+
+type svc struct {
+	repo         repo.Querier
+	redisService rs.RedisService
+	ttl          time.Duration
+}
+
+func NewService(repo repo.Querier, redis rs.RedisService, ttl time.Duration) Service {
+	return &svc{
+		repo:         repo,
+		redisService: redis,
+		ttl:          ttl,
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func channelKey(channelID int64) string {
+	return fmt.Sprintf("channel:%d", channelID)
+}
+
+func (s *svc) cache(ctx context.Context, c *repo.Channel, err error) (*repo.Channel, error) {
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Set(ctx, channelKey(c.ID), c, s.ttl)
+	return c, nil
+}
+
+func (s *svc) Register(ctx context.Context, channelID, ownerID int64, title string) (*repo.Channel, error) {
+	c, err := s.repo.UpsertChannel(ctx, repo.UpsertChannelParams{
+		ID:      channelID,
+		OwnerID: ownerID,
+		Title:   title,
+	})
+	return s.cache(ctx, c, err)
+}
+
+func (s *svc) Get(ctx context.Context, channelID int64) (*repo.Channel, error) {
+	key := channelKey(channelID)
+	if cached := s.redisService.Get(ctx, key); len(cached) > 0 {
+		var c repo.Channel
+		if err := json.Unmarshal(cached, &c); err == nil {
+			return &c, nil
+		}
+		slog.Warn("Failed to unmarshal channel from redis continue to get from db", "key", key)
+	}
+	c, err := s.repo.GetChannel(ctx, channelID)
+	return s.cache(ctx, c, err)
+}
+
+func (s *svc) Owned(ctx context.Context, channelID, userID int64, isAdmin bool) (*repo.Channel, error) {
+	c, err := s.Get(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if c.OwnerID != userID && !isAdmin {
+		return nil, ErrNotOwner
+	}
+	return c, nil
+}
+
+func (s *svc) ListByOwner(ctx context.Context, ownerID int64) ([]*repo.Channel, error) {
+	return s.repo.GetChannelsByOwner(ctx, ownerID)
+}
+
+func (s *svc) SetTemplate(ctx context.Context, channelID int64, template string) (*repo.Channel, error) {
+	c, err := s.repo.SetChannelTemplate(ctx, repo.SetChannelTemplateParams{
+		ID:              channelID,
+		CaptionTemplate: template,
+	})
+	return s.cache(ctx, c, err)
+}
+
+func (s *svc) SetEnabled(ctx context.Context, channelID int64, enabled bool) (*repo.Channel, error) {
+	c, err := s.repo.SetChannelEnabled(ctx, repo.SetChannelEnabledParams{
+		ID:      channelID,
+		Enabled: enabled,
+	})
+	return s.cache(ctx, c, err)
+}
+
+func (s *svc) Delete(ctx context.Context, channelID int64) error {
+	if err := s.repo.DeleteChannel(ctx, channelID); err != nil {
+		return err
+	}
+	s.redisService.Del(ctx, channelKey(channelID))
+	return nil
+}
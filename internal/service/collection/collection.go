@@ -0,0 +1,197 @@
+// Package collection contains the service grouping files into shareable collections
+package collection
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	SlugLength int = 10
+)
+
+const slugAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var ErrNotOwner = errors.New("collection belongs to another user")
+
+type Service interface {
+	// Create stores a collection of fileIDs in the given order.
+	Create(ctx context.Context, ownerID int64, title string, fileIDs []int64) (*repo.Collection, error)
+	GetBySlug(ctx context.Context, slug string) (*repo.Collection, error)
+	// Owned returns the collection with id if userID may change it.
+	Owned(ctx context.Context, id, userID int64, isAdmin bool) (*repo.Collection, error)
+	// ListByOwner returns the newest collections of the owner with their
+	// number of files.
+	ListByOwner(ctx context.Context, ownerID int64, limit int) ([]*repo.GetCollectionsByOwnerRow, error)
+	// Files returns the files of the collection in their order.
+	Files(ctx context.Context, collectionID int64) ([]*repo.File, error)
+	// AddFiles appends the files which aren't in the collection yet.
+	AddFiles(ctx context.Context, collectionID int64, fileIDs []int64) error
+	RemoveFiles(ctx context.Context, collectionID int64, fileIDs []int64) error
+	// Move puts the file at index, counted from zero, and shifts the others.
+	Move(ctx context.Context, collectionID, fileID int64, index int) error
+	SetPublic(ctx context.Context, id int64, public bool) (*repo.Collection, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type svc struct {
+	repo repo.Querier
+}
+
+func NewService(repo repo.Querier) Service {
+	return &svc{repo: repo}
+}
+
+// NewSlug returns a random slug, so collections can't be guessed.
+func NewSlug() string {
+	b := make([]byte, SlugLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = slugAlphabet[int(b[i])%len(slugAlphabet)]
+	}
+	return string(b)
+}
+
+func (s *svc) Create(ctx context.Context, ownerID int64, title string, fileIDs []int64) (*repo.Collection, error) {
+	c, err := s.repo.CreateCollection(ctx, repo.CreateCollectionParams{
+		Slug:    NewSlug(),
+		OwnerID: ownerID,
+		Title:   title,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range fileIDs {
+		if err := s.repo.AddCollectionFile(ctx, repo.AddCollectionFileParams{
+			CollectionID: c.ID,
+			FileID:       id,
+			Position:     int32(i),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to add file %d to collection: %w", id, err)
+		}
+	}
+	return c, nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func (s *svc) GetBySlug(ctx context.Context, slug string) (*repo.Collection, error) {
+	c, err := s.repo.GetCollectionBySlug(ctx, slug)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (s *svc) Owned(ctx context.Context, id, userID int64, isAdmin bool) (*repo.Collection, error) {
+	c, err := s.repo.GetCollectionByID(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if c.OwnerID != userID && !isAdmin {
+		return nil, ErrNotOwner
+	}
+	return c, nil
+}
+
+func (s *svc) ListByOwner(ctx context.Context, ownerID int64, limit int) ([]*repo.GetCollectionsByOwnerRow, error) {
+	return s.repo.GetCollectionsByOwner(ctx, repo.GetCollectionsByOwnerParams{
+		OwnerID: ownerID,
+		Limit:   int32(limit),
+	})
+}
+
+func (s *svc) Files(ctx context.Context, collectionID int64) ([]*repo.File, error) {
+	return s.repo.GetCollectionFiles(ctx, collectionID)
+}
+
+func (s *svc) AddFiles(ctx context.Context, collectionID int64, fileIDs []int64) error {
+	current, err := s.repo.GetCollectionFileIDs(ctx, collectionID)
+	if err != nil {
+		return err
+	}
+	position := len(current)
+	for _, id := range fileIDs {
+		if slices.Contains(current, id) {
+			continue
+		}
+		if err := s.repo.AddCollectionFile(ctx, repo.AddCollectionFileParams{
+			CollectionID: collectionID,
+			FileID:       id,
+			Position:     int32(position),
+		}); err != nil {
+			return fmt.Errorf("failed to add file %d to collection: %w", id, err)
+		}
+		current = append(current, id)
+		position++
+	}
+	return nil
+}
+
+func (s *svc) RemoveFiles(ctx context.Context, collectionID int64, fileIDs []int64) error {
+	for _, id := range fileIDs {
+		if err := s.repo.RemoveCollectionFile(ctx, repo.RemoveCollectionFileParams{
+			CollectionID: collectionID,
+			FileID:       id,
+		}); err != nil {
+			return err
+		}
+	}
+	current, err := s.repo.GetCollectionFileIDs(ctx, collectionID)
+	if err != nil {
+		return err
+	}
+	return s.setOrder(ctx, collectionID, current)
+}
+
+func (s *svc) Move(ctx context.Context, collectionID, fileID int64, index int) error {
+	current, err := s.repo.GetCollectionFileIDs(ctx, collectionID)
+	if err != nil {
+		return err
+	}
+	from := slices.Index(current, fileID)
+	if from < 0 {
+		return types.ErrorNotFound
+	}
+	index = max(0, min(index, len(current)-1))
+	current = slices.Insert(slices.Delete(current, from, from+1), index, fileID)
+	return s.setOrder(ctx, collectionID, current)
+}
+
+// setOrder numbers the files of the collection in the order of fileIDs.
+func (s *svc) setOrder(ctx context.Context, collectionID int64, fileIDs []int64) error {
+	for i, id := range fileIDs {
+		if err := s.repo.SetCollectionFilePosition(ctx, repo.SetCollectionFilePositionParams{
+			CollectionID: collectionID,
+			FileID:       id,
+			Position:     int32(i),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *svc) SetPublic(ctx context.Context, id int64, public bool) (*repo.Collection, error) {
+	c, err := s.repo.SetCollectionPublic(ctx, repo.SetCollectionPublicParams{ID: id, IsPublic: public})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (s *svc) Delete(ctx context.Context, id int64) error {
+	return s.repo.DeleteCollection(ctx, id)
+}
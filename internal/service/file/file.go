@@ -0,0 +1,457 @@
+// Package file contains the service keeping track of files users uploaded
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	StatusActive  = "active"
+	StatusDeleted = "deleted"
+	StatusRevoked = "revoked"
+	StatusExpired = "expired"
+	// StatusExhausted files reached their view limit and were deleted.
+	StatusExhausted = "exhausted"
+)
+
+const (
+	// MaxNameLength is the longest display name users may give a file.
+	MaxNameLength int = 128
+	// MinPasswordLength and MaxPasswordLength bound link passwords, bcrypt
+	// only uses the first 72 bytes.
+	MinPasswordLength int = 4
+	MaxPasswordLength int = 72
+	// ViewWindowMin is how long the requests of a viewer count as one view,
+	// players fetch a file with many range requests.
+	ViewWindowMin int = 60
+)
+
+var (
+	ErrNotOwner        = errors.New("file belongs to another user")
+	ErrInvalidName     = errors.New("invalid file name")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrLimitReached    = errors.New("view limit reached")
+)
+
+// Limit is the view limit of a file, a zero Views removes it.
+type Limit struct {
+	Views int
+	// Unique counts every viewer once instead of every view.
+	Unique bool
+	// Destroy deletes the file once the limit is reached.
+	Destroy bool
+}
+
+type Service interface {
+	Create(ctx context.Context, params repo.CreateFileParams) (*repo.File, error)
+	GetByID(ctx context.Context, id int64) (*repo.File, error)
+	// GetByMessage is used on every stream request, so it is cached.
+	GetByMessage(ctx context.Context, channelID int64, messageID int) (*repo.File, error)
+	// ListByOwner returns one page of the owner's active files, newest first,
+	// and the total number of them.
+	ListByOwner(ctx context.Context, ownerID int64, page, pageSize int) ([]*repo.File, int64, error)
+	// Search returns the owner's active files whose name contains query,
+	// newest first.
+	Search(ctx context.Context, ownerID int64, query string, offset, limit int) ([]*repo.File, error)
+	// Delete marks the file deleted. Only the owner or an admin may delete it.
+	Delete(ctx context.Context, id, userID int64, isAdmin bool) (*repo.File, error)
+	// Revoke disables the file's link. Only the owner or an admin may revoke it.
+	Revoke(ctx context.Context, id, userID int64, isAdmin bool) (*repo.File, error)
+	// SetExpiry makes the file's link stop working at expiresAt, nil removes
+	// the expiry. Only the owner or an admin may change it.
+	SetExpiry(ctx context.Context, id, userID int64, isAdmin bool, expiresAt *time.Time) (*repo.File, error)
+	// Rename sets the name the file is shown and downloaded with, an empty
+	// name restores the original one. Links keep working. Only the owner or an
+	// admin may rename it.
+	Rename(ctx context.Context, id, userID int64, isAdmin bool, name string) (*repo.File, error)
+	// SetPassword protects the file's links with password, an empty password
+	// removes the protection. Only the owner or an admin may change it.
+	SetPassword(ctx context.Context, id, userID int64, isAdmin bool, password string) (*repo.File, error)
+	// SetLimit sets the view limit of the file and starts counting from zero.
+	// Only the owner or an admin may change it.
+	SetLimit(ctx context.Context, id, userID int64, isAdmin bool, limit Limit) (*repo.File, error)
+	// CanView reports whether viewer may open the file, i.e. it is under its
+	// limit or viewer's view was already counted.
+	CanView(ctx context.Context, f *repo.File, viewer string) bool
+	// View counts a view of the file by viewer, once per ViewWindowMin or
+	// once at all for unique limits. It returns ErrLimitReached if viewer
+	// can't open the file anymore and whether this view reached the limit.
+	View(ctx context.Context, f *repo.File, viewer string) (bool, error)
+	// GetExhausted returns up to limit active files to destroy whose limit was
+	// reached before t.
+	GetExhausted(ctx context.Context, t time.Time, limit int) ([]*repo.File, error)
+	MarkExhausted(ctx context.Context, id int64) error
+	// GetExpired returns up to limit active files which expired before t.
+	GetExpired(ctx context.Context, t time.Time, limit int) ([]*repo.File, error)
+	MarkExpired(ctx context.Context, id int64) error
+	IncrementViews(ctx context.Context, channelID int64, messageID int) error
+}
+
+type svc struct {
+	repo         repo.Querier
+	redisService rs.RedisService
+	ttl          time.Duration
+}
+
+func NewService(repo repo.Querier, redis rs.RedisService, ttl time.Duration) Service {
+	return &svc{
+		repo:         repo,
+		redisService: redis,
+		ttl:          ttl,
+	}
+}
+
+// Servable reports whether the file's link still works.
+func Servable(f *repo.File) bool {
+	if f.Status != StatusActive {
+		return false
+	}
+	return !f.ExpiresAt.Valid || f.ExpiresAt.Time.After(time.Now())
+}
+
+// Timestamp converts t to a nullable UTC timestamp, nil becomes NULL.
+func Timestamp(t *time.Time) pgtype.Timestamp {
+	if t == nil {
+		return pgtype.Timestamp{}
+	}
+	return pgtype.Timestamp{Time: t.UTC(), Valid: true}
+}
+
+// Name is the name the file is shown and downloaded with, its display name if
+// the owner renamed it.
+func Name(f *repo.File) string {
+	if f.DisplayName != "" {
+		return f.DisplayName
+	}
+	return f.FileName
+}
+
+// CleanName checks a name a user chose for a file. Names without an extension
+// keep the extension of original, so players still recognise the file.
+func CleanName(name, original string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(name, `/\"`) || strings.ContainsFunc(name, unicode.IsControl) {
+		return "", fmt.Errorf("%w, it can't contain / \\ or \"", ErrInvalidName)
+	}
+	if path.Ext(name) == "" {
+		name += path.Ext(original)
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return "", fmt.Errorf("%w, it can have up to %d characters", ErrInvalidName, MaxNameLength)
+	}
+	return name, nil
+}
+
+// Protected reports whether the file's links ask for a password.
+func Protected(f *repo.File) bool {
+	return f.PasswordHash != ""
+}
+
+// CheckPassword reports whether password opens the file.
+func CheckPassword(f *repo.File, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(f.PasswordHash), []byte(password)) == nil
+}
+
+// LimitReached reports whether the file was viewed as often as its limit
+// allows.
+func LimitReached(f *repo.File) bool {
+	return f.ViewLimit > 0 && f.Plays >= int64(f.ViewLimit)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func messageKey(channelID int64, messageID int) string {
+	return fmt.Sprintf("file:%d:%d", channelID, messageID)
+}
+
+func viewKey(id int64, viewer string) string {
+	return fmt.Sprintf("view:%d:%s", id, viewer)
+}
+
+func (s *svc) Create(ctx context.Context, params repo.CreateFileParams) (*repo.File, error) {
+	f, err := s.repo.CreateFile(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	s.redisService.Set(ctx, messageKey(f.ChannelID, int(f.MessageID)), f, s.ttl)
+	return f, nil
+}
+
+func (s *svc) GetByID(ctx context.Context, id int64) (*repo.File, error) {
+	f, err := s.repo.GetFileByID(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return f, nil
+}
+
+func (s *svc) GetByMessage(ctx context.Context, channelID int64, messageID int) (*repo.File, error) {
+	key := messageKey(channelID, messageID)
+	if cached := s.redisService.Get(ctx, key); len(cached) > 0 {
+		var f repo.File
+		if err := json.Unmarshal(cached, &f); err == nil {
+			return &f, nil
+		}
+		slog.Warn("Failed to unmarshal file from redis continue to get from db", "key", key)
+	}
+
+	f, err := s.repo.GetFileByMessage(ctx, repo.GetFileByMessageParams{
+		ChannelID: channelID,
+		MessageID: int32(messageID),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Set(ctx, key, f, s.ttl)
+	return f, nil
+}
+
+func (s *svc) ListByOwner(ctx context.Context, ownerID int64, page, pageSize int) ([]*repo.File, int64, error) {
+	total, err := s.repo.CountFilesByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	files, err := s.repo.GetFilesByOwner(ctx, repo.GetFilesByOwnerParams{
+		OwnerID: ownerID,
+		Limit:   int32(pageSize),
+		Offset:  int32(page * pageSize),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+func (s *svc) Search(ctx context.Context, ownerID int64, query string, offset, limit int) ([]*repo.File, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+	return s.repo.SearchFilesByOwner(ctx, repo.SearchFilesByOwnerParams{
+		OwnerID:  ownerID,
+		FileName: "%" + escaped + "%",
+		Limit:    int32(limit),
+		Offset:   int32(offset),
+	})
+}
+
+// ownedFile returns the active file with id if userID may change it.
+func (s *svc) ownedFile(ctx context.Context, id, userID int64, isAdmin bool) (*repo.File, error) {
+	f, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if f.OwnerID != userID && !isAdmin {
+		return nil, ErrNotOwner
+	}
+	if f.Status != StatusActive {
+		return nil, types.ErrorNotFound
+	}
+	return f, nil
+}
+
+func (s *svc) setStatus(ctx context.Context, id int64, status string) (*repo.File, error) {
+	f, err := s.repo.SetFileStatus(ctx, repo.SetFileStatusParams{ID: id, Status: status})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Del(ctx, messageKey(f.ChannelID, int(f.MessageID)))
+	return f, nil
+}
+
+func (s *svc) Delete(ctx context.Context, id, userID int64, isAdmin bool) (*repo.File, error) {
+	if _, err := s.ownedFile(ctx, id, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	return s.setStatus(ctx, id, StatusDeleted)
+}
+
+func (s *svc) Revoke(ctx context.Context, id, userID int64, isAdmin bool) (*repo.File, error) {
+	if _, err := s.ownedFile(ctx, id, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	return s.setStatus(ctx, id, StatusRevoked)
+}
+
+func (s *svc) SetExpiry(ctx context.Context, id, userID int64, isAdmin bool, expiresAt *time.Time) (*repo.File, error) {
+	if _, err := s.ownedFile(ctx, id, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	f, err := s.repo.SetFileExpiry(ctx, repo.SetFileExpiryParams{ID: id, ExpiresAt: Timestamp(expiresAt)})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Del(ctx, messageKey(f.ChannelID, int(f.MessageID)))
+	return f, nil
+}
+
+func (s *svc) Rename(ctx context.Context, id, userID int64, isAdmin bool, name string) (*repo.File, error) {
+	f, err := s.ownedFile(ctx, id, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if name, err = CleanName(name, f.FileName); err != nil {
+		return nil, err
+	}
+	f, err = s.repo.SetFileDisplayName(ctx, repo.SetFileDisplayNameParams{ID: id, DisplayName: name})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Del(ctx, messageKey(f.ChannelID, int(f.MessageID)))
+	return f, nil
+}
+
+func (s *svc) SetPassword(ctx context.Context, id, userID int64, isAdmin bool, password string) (*repo.File, error) {
+	if _, err := s.ownedFile(ctx, id, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	var passwordHash string
+	if password != "" {
+		if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+			return nil, fmt.Errorf("%w, it needs %d to %d characters", ErrInvalidPassword, MinPasswordLength, MaxPasswordLength)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = string(hash)
+	}
+	f, err := s.repo.SetFilePassword(ctx, repo.SetFilePasswordParams{ID: id, PasswordHash: passwordHash})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Del(ctx, messageKey(f.ChannelID, int(f.MessageID)))
+	return f, nil
+}
+
+func (s *svc) SetLimit(ctx context.Context, id, userID int64, isAdmin bool, limit Limit) (*repo.File, error) {
+	if _, err := s.ownedFile(ctx, id, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	f, err := s.repo.SetFileViewLimit(ctx, repo.SetFileViewLimitParams{
+		ID:             id,
+		ViewLimit:      int32(max(limit.Views, 0)),
+		UniqueViews:    limit.Unique,
+		DestroyOnLimit: limit.Destroy,
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if err := s.repo.DeleteFileViewers(ctx, id); err != nil {
+		slog.Error("Failed to reset file viewers", "id", id, "error", err)
+	}
+	s.redisService.Del(ctx, messageKey(f.ChannelID, int(f.MessageID)))
+	return f, nil
+}
+
+func (s *svc) CanView(ctx context.Context, f *repo.File, viewer string) bool {
+	if !LimitReached(f) || len(s.redisService.Get(ctx, viewKey(f.ID, viewer))) > 0 {
+		return true
+	}
+	if !f.UniqueViews {
+		return false
+	}
+	_, err := s.repo.GetFileViewer(ctx, repo.GetFileViewerParams{FileID: f.ID, Viewer: viewer})
+	return err == nil
+}
+
+func (s *svc) View(ctx context.Context, f *repo.File, viewer string) (bool, error) {
+	if f.ViewLimit <= 0 {
+		return false, nil
+	}
+	key := viewKey(f.ID, viewer)
+	window := time.Duration(ViewWindowMin) * time.Minute
+	if f.UniqueViews {
+		if len(s.redisService.Get(ctx, key)) > 0 {
+			return false, nil
+		}
+		_, err := s.repo.AddFileViewer(ctx, repo.AddFileViewerParams{FileID: f.ID, Viewer: viewer})
+		if errors.Is(err, pgx.ErrNoRows) {
+			s.redisService.Set(ctx, key, true, window)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	} else {
+		// without redis every range request of a player would count as a play
+		n, err := s.redisService.Incr(ctx, key, window)
+		if err != nil {
+			return false, err
+		}
+		if n > 1 {
+			return false, nil
+		}
+	}
+
+	counted, err := s.repo.CountFilePlay(ctx, f.ID)
+	if err != nil {
+		if f.UniqueViews {
+			if err := s.repo.DeleteFileViewer(ctx, repo.DeleteFileViewerParams{FileID: f.ID, Viewer: viewer}); err != nil {
+				slog.Error("Failed to remove file viewer", "id", f.ID, "error", err)
+			}
+		}
+		s.redisService.Del(ctx, key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrLimitReached
+		}
+		return false, err
+	}
+	if f.UniqueViews {
+		s.redisService.Set(ctx, key, true, window)
+	}
+	s.redisService.Del(ctx, messageKey(counted.ChannelID, int(counted.MessageID)))
+	return counted.Plays == int64(counted.ViewLimit), nil
+}
+
+func (s *svc) GetExhausted(ctx context.Context, t time.Time, limit int) ([]*repo.File, error) {
+	return s.repo.GetExhaustedFiles(ctx, repo.GetExhaustedFilesParams{
+		ExhaustedAt: Timestamp(&t),
+		Limit:       int32(limit),
+	})
+}
+
+func (s *svc) MarkExhausted(ctx context.Context, id int64) error {
+	_, err := s.setStatus(ctx, id, StatusExhausted)
+	return err
+}
+
+func (s *svc) GetExpired(ctx context.Context, t time.Time, limit int) ([]*repo.File, error) {
+	return s.repo.GetExpiredFiles(ctx, repo.GetExpiredFilesParams{
+		ExpiresAt: Timestamp(&t),
+		Limit:     int32(limit),
+	})
+}
+
+func (s *svc) MarkExpired(ctx context.Context, id int64) error {
+	_, err := s.setStatus(ctx, id, StatusExpired)
+	return err
+}
+
+func (s *svc) IncrementViews(ctx context.Context, channelID int64, messageID int) error {
+	return s.repo.IncrementFileViews(ctx, repo.IncrementFileViewsParams{
+		ChannelID: channelID,
+		MessageID: int32(messageID),
+	})
+}
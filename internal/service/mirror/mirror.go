@@ -0,0 +1,199 @@
+// Package mirror contains the service keeping source to target channel pairs
+// whose new files the bot reposts with their links
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// Filters limit which files of the source are mirrored. Zero values match
+// every file.
+type Filters struct {
+	// MimeTypes is a comma separated list of mime type prefixes, e.g.
+	// "video/,application/pdf".
+	MimeTypes string
+	MinSize   int64
+	// Keyword has to be in the file name or the caption, ignoring case.
+	Keyword string
+}
+
+type Service interface {
+	Create(ctx context.Context, sourceID, targetID, createdBy int64) (*repo.Mirror, error)
+	Get(ctx context.Context, id int64) (*repo.Mirror, error)
+	List(ctx context.Context) ([]*repo.Mirror, error)
+	// BySource returns the enabled mirrors of the source. It is used on every
+	// channel post, so it is cached.
+	BySource(ctx context.Context, sourceID int64) ([]*repo.Mirror, error)
+	SetFilters(ctx context.Context, id int64, filters Filters) (*repo.Mirror, error)
+	SetEnabled(ctx context.Context, id int64, enabled bool) (*repo.Mirror, error)
+	Delete(ctx context.Context, id int64) error
+	// Claim marks the document as mirrored. It returns false when it was
+	// mirrored before, so reposts and backfills don't post it twice.
+	Claim(ctx context.Context, mirrorID, documentID int64, messageID int) (bool, error)
+	// Release undoes Claim after mirroring failed.
+	Release(ctx context.Context, mirrorID, documentID int64) error
+}
+
+type svc struct {
+	repo         repo.Querier
+	redisService rs.RedisService
+	ttl          time.Duration
+}
+
+func NewService(repo repo.Querier, redis rs.RedisService, ttl time.Duration) Service {
+	return &svc{
+		repo:         repo,
+		redisService: redis,
+		ttl:          ttl,
+	}
+}
+
+// Matches reports whether file, posted with caption, passes the filters of m.
+func Matches(m *repo.Mirror, file *types.File, caption string) bool {
+	if file.Size < m.MinSize {
+		return false
+	}
+	if m.MimeFilter != "" {
+		matched := false
+		for prefix := range strings.SplitSeq(m.MimeFilter, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" && strings.HasPrefix(file.MimeType, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if m.Keyword != "" {
+		keyword := strings.ToLower(m.Keyword)
+		return strings.Contains(strings.ToLower(file.FileName), keyword) ||
+			strings.Contains(strings.ToLower(caption), keyword)
+	}
+	return true
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func sourceKey(sourceID int64) string {
+	return fmt.Sprintf("mirrors:%d", sourceID)
+}
+
+// changed drops the cached mirrors of the source of m.
+func (s *svc) changed(ctx context.Context, m *repo.Mirror, err error) (*repo.Mirror, error) {
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.redisService.Del(ctx, sourceKey(m.SourceID))
+	return m, nil
+}
+
+func (s *svc) Create(ctx context.Context, sourceID, targetID, createdBy int64) (*repo.Mirror, error) {
+	m, err := s.repo.CreateMirror(ctx, repo.CreateMirrorParams{
+		SourceID:  sourceID,
+		TargetID:  targetID,
+		CreatedBy: createdBy,
+	})
+	return s.changed(ctx, m, err)
+}
+
+func (s *svc) Get(ctx context.Context, id int64) (*repo.Mirror, error) {
+	m, err := s.repo.GetMirror(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return m, nil
+}
+
+func (s *svc) List(ctx context.Context) ([]*repo.Mirror, error) {
+	return s.repo.GetMirrors(ctx)
+}
+
+func (s *svc) BySource(ctx context.Context, sourceID int64) ([]*repo.Mirror, error) {
+	key := sourceKey(sourceID)
+	if cached := s.redisService.Get(ctx, key); len(cached) > 0 {
+		var mirrors []*repo.Mirror
+		if err := json.Unmarshal(cached, &mirrors); err == nil {
+			return mirrors, nil
+		}
+		slog.Warn("Failed to unmarshal mirrors from redis continue to get from db", "key", key)
+	}
+	mirrors, err := s.repo.GetMirrorsBySource(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if mirrors == nil {
+		// cache channels without mirrors too, most posts come from them
+		mirrors = []*repo.Mirror{}
+	}
+	s.redisService.Set(ctx, key, mirrors, s.ttl)
+	return mirrors, nil
+}
+
+func (s *svc) SetFilters(ctx context.Context, id int64, filters Filters) (*repo.Mirror, error) {
+	m, err := s.repo.SetMirrorFilters(ctx, repo.SetMirrorFiltersParams{
+		ID:         id,
+		MimeFilter: filters.MimeTypes,
+		MinSize:    filters.MinSize,
+		Keyword:    filters.Keyword,
+	})
+	return s.changed(ctx, m, err)
+}
+
+func (s *svc) SetEnabled(ctx context.Context, id int64, enabled bool) (*repo.Mirror, error) {
+	m, err := s.repo.SetMirrorEnabled(ctx, repo.SetMirrorEnabledParams{
+		ID:      id,
+		Enabled: enabled,
+	})
+	return s.changed(ctx, m, err)
+}
+
+func (s *svc) Delete(ctx context.Context, id int64) error {
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteMirror(ctx, id); err != nil {
+		return err
+	}
+	s.redisService.Del(ctx, sourceKey(m.SourceID))
+	return nil
+}
+
+func (s *svc) Claim(ctx context.Context, mirrorID, documentID int64, messageID int) (bool, error) {
+	_, err := s.repo.ClaimMirrorPost(ctx, repo.ClaimMirrorPostParams{
+		MirrorID:        mirrorID,
+		DocumentID:      documentID,
+		SourceMessageID: int32(messageID),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *svc) Release(ctx context.Context, mirrorID, documentID int64) error {
+	return s.repo.DeleteMirrorPost(ctx, repo.DeleteMirrorPostParams{
+		MirrorID:   mirrorID,
+		DocumentID: documentID,
+	})
+}
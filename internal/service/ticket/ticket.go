@@ -0,0 +1,155 @@
+// Package ticket contains the service keeping support tickets and which
+// messages of the support group and the user's chat belong to them
+package ticket
+
+import (
+	"context"
+	"errors"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	"github.com/biisal/fast-stream-bot/internal/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+)
+
+type Service interface {
+	// Open returns the open ticket of a user, a new one with subject if the
+	// user has none. created reports whether it is new.
+	Open(ctx context.Context, userID int64, subject string) (t *repo.Ticket, created bool, err error)
+	// Current returns the open ticket of a user, ErrorNotFound if the user
+	// has none.
+	Current(ctx context.Context, userID int64) (*repo.Ticket, error)
+	Get(ctx context.Context, id int64) (*repo.Ticket, error)
+	// List returns the tickets with status, every ticket for an empty status,
+	// the last updated first.
+	List(ctx context.Context, status string, limit int) ([]*repo.Ticket, error)
+	// ByUser returns the newest tickets of a user.
+	ByUser(ctx context.Context, userID int64, limit int) ([]*repo.Ticket, error)
+	// Close closes an open ticket, it returns ErrorNotFound if the ticket
+	// isn't open.
+	Close(ctx context.Context, id, closedBy int64) (*repo.Ticket, error)
+	// AddMessage links a message relayed to the support group to its copy in
+	// the user's chat.
+	AddMessage(ctx context.Context, ticketID, senderID int64, groupMessageID, userMessageID int) error
+	// ByGroupMessage returns the ticket of a message of the support group.
+	ByGroupMessage(ctx context.Context, groupMessageID int) (*repo.Ticket, error)
+	// ByUserMessage returns the ticket of a message of the user's chat.
+	ByUserMessage(ctx context.Context, userID int64, userMessageID int) (*repo.Ticket, error)
+}
+
+type svc struct {
+	repo repo.Querier
+}
+
+func NewService(repo repo.Querier) Service {
+	return &svc{repo: repo}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrorNotFound
+	}
+	return err
+}
+
+func (s *svc) Open(ctx context.Context, userID int64, subject string) (*repo.Ticket, bool, error) {
+	t, err := s.repo.GetOpenTicket(ctx, userID)
+	if err == nil {
+		return t, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+	t, err = s.repo.CreateTicket(ctx, repo.CreateTicketParams{
+		UserID:  userID,
+		Subject: subject,
+	})
+	if err != nil {
+		// a ticket opened by another message meanwhile
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			t, err = s.repo.GetOpenTicket(ctx, userID)
+			return t, false, notFound(err)
+		}
+		return nil, false, err
+	}
+	return t, true, nil
+}
+
+func (s *svc) Current(ctx context.Context, userID int64) (*repo.Ticket, error) {
+	t, err := s.repo.GetOpenTicket(ctx, userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return t, nil
+}
+
+func (s *svc) Get(ctx context.Context, id int64) (*repo.Ticket, error) {
+	t, err := s.repo.GetTicket(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return t, nil
+}
+
+func (s *svc) List(ctx context.Context, status string, limit int) ([]*repo.Ticket, error) {
+	return s.repo.GetTickets(ctx, repo.GetTicketsParams{
+		Status:  status,
+		MaxRows: int32(limit),
+	})
+}
+
+func (s *svc) ByUser(ctx context.Context, userID int64, limit int) ([]*repo.Ticket, error) {
+	return s.repo.GetUserTickets(ctx, repo.GetUserTicketsParams{
+		UserID: userID,
+		Limit:  int32(limit),
+	})
+}
+
+func (s *svc) Close(ctx context.Context, id, closedBy int64) (*repo.Ticket, error) {
+	t, err := s.repo.CloseTicket(ctx, repo.CloseTicketParams{
+		ID:       id,
+		ClosedBy: pgtype.Int8{Int64: closedBy, Valid: true},
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return t, nil
+}
+
+func (s *svc) AddMessage(ctx context.Context, ticketID, senderID int64, groupMessageID, userMessageID int) error {
+	if err := s.repo.AddTicketMessage(ctx, repo.AddTicketMessageParams{
+		TicketID:       ticketID,
+		SenderID:       senderID,
+		GroupMessageID: int32(groupMessageID),
+		UserMessageID:  int32(userMessageID),
+	}); err != nil {
+		return err
+	}
+	return s.repo.TouchTicket(ctx, ticketID)
+}
+
+func (s *svc) ByGroupMessage(ctx context.Context, groupMessageID int) (*repo.Ticket, error) {
+	m, err := s.repo.GetTicketMessageByGroup(ctx, int32(groupMessageID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s.Get(ctx, m.TicketID)
+}
+
+func (s *svc) ByUserMessage(ctx context.Context, userID int64, userMessageID int) (*repo.Ticket, error) {
+	m, err := s.repo.GetTicketMessageByUser(ctx, repo.GetTicketMessageByUserParams{
+		UserMessageID: int32(userMessageID),
+		UserID:        userID,
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s.Get(ctx, m.TicketID)
+}
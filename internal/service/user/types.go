@@ -6,14 +6,17 @@ type TgUser struct {
 	FirstName  string `json:"first_name"`
 	LastName   string `json:"last_name"`
 	AccessHash int64  `json:"access_hash"`
+	// LangCode is the language of the user's Telegram app, e.g. "en".
+	LangCode string `json:"lang_code"`
 }
 
-func NewTgUser(id int64, username, firstName, lastName string, accessHash int64) *TgUser {
+func NewTgUser(id int64, username, firstName, lastName string, accessHash int64, langCode string) *TgUser {
 	return &TgUser{
 		ID:         id,
 		Username:   username,
 		FirstName:  firstName,
 		LastName:   lastName,
 		AccessHash: accessHash,
+		LangCode:   langCode,
 	}
 }
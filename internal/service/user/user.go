@@ -27,6 +27,12 @@ type Service interface {
 	IncrementTotalLinkCount(ctx context.Context, id int64) (*repo.User, error)
 	GetAllUsers(ctx context.Context) ([]*repo.User, error)
 	UpdateUser(ctx context.Context, user *repo.User) (*repo.User, error)
+	// SetDeleted marks users who blocked the bot or deleted their account,
+	// they are left out of counts and broadcasts until they come back.
+	SetDeleted(ctx context.Context, id int64, deleted bool) (*repo.User, error)
+	// Touch stores that the user used the bot now and the language of the
+	// user's app, broadcasts are targeted by both.
+	Touch(ctx context.Context, id int64, language string) (*repo.User, error)
 	GetUserInfo(ctx context.Context, m *tg.Message, e tg.Entities) *TgUser
 }
 
@@ -154,6 +160,36 @@ func (s *svc) UpdateUser(ctx context.Context, user *repo.User) (*repo.User, erro
 	return u, nil
 }
 
+func (s *svc) SetDeleted(ctx context.Context, id int64, deleted bool) (*repo.User, error) {
+	u, err := s.repo.SetUserDeleted(ctx, repo.SetUserDeletedParams{
+		ID:        id,
+		IsDeleted: deleted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("user:%d", id)
+	if deleted {
+		// GetUserByTgID doesn't return deleted users
+		s.redisService.Del(ctx, key)
+	} else {
+		s.redisService.Set(ctx, key, u, s.ttl)
+	}
+	return u, nil
+}
+
+func (s *svc) Touch(ctx context.Context, id int64, language string) (*repo.User, error) {
+	u, err := s.repo.TouchUser(ctx, repo.TouchUserParams{
+		ID:       id,
+		Language: language,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.redisService.Set(ctx, fmt.Sprintf("user:%d", id), u, s.ttl)
+	return u, nil
+}
+
 func (s *svc) GetUserInfo(ctx context.Context, m *tg.Message, e tg.Entities) *TgUser {
 	var userID int64
 	if u, ok := m.FromID.(*tg.PeerUser); ok {
@@ -180,14 +216,16 @@ func (s *svc) GetUserInfo(ctx context.Context, m *tg.Message, e tg.Entities) *Tg
 		tgUser = NewTgUser(peer.UserID, e.Users[peer.UserID].Username,
 			e.Users[peer.UserID].FirstName,
 			e.Users[peer.UserID].LastName,
-			e.Users[peer.UserID].AccessHash)
+			e.Users[peer.UserID].AccessHash,
+			e.Users[peer.UserID].LangCode)
 	default:
 		if m.FromID != nil {
 			if fromUser, ok := m.FromID.(*tg.PeerUser); ok {
 				tgUser = NewTgUser(fromUser.UserID, e.Users[fromUser.UserID].Username,
 					e.Users[fromUser.UserID].FirstName,
 					e.Users[fromUser.UserID].LastName,
-					e.Users[fromUser.UserID].AccessHash)
+					e.Users[fromUser.UserID].AccessHash,
+					e.Users[fromUser.UserID].LangCode)
 			}
 		}
 	}
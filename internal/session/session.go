@@ -0,0 +1,215 @@
+// Package session persists MTProto sessions of worker clients so restarts
+// don't have to authorize every bot again
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	repo "github.com/biisal/fast-stream-bot/internal/database/psql/sqlc"
+	rs "github.com/biisal/fast-stream-bot/internal/redis"
+	"github.com/biisal/fast-stream-bot/internal/service/bottoken"
+	tgsession "github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	BackendMemory   = "memory"
+	BackendFile     = "file"
+	BackendPostgres = "postgres"
+	BackendRedis    = "redis"
+)
+
+// Storage is a telegram.SessionStorage that can drop the stored session, e.g.
+// after Telegram revoked its auth key.
+type Storage interface {
+	telegram.SessionStorage
+	Reset(ctx context.Context) error
+}
+
+// Factory returns the storage of the session identified by key.
+type Factory func(key string) Storage
+
+// ErrNoSecret is returned for a persistent backend without BOT_TOKEN_SECRET.
+var ErrNoSecret = errors.New("BOT_TOKEN_SECRET is not set, sessions can't be stored")
+
+// NewFactory returns a Factory for the given backend. dir is only used by the
+// file backend. A stored auth key is as good as the bot token, so sessions are
+// stored encrypted by secrets. Without secrets sessions are kept in memory
+// unless a backend was set, which fails with ErrNoSecret.
+func NewFactory(backend, dir string, repo repo.Querier, redis rs.RedisService, secrets *bottoken.Cipher) (Factory, error) {
+	if backend != BackendMemory && secrets == nil {
+		if backend != "" {
+			return nil, ErrNoSecret
+		}
+		slog.Warn("BOT_TOKEN_SECRET is not set, sessions are kept in memory only")
+		backend = BackendMemory
+	}
+	switch backend {
+	case "", BackendFile:
+		if dir == "" {
+			dir = "sessions"
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create session dir: %w", err)
+		}
+		return func(key string) Storage {
+			return validate(key, encrypt(&fileStorage{tgsession.FileStorage{Path: filepath.Join(dir, key+".json")}}, secrets))
+		}, nil
+	case BackendPostgres:
+		return func(key string) Storage {
+			return validate(key, encrypt(&pgStorage{key: key, repo: repo}, secrets))
+		}, nil
+	case BackendRedis:
+		return func(key string) Storage {
+			return validate(key, encrypt(&redisStorage{key: "session:" + key, redis: redis}, secrets))
+		}, nil
+	case BackendMemory:
+		return func(key string) Storage {
+			return &memoryStorage{}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown session storage %q", backend)
+	}
+}
+
+// validatingStorage treats unreadable session data as missing so the client
+// authorizes again instead of failing to start.
+type validatingStorage struct {
+	key string
+	Storage
+}
+
+func validate(key string, s Storage) Storage {
+	return &validatingStorage{key: key, Storage: s}
+}
+
+func (v *validatingStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	data, err := v.Storage.LoadSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || !json.Valid(data) {
+		slog.Warn("Stored session is corrupt, dropping it", "session", v.key)
+		if err := v.Storage.Reset(ctx); err != nil {
+			slog.Error("Failed to drop corrupt session", "session", v.key, "error", err)
+		}
+		return nil, tgsession.ErrNotFound
+	}
+	return data, nil
+}
+
+// encryptedStorage seals the session before it is stored. Sealed sessions
+// are stored base64 encoded, as the redis backend only keeps text.
+type encryptedStorage struct {
+	Storage
+	secrets *bottoken.Cipher
+}
+
+func encrypt(s Storage, secrets *bottoken.Cipher) Storage {
+	return &encryptedStorage{Storage: s, secrets: secrets}
+}
+
+func (e *encryptedStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	stored, err := e.Storage.LoadSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(stored))
+	if err != nil {
+		// stored before sessions were encrypted, sealed on the next store
+		if json.Valid(stored) {
+			return stored, nil
+		}
+		return []byte{}, nil
+	}
+	data, err := e.secrets.Open(sealed)
+	if err != nil {
+		// e.g. after the secret changed, handed to validatingStorage as corrupt
+		return []byte{}, nil
+	}
+	return data, nil
+}
+
+func (e *encryptedStorage) StoreSession(ctx context.Context, data []byte) error {
+	sealed, err := e.secrets.Seal(data)
+	if err != nil {
+		return err
+	}
+	return e.Storage.StoreSession(ctx, []byte(base64.StdEncoding.EncodeToString(sealed)))
+}
+
+type fileStorage struct {
+	tgsession.FileStorage
+}
+
+func (f *fileStorage) Reset(_ context.Context) error {
+	if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type pgStorage struct {
+	key  string
+	repo repo.Querier
+}
+
+func (p *pgStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	data, err := p.repo.GetBotSession(ctx, p.key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, tgsession.ErrNotFound
+	}
+	return data, err
+}
+
+func (p *pgStorage) StoreSession(ctx context.Context, data []byte) error {
+	return p.repo.UpsertBotSession(ctx, repo.UpsertBotSessionParams{Key: p.key, Data: data})
+}
+
+func (p *pgStorage) Reset(ctx context.Context) error {
+	return p.repo.DeleteBotSession(ctx, p.key)
+}
+
+type redisStorage struct {
+	key   string
+	redis rs.RedisService
+}
+
+func (r *redisStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	raw := r.redis.Get(ctx, r.key)
+	if len(raw) == 0 {
+		return nil, tgsession.ErrNotFound
+	}
+	var data string
+	if err := json.Unmarshal(raw, &data); err != nil {
+		// handed to validatingStorage as corrupt
+		return []byte{}, nil
+	}
+	return []byte(data), nil
+}
+
+func (r *redisStorage) StoreSession(ctx context.Context, data []byte) error {
+	r.redis.Set(ctx, r.key, string(data), 0)
+	return nil
+}
+
+func (r *redisStorage) Reset(ctx context.Context) error {
+	r.redis.Del(ctx, r.key)
+	return nil
+}
+
+type memoryStorage struct {
+	tgsession.StorageMemory
+}
+
+func (m *memoryStorage) Reset(ctx context.Context) error {
+	return m.StoreSession(ctx, nil)
+}
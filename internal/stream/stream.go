@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"sync"
 
@@ -55,7 +56,13 @@ func NewTgFileReader(tgAPI *tg.Client, ctx context.Context, fileLocation *tg.Inp
 
 func (r *TgFileReader) SetupStream(req *http.Request, w http.ResponseWriter, isDownload bool) error {
 	if isDownload {
-		w.Header().Set("Content-Disposition", "attachment; filename=\""+r.File.FileName+"\"")
+		// FormatMediaType encodes names which aren't plain ASCII as RFC 2231
+		// asks, renamed files often have such names
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": r.File.FileName})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		w.Header().Set("Content-Disposition", disposition)
 	}
 	rangeHeader := req.Header.Get("Range")
 	isFull := rangeHeader == ""
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gotd/td/tg"
 )
@@ -31,6 +32,17 @@ type BroadcastState struct {
 	FailedCountChan    chan int
 }
 
+type BotStatus struct {
+	Username   string
+	Default    bool
+	FromEnv    bool
+	Userbot    bool
+	InRotation bool
+	Draining   bool
+	Pressure   int
+	Cooldown   time.Duration
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -45,6 +57,26 @@ type FileResponse struct {
 	AppName        string
 }
 
+type CollectionFileResponse struct {
+	Title        string
+	Size         string
+	WatchLink    string
+	DownloadLink string
+}
+
+type CollectionResponse struct {
+	Title        string
+	Files        []CollectionFileResponse
+	TotalSize    string
+	PlaylistLink string
+	AppName      string
+}
+
+type PasswordResponse struct {
+	AppName string
+	Error   string
+}
+
 var (
 	ErrorNotFound       = fmt.Errorf("data not found")
 	ErrorInternalServer = fmt.Errorf("internal server error. Please try again later or report the issue to developer")